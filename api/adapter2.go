@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +18,7 @@ import (
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
 )
 
 var adapterLog = log.GetLogger("ADP")
@@ -37,6 +39,8 @@ type Adapter struct {
 	conn      *db.Connector
 	db        string
 	dbOptions map[string]interface{}
+	// precision of the metrics database, rows are written in it
+	precision lineprotocol.Precision
 }
 
 func NewAdapter(c *config.Config) *Adapter {
@@ -48,20 +52,36 @@ func NewAdapter(c *config.Config) *Adapter {
 		usessl:    c.TDengine.Usessl,
 		db:        c.Metrics.Database.Name,
 		dbOptions: c.Metrics.Database.Options,
+		precision: mustDatabasePrecision(c),
 	}
 }
 
 func (a *Adapter) Init(c gin.IRouter) error {
+	if err := a.Prepare(); err != nil {
+		return err
+	}
+	a.Register(c)
+	return nil
+}
+
+// Register registers routes of adapter.
+func (a *Adapter) Register(c gin.IRouter) {
+	c.POST("/adapter_report", a.handleFunc())
+}
+
+// Prepare creates database and table and connects to database.
+func (a *Adapter) Prepare() error {
 	if err := a.createDatabase(); err != nil {
 		return fmt.Errorf("create database error:%s", err)
 	}
-	if err := a.initConnect(); err != nil {
-		return fmt.Errorf("init db connect error:%s", err)
+	if a.conn == nil {
+		if err := a.initConnect(); err != nil {
+			return fmt.Errorf("init db connect error:%s", err)
+		}
 	}
 	if err := a.createTable(); err != nil {
 		return fmt.Errorf("create table error:%s", err)
 	}
-	c.POST("/adapter_report", a.handleFunc())
 	return nil
 }
 
@@ -92,23 +112,37 @@ func (a *Adapter) handleFunc() gin.HandlerFunc {
 		var report AdapterReport
 		if err = json.Unmarshal(data, &report); err != nil {
 			adapterLog.Errorf("parse adapter report data error, data:%s, error:%s", string(data), err)
+			rejected(c, data, qid, err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse adapter report data error: %s", err)})
 			return
 		}
-		sql := a.parseSql(report)
-		adapterLog.Debugf("adapter report sql:%s", sql)
-
-		if _, err = a.conn.Exec(context.Background(), sql, qid); err != nil {
+		if !validate(c, data, qid, []record{{
+			stable: "adapter_requests",
+			tags:   map[string]string{"endpoint": report.Endpoint},
+			ts:     strconv.FormatInt(report.Timestamp, 10),
+		}}) {
+			return
+		}
+		ts, err := checkTimestamp(c, report.Endpoint, strconv.FormatInt(report.Timestamp, 10))
+		if err != nil {
+			adapterLog.Errorf("invalid adapter report ts, msg:%s", err)
+			rejected(c, data, qid, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err = a.conn.Insert(c.Request.Context(), a.parseRows(report, ts), qid); err != nil {
 			adapterLog.Errorf("adapter report error, msg:%s", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			recordWriteError(err)
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			return
 		}
+		recordWrite()
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
 
 func (a *Adapter) initConnect() error {
-	conn, err := db.NewConnectorWithDb(a.username, a.password, a.host, a.port, a.db, a.usessl)
+	conn, err := db.DefaultManager.Get(a.username, a.password, a.host, a.port, a.db, a.usessl)
 	if err != nil {
 		adapterLog.Dup().Errorf("init db connect error, msg:%s", err)
 		return err
@@ -117,24 +151,40 @@ func (a *Adapter) initConnect() error {
 	return nil
 }
 
-func (a *Adapter) parseSql(report AdapterReport) string {
-	// reqType: 0: rest, 1: websocket
-	restTbName := a.tableName(report.Endpoint, rest)
-	wsTbName := a.tableName(report.Endpoint, ws)
-	ts := time.Unix(report.Timestamp, 0).Format(time.RFC3339)
-	metric := report.Metric
-	return fmt.Sprintf("insert into %s using adapter_requests tags ('%s', %d) "+
-		"values('%s', %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d) "+
-		"%s using adapter_requests tags ('%s', %d) "+
-		"values('%s', %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d)",
-		restTbName, report.Endpoint, rest, ts, metric.RestTotal, metric.RestQuery, metric.RestWrite, metric.RestOther,
-		metric.RestInProcess, metric.RestSuccess, metric.RestFail, metric.RestQuerySuccess, metric.RestQueryFail,
-		metric.RestWriteSuccess, metric.RestWriteFail, metric.RestOtherSuccess, metric.RestOtherFail,
-		metric.RestQueryInProcess, metric.RestWriteInProcess,
-		wsTbName, report.Endpoint, ws, ts, metric.WSTotal,
-		metric.WSQuery, metric.WSWrite, metric.WSOther, metric.WSInProcess, metric.WSSuccess, metric.WSFail,
-		metric.WSQuerySuccess, metric.WSQueryFail, metric.WSWriteSuccess, metric.WSWriteFail, metric.WSOtherSuccess,
-		metric.WSOtherFail, metric.WSQueryInProcess, metric.WSWriteInProcess)
+// Close closes the connection, requests received after Close get "no connection".
+func (a *Adapter) Close() error {
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.Close()
+}
+
+type adapterRequestTags struct {
+	Endpoint string         `taos:"endpoint"`
+	ReqType  adapterReqType `taos:"req_type"`
+}
+
+// parseRows returns rows of rest and websocket requests at ts, both are read from report.Metric by column prefix.
+func (a *Adapter) parseRows(report AdapterReport, t time.Time) []db.Row {
+	ts := a.precision.Timestamp(t)
+	return []db.Row{
+		{
+			STable:  "adapter_requests",
+			Table:   a.tableName(report.Endpoint, rest),
+			Tags:    adapterRequestTags{Endpoint: report.Endpoint, ReqType: rest},
+			Ts:      ts,
+			Columns: report.Metric,
+			Prefix:  "rest_",
+		},
+		{
+			STable:  "adapter_requests",
+			Table:   a.tableName(report.Endpoint, ws),
+			Tags:    adapterRequestTags{Endpoint: report.Endpoint, ReqType: ws},
+			Ts:      ts,
+			Columns: report.Metric,
+			Prefix:  "ws_",
+		},
+	}
 }
 
 func (a *Adapter) tableName(endpoint string, reqType adapterReqType) string {
@@ -160,11 +210,10 @@ func (a *Adapter) createDatabase() error {
 		logrus.Fields{config.ReqIDKey: qid},
 	)
 
-	conn, err := db.NewConnector(a.username, a.password, a.host, a.port, a.usessl)
+	conn, err := db.DefaultManager.Get(a.username, a.password, a.host, a.port, "", a.usessl)
 	if err != nil {
 		return fmt.Errorf("connect to database error, msg:%s", err)
 	}
-	defer func() { _ = conn.Close() }()
 	sql := a.createDBSql()
 	adapterLog.Infof("create database, sql:%s", sql)
 	_, err = conn.Exec(context.Background(), sql, util.GetQidOwn())
@@ -230,34 +279,34 @@ type AdapterReport struct {
 }
 
 type AdapterMetrics struct {
-	RestTotal          int `json:"rest_total"`
-	RestQuery          int `json:"rest_query"`
-	RestWrite          int `json:"rest_write"`
-	RestOther          int `json:"rest_other"`
-	RestInProcess      int `json:"rest_in_process"`
-	RestSuccess        int `json:"rest_success"`
-	RestFail           int `json:"rest_fail"`
-	RestQuerySuccess   int `json:"rest_query_success"`
-	RestQueryFail      int `json:"rest_query_fail"`
-	RestWriteSuccess   int `json:"rest_write_success"`
-	RestWriteFail      int `json:"rest_write_fail"`
-	RestOtherSuccess   int `json:"rest_other_success"`
-	RestOtherFail      int `json:"rest_other_fail"`
-	RestQueryInProcess int `json:"rest_query_in_process"`
-	RestWriteInProcess int `json:"rest_write_in_process"`
-	WSTotal            int `json:"ws_total"`
-	WSQuery            int `json:"ws_query"`
-	WSWrite            int `json:"ws_write"`
-	WSOther            int `json:"ws_other"`
-	WSInProcess        int `json:"ws_in_process"`
-	WSSuccess          int `json:"ws_success"`
-	WSFail             int `json:"ws_fail"`
-	WSQuerySuccess     int `json:"ws_query_success"`
-	WSQueryFail        int `json:"ws_query_fail"`
-	WSWriteSuccess     int `json:"ws_write_success"`
-	WSWriteFail        int `json:"ws_write_fail"`
-	WSOtherSuccess     int `json:"ws_other_success"`
-	WSOtherFail        int `json:"ws_other_fail"`
-	WSQueryInProcess   int `json:"ws_query_in_process"`
-	WSWriteInProcess   int `json:"ws_write_in_process"`
+	RestTotal          int `json:"rest_total" taos:"rest_total"`
+	RestQuery          int `json:"rest_query" taos:"rest_query"`
+	RestWrite          int `json:"rest_write" taos:"rest_write"`
+	RestOther          int `json:"rest_other" taos:"rest_other"`
+	RestInProcess      int `json:"rest_in_process" taos:"rest_in_process"`
+	RestSuccess        int `json:"rest_success" taos:"rest_success"`
+	RestFail           int `json:"rest_fail" taos:"rest_fail"`
+	RestQuerySuccess   int `json:"rest_query_success" taos:"rest_query_success"`
+	RestQueryFail      int `json:"rest_query_fail" taos:"rest_query_fail"`
+	RestWriteSuccess   int `json:"rest_write_success" taos:"rest_write_success"`
+	RestWriteFail      int `json:"rest_write_fail" taos:"rest_write_fail"`
+	RestOtherSuccess   int `json:"rest_other_success" taos:"rest_other_success"`
+	RestOtherFail      int `json:"rest_other_fail" taos:"rest_other_fail"`
+	RestQueryInProcess int `json:"rest_query_in_process" taos:"rest_query_in_process"`
+	RestWriteInProcess int `json:"rest_write_in_process" taos:"rest_write_in_process"`
+	WSTotal            int `json:"ws_total" taos:"ws_total"`
+	WSQuery            int `json:"ws_query" taos:"ws_query"`
+	WSWrite            int `json:"ws_write" taos:"ws_write"`
+	WSOther            int `json:"ws_other" taos:"ws_other"`
+	WSInProcess        int `json:"ws_in_process" taos:"ws_in_process"`
+	WSSuccess          int `json:"ws_success" taos:"ws_success"`
+	WSFail             int `json:"ws_fail" taos:"ws_fail"`
+	WSQuerySuccess     int `json:"ws_query_success" taos:"ws_query_success"`
+	WSQueryFail        int `json:"ws_query_fail" taos:"ws_query_fail"`
+	WSWriteSuccess     int `json:"ws_write_success" taos:"ws_write_success"`
+	WSWriteFail        int `json:"ws_write_fail" taos:"ws_write_fail"`
+	WSOtherSuccess     int `json:"ws_other_success" taos:"ws_other_success"`
+	WSOtherFail        int `json:"ws_other_fail" taos:"ws_other_fail"`
+	WSQueryInProcess   int `json:"ws_query_in_process" taos:"ws_query_in_process"`
+	WSWriteInProcess   int `json:"ws_write_in_process" taos:"ws_write_in_process"`
 }
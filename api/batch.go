@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taosdata/taoskeeper/infrastructure/log"
+)
+
+var batchLogger = log.GetLogger("BAT")
+
+// ErrBatchPending is returned by Add when the caller's context is done before its batch is written. The data stays
+// buffered and is still written, only its result is unknown to the caller.
+var ErrBatchPending = errors.New("write batch pending")
+
+// reasons of flushing a batch
+const (
+	FlushBySize   = "size"
+	FlushByWindow = "window"
+	FlushByClose  = "shutdown"
+)
+
+// WriteBatcher coalesces line protocol of concurrent requests into one write. A batch is written when it reaches
+// maxSize bytes or window passed since its first request. Callers are acked after their batch is written, or right
+// after buffering in async mode, errors are only logged with qids of the requests then. A failed batch of several
+// requests is written again request by request, so that only requests with bad data fail.
+type WriteBatcher struct {
+	lock    sync.Mutex
+	maxSize int
+	window  time.Duration
+	async   bool
+	write   func(ctx context.Context, buf *bytes.Buffer, qids []uint64) error
+
+	pending *writeBatch
+	timer   *time.Timer
+	writing sync.WaitGroup
+
+	stats WriteBatchStats
+}
+
+type WriteBatchStats struct {
+	// Flushes counts batches by flush reason
+	Flushes  map[string]uint64
+	Requests uint64
+	Bytes    uint64
+	Failures uint64
+	// Latency is the total time spent writing batches
+	Latency time.Duration
+}
+
+// writeBatch is line protocol of requests written together, qids and ends of data in buf are of the requests in order.
+type writeBatch struct {
+	buf     *bytes.Buffer
+	waiters []chan error
+	qids    []uint64
+	ends    []int
+}
+
+// NewWriteBatcher returns a batcher writing batches by write, which is given qids of requests in the batch.
+func NewWriteBatcher(maxSize int, window time.Duration, async bool,
+	write func(ctx context.Context, buf *bytes.Buffer, qids []uint64) error) (*WriteBatcher, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("max size of write batch must be positive, got %d", maxSize)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("window of write batch must be positive, got %s", window)
+	}
+	return &WriteBatcher{
+		maxSize: maxSize,
+		window:  window,
+		async:   async,
+		write:   write,
+		pending: &writeBatch{buf: &bytes.Buffer{}},
+		stats:   WriteBatchStats{Flushes: map[string]uint64{}},
+	}, nil
+}
+
+// Add buffers data of request qid, it returns the result of writing the data. It returns nil at once in async mode, and
+// ErrBatchPending if ctx is done first, the data is written anyway then.
+func (b *WriteBatcher) Add(ctx context.Context, data []byte, qid uint64) error {
+	done := make(chan error, 1)
+	b.lock.Lock()
+	b.pending.buf.Write(data)
+	b.pending.waiters = append(b.pending.waiters, done)
+	b.pending.qids = append(b.pending.qids, qid)
+	b.pending.ends = append(b.pending.ends, b.pending.buf.Len())
+	b.stats.Requests++
+	if b.pending.buf.Len() >= b.maxSize {
+		batch := b.take()
+		b.lock.Unlock()
+		b.flush(batch, FlushBySize)
+	} else {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.window, b.flushWindow)
+		}
+		b.lock.Unlock()
+	}
+	if b.async {
+		return nil
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrBatchPending
+	}
+}
+
+// take returns pending batch and starts a new one, it must be called with lock held.
+func (b *WriteBatcher) take() *writeBatch {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = &writeBatch{buf: &bytes.Buffer{}}
+	b.writing.Add(1)
+	return batch
+}
+
+func (b *WriteBatcher) flushWindow() {
+	b.lock.Lock()
+	if b.pending.buf.Len() == 0 {
+		b.lock.Unlock()
+		return
+	}
+	batch := b.take()
+	b.lock.Unlock()
+	b.flush(batch, FlushByWindow)
+}
+
+func (b *WriteBatcher) flush(batch *writeBatch, reason string) {
+	defer b.writing.Done()
+	size := batch.buf.Len()
+	start := time.Now()
+	err := b.write(context.Background(), batch.buf, batch.qids)
+	latency := time.Since(start)
+	if err != nil {
+		batchLogger.Errorf("write batch error, reason:%s, requests:%d, qids:%s, bytes:%d, msg:%s", reason,
+			len(batch.qids), formatQids(batch.qids), size, err)
+	}
+
+	b.lock.Lock()
+	b.stats.Flushes[reason]++
+	b.stats.Bytes += uint64(size)
+	b.stats.Latency += latency
+	if err != nil {
+		b.stats.Failures++
+	}
+	b.lock.Unlock()
+
+	if err == nil || len(batch.waiters) == 1 {
+		for _, done := range batch.waiters {
+			done <- err
+		}
+		return
+	}
+	b.writeEach(batch)
+}
+
+// writeEach writes data of every request in a failed batch on its own, each request gets the result of its own data.
+func (b *WriteBatcher) writeEach(batch *writeBatch) {
+	data := batch.buf.Bytes()
+	start := 0
+	for i, end := range batch.ends {
+		err := b.write(context.Background(), bytes.NewBuffer(data[start:end]), batch.qids[i:i+1])
+		if err != nil {
+			batchLogger.Errorf("write request of failed batch error, qid:0x%x, bytes:%d, msg:%s", batch.qids[i],
+				end-start, err)
+		}
+		batch.waiters[i] <- err
+		start = end
+	}
+}
+
+// formatQids returns qids in hex as they are logged by requests.
+func formatQids(qids []uint64) string {
+	s := make([]string, len(qids))
+	for i, qid := range qids {
+		s[i] = fmt.Sprintf("0x%x", qid)
+	}
+	return strings.Join(s, ",")
+}
+
+// Flush writes pending batch and waits for batches being written.
+func (b *WriteBatcher) Flush(ctx context.Context) error {
+	b.lock.Lock()
+	if b.pending.buf.Len() > 0 {
+		batch := b.take()
+		b.lock.Unlock()
+		b.flush(batch, FlushByClose)
+	} else {
+		b.lock.Unlock()
+	}
+	return waitGroup(ctx, &b.writing)
+}
+
+func (b *WriteBatcher) Stats() WriteBatchStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	stats := b.stats
+	stats.Flushes = make(map[string]uint64, len(b.stats.Flushes))
+	for reason, n := range b.stats.Flushes {
+		stats.Flushes[reason] = n
+	}
+	return stats
+}
+
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
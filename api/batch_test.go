@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchRecorder struct {
+	lock    sync.Mutex
+	batches []string
+	qids    [][]uint64
+	err     error
+}
+
+func (r *batchRecorder) write(ctx context.Context, buf *bytes.Buffer, qids []uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.batches = append(r.batches, buf.String())
+	r.qids = append(r.qids, qids)
+	return r.err
+}
+
+func (r *batchRecorder) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.batches...)
+}
+
+func TestWriteBatcherWindow(t *testing.T) {
+	recorder := &batchRecorder{}
+	b, err := NewWriteBatcher(1<<20, 50*time.Millisecond, false, recorder.write)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i, line := range []string{"a 1\n", "b 2\n", "c 3\n"} {
+		wg.Add(1)
+		go func(line string, qid uint64) {
+			defer wg.Done()
+			assert.NoError(t, b.Add(context.Background(), []byte(line), qid))
+		}(line, uint64(i+1))
+	}
+	wg.Wait()
+	batches := recorder.get()
+	if assert.Len(t, batches, 1) {
+		assert.Len(t, batches[0], 12)
+		assert.ElementsMatch(t, []uint64{1, 2, 3}, recorder.qids[0])
+	}
+	stats := b.Stats()
+	assert.Equal(t, uint64(1), stats.Flushes[FlushByWindow])
+	assert.Equal(t, uint64(3), stats.Requests)
+	assert.Equal(t, uint64(12), stats.Bytes)
+}
+
+func TestWriteBatcherSize(t *testing.T) {
+	recorder := &batchRecorder{err: errors.New("write error")}
+	b, err := NewWriteBatcher(4, time.Hour, false, recorder.write)
+	assert.NoError(t, err)
+
+	// reaching max size writes at once and returns the write error
+	assert.EqualError(t, b.Add(context.Background(), []byte("a 1\n"), 0x1), "write error")
+	assert.Equal(t, []string{"a 1\n"}, recorder.get())
+	stats := b.Stats()
+	assert.Equal(t, uint64(1), stats.Flushes[FlushBySize])
+	assert.Equal(t, uint64(1), stats.Failures)
+}
+
+func TestWriteBatcherAsync(t *testing.T) {
+	recorder := &batchRecorder{}
+	b, err := NewWriteBatcher(1<<20, time.Hour, true, recorder.write)
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Add(context.Background(), []byte("a 1\n"), 0x1))
+	assert.Empty(t, recorder.get())
+	assert.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, []string{"a 1\n"}, recorder.get())
+	// failures of async writes are traced by qids of the requests
+	assert.Equal(t, [][]uint64{{0x1}}, recorder.qids)
+	assert.Equal(t, uint64(1), b.Stats().Flushes[FlushByClose])
+
+	// nothing pending
+	assert.NoError(t, b.Flush(context.Background()))
+	assert.Len(t, recorder.get(), 1)
+}
+
+func TestWriteBatcherWriteEach(t *testing.T) {
+	var lock sync.Mutex
+	var writes []string
+	b, err := NewWriteBatcher(1<<20, 50*time.Millisecond, false, func(ctx context.Context, buf *bytes.Buffer, qids []uint64) error {
+		lock.Lock()
+		defer lock.Unlock()
+		writes = append(writes, buf.String())
+		if strings.Contains(buf.String(), "bad") {
+			return errors.New("invalid data")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	results := make([]error, 3)
+	var wg sync.WaitGroup
+	for i, line := range []string{"a 1\n", "bad\n", "c 3\n"} {
+		wg.Add(1)
+		go func(i int, line string) {
+			defer wg.Done()
+			results[i] = b.Add(context.Background(), []byte(line), uint64(i+1))
+		}(i, line)
+	}
+	wg.Wait()
+	// the failed batch is written again request by request, only the bad request fails
+	assert.NoError(t, results[0])
+	assert.EqualError(t, results[1], "invalid data")
+	assert.NoError(t, results[2])
+	assert.Len(t, writes, 4)
+	assert.ElementsMatch(t, []string{"a 1\n", "bad\n", "c 3\n"}, writes[1:])
+	assert.Equal(t, uint64(1), b.Stats().Failures)
+}
+
+func TestWriteBatcherPending(t *testing.T) {
+	recorder := &batchRecorder{}
+	b, err := NewWriteBatcher(1<<20, time.Hour, false, recorder.write)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the data is still written though the caller does not wait for it
+	assert.ErrorIs(t, b.Add(ctx, []byte("a 1\n"), 0x1), ErrBatchPending)
+	assert.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, []string{"a 1\n"}, recorder.get())
+}
+
+func TestNewWriteBatcherInvalid(t *testing.T) {
+	recorder := &batchRecorder{}
+	_, err := NewWriteBatcher(0, time.Second, false, recorder.write)
+	assert.Error(t, err)
+	_, err = NewWriteBatcher(1<<20, 0, false, recorder.write)
+	assert.Error(t, err)
+}
+
+func TestFormatQids(t *testing.T) {
+	assert.Equal(t, "0x1,0xff", formatQids([]uint64{1, 255}))
+	assert.Equal(t, "", formatQids(nil))
+}
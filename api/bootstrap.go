@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taoskeeper/infrastructure/log"
+)
+
+var bootstrapLogger = log.GetLogger("BOT")
+
+const (
+	BootstrapInitializing = "initializing"
+	BootstrapReady        = "ready"
+)
+
+const (
+	bootstrapMinBackoff = time.Second
+	bootstrapMaxBackoff = 30 * time.Second
+)
+
+type bootstrapStep struct {
+	name string
+	run  func(ctx context.Context) error
+	done chan struct{}
+}
+
+// Bootstrap runs initialization steps in order and retries each step with backoff until it succeeds, so keeper
+// can start before TDengine is available. Handlers depending on a step are gated until the step is done.
+type Bootstrap struct {
+	lock  sync.RWMutex
+	steps []*bootstrapStep
+	ready chan struct{}
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func NewBootstrap() *Bootstrap {
+	return &Bootstrap{
+		ready:      make(chan struct{}),
+		minBackoff: bootstrapMinBackoff,
+		maxBackoff: bootstrapMaxBackoff,
+	}
+}
+
+// Add appends a step, it must be called before Run.
+func (b *Bootstrap) Add(name string, run func(ctx context.Context) error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.steps = append(b.steps, &bootstrapStep{name: name, run: run, done: make(chan struct{})})
+}
+
+func (b *Bootstrap) step(name string) *bootstrapStep {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, s := range b.steps {
+		if s.name == name {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("bootstrap step %s not exists", name))
+}
+
+// Run runs steps in order until all of them succeed or ctx is done.
+func (b *Bootstrap) Run(ctx context.Context) {
+	b.lock.RLock()
+	steps := b.steps
+	b.lock.RUnlock()
+	for _, s := range steps {
+		backoff := b.minBackoff
+		for attempt := 1; ; attempt++ {
+			err := runBootstrapStep(ctx, s)
+			if err == nil {
+				bootstrapLogger.Infof("bootstrap step %s done", s.name)
+				close(s.done)
+				break
+			}
+			bootstrapLogger.Errorf("bootstrap step %s failed, attempt:%d, retry in %s, error:%s", s.name, attempt,
+				backoff, err)
+			select {
+			case <-ctx.Done():
+				bootstrapLogger.Warnf("bootstrap canceled at step %s", s.name)
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > b.maxBackoff {
+				backoff = b.maxBackoff
+			}
+		}
+	}
+	close(b.ready)
+	bootstrapLogger.Info("bootstrap finished")
+}
+
+// runBootstrapStep runs step and turns panic into error, since most initialization code panics on error.
+func runBootstrapStep(ctx context.Context, s *bootstrapStep) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.run(ctx)
+}
+
+// Done returns a channel closed when step name succeeded.
+func (b *Bootstrap) Done(name string) <-chan struct{} {
+	return b.step(name).done
+}
+
+// Status returns BootstrapReady when all steps are done, else BootstrapInitializing.
+func (b *Bootstrap) Status() string {
+	select {
+	case <-b.ready:
+		return BootstrapReady
+	default:
+		return BootstrapInitializing
+	}
+}
+
+// Gate responds 503 until step name is done.
+func (b *Bootstrap) Gate(name string) gin.HandlerFunc {
+	done := b.Done(name)
+	return func(c *gin.Context) {
+		select {
+		case <-done:
+			c.Next()
+		default:
+			c.Header("Retry-After", "5")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable,
+				gin.H{"error": fmt.Sprintf("keeper is initializing, waiting for %s", name)})
+		}
+	}
+}
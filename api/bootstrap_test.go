@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrap(t *testing.T) {
+	b := NewBootstrap()
+	b.minBackoff = time.Millisecond
+	b.maxBackoff = time.Millisecond
+
+	attempts := 0
+	b.Add("database", func(ctx context.Context) error {
+		attempts++
+		switch attempts {
+		case 1:
+			return errors.New("connection refused")
+		case 2:
+			panic("create database error")
+		}
+		return nil
+	})
+	release := make(chan struct{})
+	b.Add("processor", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	router := gin.New()
+	router.GET("report", b.Gate("database"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("metrics", b.Gate("processor"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/report"))
+	assert.Equal(t, BootstrapInitializing, b.Status())
+
+	finished := make(chan struct{})
+	go func() {
+		b.Run(context.Background())
+		close(finished)
+	}()
+	<-b.Done("database")
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, http.StatusNoContent, serve("/report"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/metrics"))
+	assert.Equal(t, BootstrapInitializing, b.Status())
+
+	close(release)
+	<-finished
+	assert.Equal(t, http.StatusNoContent, serve("/metrics"))
+	assert.Equal(t, BootstrapReady, b.Status())
+}
+
+func TestBootstrapCancel(t *testing.T) {
+	b := NewBootstrap()
+	b.Add("database", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Run(ctx)
+	assert.Equal(t, BootstrapInitializing, b.Status())
+	select {
+	case <-b.Done("database"):
+		t.Fatal("step should not be done")
+	default:
+	}
+}
@@ -1,21 +1,175 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
 )
 
-func NewCheckHealth(version string) *CheckHealth {
-	return &CheckHealth{version: version}
+// NewCheckHealth creates check health, bootstrap is optional and status is always ready without it.
+func NewCheckHealth(version string, bootstrap *Bootstrap) *CheckHealth {
+	return &CheckHealth{version: version, bootstrap: bootstrap}
 }
 
 type CheckHealth struct {
-	version string
+	version   string
+	bootstrap *Bootstrap
 }
 
 func (h *CheckHealth) Init(c gin.IRouter) {
 	c.GET("check_health", func(context *gin.Context) {
+		resp := map[string]string{"version": h.version, "status": BootstrapReady}
+		if h.bootstrap != nil {
+			resp["status"] = h.bootstrap.Status()
+		}
+		if err := db.AuthFailed(); err != nil {
+			resp["status"] = StatusDegraded
+			resp["reason"] = err.Error()
+		}
+		context.JSON(http.StatusOK, resp)
+	})
+	// live only tells keeper process is able to serve http
+	c.GET("live", func(context *gin.Context) {
 		context.JSON(http.StatusOK, map[string]string{"version": h.version})
 	})
 }
+
+// StatusDegraded is reported by /check_health when TDengine rejected credentials
+const StatusDegraded = "degraded"
+
+const readyCheckTimeout = 5 * time.Second
+
+// Readiness serves /ready, keeper is ready when taosAdapter is reachable, metrics database exists,
+// Processor is initialized and the latest write of reported data succeeded.
+type Readiness struct {
+	username       string
+	password       string
+	host           string
+	port           int
+	usessl         bool
+	database       string
+	processorReady func() bool
+
+	lock sync.Mutex
+	conn *db.Connector
+}
+
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type ReadyResponse struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func NewReadiness(conf *config.Config, processorReady func() bool) *Readiness {
+	return &Readiness{
+		username:       conf.TDengine.Username,
+		password:       conf.TDengine.Password,
+		host:           conf.TDengine.Host,
+		port:           conf.TDengine.Port,
+		usessl:         conf.TDengine.Usessl,
+		database:       conf.Metrics.Database.Name,
+		processorReady: processorReady,
+	}
+}
+
+func (r *Readiness) Init(c gin.IRouter) {
+	c.GET("ready", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+		defer cancel()
+		resp := r.Check(ctx)
+		if resp.Ready {
+			c.JSON(http.StatusOK, resp)
+		} else {
+			c.JSON(http.StatusServiceUnavailable, resp)
+		}
+	})
+}
+
+// Check runs all checks, a check is skipped as failed when taosAdapter is unreachable.
+func (r *Readiness) Check(ctx context.Context) ReadyResponse {
+	resp := ReadyResponse{Ready: true, Checks: map[string]CheckResult{}}
+	set := func(name string, err error) {
+		if err != nil {
+			resp.Ready = false
+			resp.Checks[name] = CheckResult{Error: err.Error()}
+			return
+		}
+		resp.Checks[name] = CheckResult{OK: true}
+	}
+
+	dbErr := r.checkDatabase(ctx)
+	set("database", dbErr)
+	if dbErr != nil {
+		set("metrics_database", fmt.Errorf("database unreachable"))
+	} else {
+		set("metrics_database", r.checkMetricsDatabase(ctx))
+	}
+	if r.processorReady == nil || !r.processorReady() {
+		set("processor", fmt.Errorf("processor not initialized"))
+	} else {
+		set("processor", nil)
+	}
+	set("last_write", LastWriteError())
+	return resp
+}
+
+func (r *Readiness) getConn() (*db.Connector, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn != nil {
+		return r.conn, nil
+	}
+	conn, err := db.DefaultManager.Get(r.username, r.password, r.host, r.port, "", r.usessl)
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	return conn, nil
+}
+
+func (r *Readiness) checkDatabase(ctx context.Context) error {
+	conn, err := r.getConn()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Query(ctx, "select server_version()", util.GetQidOwn())
+	return err
+}
+
+func (r *Readiness) checkMetricsDatabase(ctx context.Context) error {
+	conn, err := r.getConn()
+	if err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("select name from information_schema.ins_databases where name='%s'", r.database)
+	data, err := conn.Query(ctx, sql, util.GetQidOwn())
+	if err != nil {
+		return err
+	}
+	if len(data.Data) == 0 {
+		return fmt.Errorf("database %s not exists", r.database)
+	}
+	return nil
+}
+
+func (r *Readiness) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
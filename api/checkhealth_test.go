@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+func TestReadiness(t *testing.T) {
+	conf := &config.Config{}
+	conf.TDengine.Host = "127.0.0.1"
+	conf.TDengine.Port = 1
+	conf.Metrics.Database.Name = "log"
+	ready := false
+	readiness := NewReadiness(conf, func() bool { return ready })
+	defer readiness.Close()
+
+	router := gin.New()
+	NewCheckHealth("test", nil).Init(router)
+	readiness.Init(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/live", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// errors of bad payloads do not fail readiness
+	recordWriteError(errors.New("invalid data"))
+	assert.NoError(t, LastWriteError())
+	recordWriteError(retry.Temporary(errors.New("write failed")))
+	defer recordWrite()
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp ReadyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Ready)
+	assert.False(t, resp.Checks["database"].OK)
+	assert.False(t, resp.Checks["metrics_database"].OK)
+	assert.Equal(t, CheckResult{Error: "processor not initialized"}, resp.Checks["processor"])
+	assert.Equal(t, CheckResult{Error: "write failed"}, resp.Checks["last_write"])
+
+	ready = true
+	recordWrite()
+	resp = readiness.Check(context.Background())
+	assert.True(t, resp.Checks["processor"].OK)
+	assert.True(t, resp.Checks["last_write"].OK)
+}
@@ -3,9 +3,15 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/taosdata/taoskeeper/db"
 	"github.com/taosdata/taoskeeper/infrastructure/config"
@@ -15,6 +21,80 @@ import (
 
 var commonLogger = log.GetLogger("CMN")
 
+// lastWrite is the unix nano time of the latest successful write of reported data
+var lastWrite int64
+
+// lastWriteErr keeps the result of the latest write of reported data
+var lastWriteErr atomic.Value
+
+type writeResult struct {
+	err error
+}
+
+func recordWrite() {
+	atomic.StoreInt64(&lastWrite, time.Now().UnixNano())
+	lastWriteErr.Store(writeResult{})
+}
+
+// recordWriteError records err of a failed write for readiness if it is caused by the backend, errors of bad
+// payloads are ignored as they do not mean keeper can not write.
+func recordWriteError(err error) {
+	if !db.IsBackendError(err) {
+		return
+	}
+	lastWriteErr.Store(writeResult{err: err})
+}
+
+// LastWriteError returns the error of the latest write of reported data, nil if it succeeded or nothing written yet.
+func LastWriteError() error {
+	result, _ := lastWriteErr.Load().(writeResult)
+	return result.err
+}
+
+// LastWriteTime returns the time of the latest successful write of reported data, zero if nothing written yet.
+func LastWriteTime() time.Time {
+	t := atomic.LoadInt64(&lastWrite)
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+// errorStatus returns 503 if err is caused by open circuit breaker, else status.
+func errorStatus(err error, status int) int {
+	if errors.Is(err, db.ErrBreakerOpen) {
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
+
+// BreakerGate responds 503 without reading request while circuit breaker of TDengine backend is open.
+func BreakerGate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db.DefaultBreaker.State() == db.BreakerOpen {
+			c.Header("Retry-After", "5")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": db.ErrBreakerOpen.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// BearerAuth responds 401 to requests without token as their bearer token, all requests are refused if token is
+// empty.
+func BearerAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if len(token) == 0 || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
 func CreateDatabase(username string, password string, host string, port int, usessl bool, dbname string, databaseOptions map[string]interface{}) {
 	qid := util.GetQidOwn()
 
@@ -24,26 +104,19 @@ func CreateDatabase(username string, password string, host string, port int, use
 
 	ctx := context.Background()
 
-	conn, err := db.NewConnector(username, password, host, port, usessl)
+	conn, err := db.DefaultManager.Get(username, password, host, port, "", usessl)
 	if err != nil {
 		commonLogger.Errorf("connect to adapter error, msg:%s", err)
 		return
 	}
 
-	defer closeConn(conn)
-
 	createDBSql := generateCreateDBSql(dbname, databaseOptions)
 	commonLogger.Warningf("create database sql: %s", createDBSql)
 
-	for i := 0; i < 3; i++ {
-		if _, err := conn.Exec(ctx, createDBSql, util.GetQidOwn()); err != nil {
-			commonLogger.Errorf("try %v times: create database %s error, msg:%v", i+1, dbname, err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		return
+	if _, err := conn.Exec(ctx, createDBSql, util.GetQidOwn()); err != nil {
+		commonLogger.Errorf("create database %s error, msg:%v", dbname, err)
+		panic(err)
 	}
-	panic(err)
 }
 
 func generateCreateDBSql(dbname string, databaseOptions map[string]interface{}) string {
@@ -67,12 +140,11 @@ func generateCreateDBSql(dbname string, databaseOptions map[string]interface{})
 
 func CreatTables(username string, password string, host string, port int, usessl bool, dbname string, createList []string) {
 	ctx := context.Background()
-	conn, err := db.NewConnectorWithDb(username, password, host, port, dbname, usessl)
+	conn, err := db.DefaultManager.Get(username, password, host, port, dbname, usessl)
 	if err != nil {
 		commonLogger.Errorf("connect to database error, msg:%s", err)
 		return
 	}
-	defer closeConn(conn)
 
 	for _, createSql := range createList {
 		commonLogger.Infof("execute sql:%s", createSql)
@@ -81,9 +153,3 @@ func CreatTables(username string, password string, host string, port int, usessl
 		}
 	}
 }
-
-func closeConn(conn *db.Connector) {
-	if err := conn.Close(); err != nil {
-		commonLogger.Errorf("close connection error, msg:%s", err)
-	}
-}
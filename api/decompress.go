@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var errDecompressedSize = errors.New("decompressed body too large")
+
+// Decompress decodes request body by Content-Encoding, gzip, deflate, zstd and snappy (block format, as in
+// Prometheus remote write) are supported. Decoded body over maxDecompressedSize gets 413 and unknown encodings get
+// 415. Handlers get the decoded body without Content-Encoding.
+func (l *Limits) Decompress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := c.GetHeader("Content-Encoding")
+		if len(encoding) == 0 {
+			c.Next()
+			return
+		}
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("read request body error. %s", err)})
+			return
+		}
+		// encodings are listed in the order applied, decode from the last one
+		codings := strings.Split(encoding, ",")
+		for i := len(codings) - 1; i >= 0; i-- {
+			coding := strings.ToLower(strings.TrimSpace(codings[i]))
+			data, err = l.decode(coding, data)
+			if errors.Is(err, errDecompressedSize) {
+				l.reject(c, LimitDecompressedSize, http.StatusRequestEntityTooLarge, 0)
+				return
+			}
+			if err != nil {
+				status := http.StatusBadRequest
+				if !supportedEncoding(coding) {
+					status = http.StatusUnsupportedMediaType
+				}
+				c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("decode %s request body error. %s", coding, err)})
+				return
+			}
+		}
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		c.Request.ContentLength = int64(len(data))
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		c.Next()
+	}
+}
+
+func supportedEncoding(coding string) bool {
+	switch coding {
+	case "", "identity", "gzip", "x-gzip", "deflate", "zstd", "snappy":
+		return true
+	}
+	return false
+}
+
+func (l *Limits) decode(coding string, data []byte) ([]byte, error) {
+	switch coding {
+	case "", "identity":
+		return data, nil
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return l.readDecoded(r)
+	case "deflate":
+		// deflate is zlib wrapped, some clients send raw deflate stream though
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if errors.Is(err, zlib.ErrHeader) {
+			r, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return l.readDecoded(r)
+	case "zstd":
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if l.maxDecompressedSize > 0 {
+			options = append(options, zstd.WithDecoderMaxMemory(uint64(l.maxDecompressedSize)))
+		}
+		r, err := zstd.NewReader(bytes.NewReader(data), options...)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return l.readDecoded(r)
+	case "snappy":
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if l.maxDecompressedSize > 0 && int64(n) > l.maxDecompressedSize {
+			return nil, errDecompressedSize
+		}
+		return snappy.Decode(nil, data)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+// readDecoded reads r up to maxDecompressedSize bytes.
+func (l *Limits) readDecoded(r io.Reader) ([]byte, error) {
+	if l.maxDecompressedSize <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, l.maxDecompressedSize+1))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, errDecompressedSize
+		}
+		return nil, err
+	}
+	if int64(len(data)) > l.maxDecompressedSize {
+		return nil, errDecompressedSize
+	}
+	return data, nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch encoding {
+	case "gzip":
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(data)
+		assert.NoError(t, w.Close())
+	case "deflate":
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write(data)
+		assert.NoError(t, w.Close())
+	case "raw deflate":
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		_, _ = w.Write(data)
+		assert.NoError(t, w.Close())
+	case "zstd":
+		w, _ := zstd.NewWriter(&buf)
+		_, _ = w.Write(data)
+		assert.NoError(t, w.Close())
+	case "snappy":
+		return snappy.Encode(nil, data)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	limits := NewLimits(config.LimitConfig{MaxDecompressedSize: 1024})
+	var body, encoding string
+	router := gin.New()
+	router.POST("/general-metric", limits.Decompress(), func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		body = string(data)
+		encoding = c.GetHeader("Content-Encoding")
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	send := func(encoding string, data []byte) int {
+		req := httptest.NewRequest(http.MethodPost, "/general-metric", bytes.NewReader(data))
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	data := []byte(`[{"ts":"1703226836762","protocol":2,"tables":[]}]`)
+	for _, enc := range []string{"gzip", "deflate", "raw deflate", "zstd", "snappy"} {
+		header := enc
+		if enc == "raw deflate" {
+			header = "deflate"
+		}
+		body, encoding = "", "x"
+		assert.Equal(t, http.StatusOK, send(header, compress(t, enc, data)), enc)
+		assert.Equal(t, string(data), body, enc)
+		assert.Empty(t, encoding, enc)
+	}
+
+	// encodings are decoded in reverse order
+	assert.Equal(t, http.StatusOK, send("zstd, gzip", compress(t, "gzip", compress(t, "zstd", data))))
+	assert.Equal(t, string(data), body)
+
+	assert.Equal(t, http.StatusOK, send("", data))
+	assert.Equal(t, string(data), body)
+	assert.Equal(t, http.StatusUnsupportedMediaType, send("br", data))
+	assert.Equal(t, http.StatusBadRequest, send("gzip", data))
+
+	bomb := []byte(strings.Repeat("0", 1025))
+	for _, enc := range []string{"gzip", "deflate", "zstd", "snappy"} {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, send(enc, compress(t, enc, bomb)), enc)
+	}
+	assert.Equal(t, uint64(4), limits.Hits()[LimitDecompressedSize])
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/taosdata/taoskeeper/util"
+)
+
+// kinds of tokens of sql
+const (
+	tokenSpace = iota
+	tokenComment
+	tokenString
+	tokenNumber
+	tokenWord
+	// tokenQuoted is an identifier quoted by backticks
+	tokenQuoted
+	tokenOther
+)
+
+type sqlToken struct {
+	kind int
+	text string
+}
+
+// lexSql splits sql into tokens, concatenating their texts gives sql back.
+func lexSql(sql string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		start, kind := i, tokenOther
+		ch := sql[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			kind = tokenSpace
+			for i++; i < len(sql) && (sql[i] == ' ' || sql[i] == '\t' || sql[i] == '\n' || sql[i] == '\r'); i++ {
+			}
+		case ch == '-' && strings.HasPrefix(sql[i:], "--"):
+			kind, i = tokenComment, skipUntil(sql, i+2, "\n")
+		case ch == '/' && strings.HasPrefix(sql[i:], "/*"):
+			kind, i = tokenComment, skipUntil(sql, i+2, "*/")
+		case ch == '\'' || ch == '"':
+			kind, i = tokenString, skipQuoted(sql, i)
+		case ch == '`':
+			kind, i = tokenQuoted, skipUntil(sql, i+1, "`")
+		case isDigit(ch) || (ch == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			// numbers with exponents, hex and durations such as 10s are all literals
+			kind = tokenNumber
+			for i++; i < len(sql) && (isWordByte(sql[i]) || sql[i] == '.' ||
+				((sql[i] == '+' || sql[i] == '-') && (sql[i-1] == 'e' || sql[i-1] == 'E'))); i++ {
+			}
+		case isWordByte(ch):
+			kind = tokenWord
+			for i++; i < len(sql) && isWordByte(sql[i]); i++ {
+			}
+		case strings.IndexByte(operatorBytes, ch) >= 0:
+			for i++; i < len(sql) && strings.IndexByte(operatorBytes, sql[i]) >= 0; i++ {
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, sqlToken{kind: kind, text: sql[start:i]})
+	}
+	return tokens
+}
+
+// Fingerprint returns the shape of sql, queries differing only in literals have the same fingerprint. String and
+// numeric literals are replaced by ?, IN lists of literals are collapsed to a single ?, unquoted words are
+// lowercased, as TDengine does with keywords and identifiers, and comments and whitespace are dropped.
+func Fingerprint(sql string) string {
+	var tokens []string
+	for _, token := range lexSql(sql) {
+		switch token.kind {
+		case tokenSpace, tokenComment:
+		case tokenString, tokenNumber:
+			tokens = append(tokens, "?")
+		case tokenWord:
+			tokens = append(tokens, strings.ToLower(token.text))
+		default:
+			tokens = append(tokens, token.text)
+		}
+	}
+	return joinTokens(collapseInLists(tokens))
+}
+
+// FingerprintHash returns the hash stored with slow queries of fingerprint.
+func FingerprintHash(fingerprint string) string {
+	return util.GetMd5HexStr(fingerprint)
+}
+
+// bytes of comparison operators, a run of them is one token
+const operatorBytes = "<>=!"
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// isWordByte reports whether ch is part of a keyword or an identifier, bytes of multibyte characters included.
+func isWordByte(ch byte) bool {
+	return ch == '_' || isDigit(ch) || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
+
+// skipUntil returns the index after the first end in sql from i, or len(sql) if not found.
+func skipUntil(sql string, i int, end string) int {
+	if n := strings.Index(sql[i:], end); n >= 0 {
+		return i + n + len(end)
+	}
+	return len(sql)
+}
+
+// skipQuoted returns the index after the string literal starting at i, quotes are escaped by backslash or doubled.
+func skipQuoted(sql string, i int) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// collapseInLists replaces `in (?, ?, ...)` with `in (?)`.
+func collapseInLists(tokens []string) []string {
+	collapsed := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		collapsed = append(collapsed, tokens[i])
+		if tokens[i] != "in" || i+2 >= len(tokens) || tokens[i+1] != "(" {
+			continue
+		}
+		end := i + 2
+		for end < len(tokens) && (tokens[end] == "?" || tokens[end] == ",") {
+			end++
+		}
+		if end > i+2 && end < len(tokens) && tokens[end] == ")" {
+			collapsed = append(collapsed, "(", "?", ")")
+			i = end
+		}
+	}
+	return collapsed
+}
+
+// joinTokens joins tokens with spaces, except around dots, inside parentheses, before commas and between a word and
+// its opening parenthesis.
+func joinTokens(tokens []string) string {
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 {
+			prev := tokens[i-1]
+			switch {
+			case token == "," || token == ")" || token == "." || prev == "(" || prev == ".":
+			case token == "(" && (isWordByte(prev[0]) || prev[0] == '`'):
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	for sql, want := range map[string]string{
+		"SELECT * FROM meters WHERE ts > 1703226836762 AND location = 'beijing'":          "select * from meters where ts > ? and location = ?",
+		"select  avg(current)\n from test.meters where groupid in (1, 2,3) interval(10s)": "select avg(current) from test.meters where groupid in(?) interval(?)",
+		"select * from t where v in (1, a)":                                               "select * from t where v in(?, a)",
+		`insert into d1001 values (now, 10.3, 'it''s', "a\"b")`:                           "insert into d1001 values(now, ?, ?, ?)",
+		"select `Col1` from `DB`.`T1` where x>=-1.5e+3 -- comment":                        "select `Col1` from `DB`.`T1` where x >= - ?",
+		"select /* hint */ count(*) from t where c1 != 0x1F":                              "select count(*) from t where c1 != ?",
+		"select 名称 from t where v = '未闭合":                                                 "select 名称 from t where v = ?",
+		"SHOW DATABASES": "show databases",
+	} {
+		assert.Equal(t, want, Fingerprint(sql), sql)
+	}
+	assert.Equal(t, FingerprintHash(Fingerprint("select * from t where a = 1")),
+		FingerprintHash(Fingerprint("SELECT * FROM t WHERE a = 'x'")))
+	assert.Len(t, FingerprintHash(""), 32)
+}
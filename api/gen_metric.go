@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,17 +13,18 @@ import (
 	"regexp"
 
 	"net/url"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	taosError "github.com/taosdata/driver-go/v3/errors"
 	"github.com/taosdata/taoskeeper/db"
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+	"github.com/taosdata/taoskeeper/util/retry"
 )
 
 var re = regexp.MustCompile("'+")
@@ -32,16 +34,6 @@ var MAX_SQL_LEN = 1000000
 
 var STABLE_NAME_KEY = "priv_stn"
 
-type ColumnSeq struct {
-	tagNames    []string
-	metricNames []string
-}
-
-var (
-	mu            sync.RWMutex
-	gColumnSeqMap = make(map[string]ColumnSeq)
-)
-
 type GeneralMetric struct {
 	client   *http.Client
 	conn     *db.Connector
@@ -52,6 +44,21 @@ type GeneralMetric struct {
 	usessl   bool
 	database string
 	url      *url.URL
+	// writeTimeout is the deadline of a line protocol write including retries
+	writeTimeout time.Duration
+	// batcher coalesces writes of concurrent requests, nil if disabled
+	batcher *WriteBatcher
+	schemas *SchemaRegistry
+	// subTables names child tables of stables
+	subTables *SubTableNamer
+	// precision of the metrics database, line protocol is written in it
+	precision lineprotocol.Precision
+	// slowSqls aggregates slow queries by fingerprint, nil if disabled
+	slowSqls *SlowSqlAggregator
+	// redactor redacts slow queries before stored
+	redactor *Redactor
+	// maskQueried masks literals of slow queries returned by the query API, as they are stored unmasked
+	maskQueried bool
 }
 
 type Tag struct {
@@ -59,9 +66,11 @@ type Tag struct {
 	Value string `json:"value"`
 }
 
+// Metric is a number, bool or string value. Type hints the type of Value, it is f64 for numbers if omitted.
 type Metric struct {
-	Name  string  `json:"name"`
-	Value float64 `json:"value"`
+	Name  string      `json:"name"`
+	Value MetricValue `json:"value"`
+	Type  string      `json:"type,omitempty"`
 }
 
 type MetricGroup struct {
@@ -106,26 +115,42 @@ type SlowSqlDetailInfo struct {
 }
 
 func (gm *GeneralMetric) Init(c gin.IRouter) error {
+	gm.Register(c)
+	return gm.Prepare()
+}
+
+// Register registers routes of general metric.
+func (gm *GeneralMetric) Register(c gin.IRouter) {
 	c.POST("/general-metric", gm.handleFunc())
 	c.POST("/taosd-cluster-basic", gm.handleTaosdClusterBasic())
 	c.POST("/slow-sql-detail-batch", gm.handleSlowSqlDetailBatch())
+}
 
-	conn, err := db.NewConnectorWithDb(gm.username, gm.password, gm.host, gm.port, gm.database, gm.usessl)
-	if err != nil {
-		gmLogger.Errorf("init db connect error, msg:%s", err)
-		return err
+// RegisterQuery registers routes reading data written by general metric.
+func (gm *GeneralMetric) RegisterQuery(c gin.IRouter) {
+	c.GET("/api/v1/slow-sql", gm.handleSlowSqlQuery())
+}
+
+// Prepare connects to database, creates stables and loads schemas of stables.
+func (gm *GeneralMetric) Prepare() error {
+	if gm.conn == nil {
+		conn, err := db.DefaultManager.Get(gm.username, gm.password, gm.host, gm.port, gm.database, gm.usessl)
+		if err != nil {
+			gmLogger.Errorf("init db connect error, msg:%s", err)
+			return err
+		}
+		gm.conn = conn
 	}
-	gm.conn = conn
 
-	err = gm.createSTables()
+	err := gm.createSTables()
 	if err != nil {
 		gmLogger.Errorf("create stable error, msg:%s", err)
 		return err
 	}
 
-	err = gm.initColumnSeqMap()
+	err = gm.loadSchemas()
 	if err != nil {
-		gmLogger.Errorf("init  gColumnSeqMap error, msg:%s", err)
+		gmLogger.Errorf("load schemas error, msg:%s", err)
 		return err
 	}
 
@@ -158,24 +183,100 @@ func NewGeneralMetric(conf *config.Config) *GeneralMetric {
 		protocol = "http"
 	}
 
+	precision := mustDatabasePrecision(conf)
 	imp := &GeneralMetric{
-		client:   client,
-		username: conf.TDengine.Username,
-		password: conf.TDengine.Password,
-		host:     conf.TDengine.Host,
-		port:     conf.TDengine.Port,
-		usessl:   conf.TDengine.Usessl,
-		database: conf.Metrics.Database.Name,
+		client:       client,
+		username:     conf.TDengine.Username,
+		password:     conf.TDengine.Password,
+		host:         conf.TDengine.Host,
+		port:         conf.TDengine.Port,
+		usessl:       conf.TDengine.Usessl,
+		database:     conf.Metrics.Database.Name,
+		writeTimeout: conf.Timeout.Write,
 		url: &url.URL{
 			Scheme:   protocol,
 			Host:     fmt.Sprintf("%s:%d", conf.TDengine.Host, conf.TDengine.Port),
 			Path:     "/influxdb/v1/write",
-			RawQuery: fmt.Sprintf("db=%s&precision=ms&table_name_key=%s", conf.Metrics.Database.Name, STABLE_NAME_KEY),
+			RawQuery: fmt.Sprintf("db=%s&precision=%s&table_name_key=%s", conf.Metrics.Database.Name, precision, STABLE_NAME_KEY),
 		},
+		precision: precision,
+	}
+	subTables, err := NewSubTableNamer(conf.Metrics.SubTable)
+	if err != nil {
+		panic(fmt.Errorf("invalid metrics.subtable config: %s", err))
+	}
+	imp.subTables = subTables
+	if imp.redactor, err = NewRedactor(conf.SlowSql.Redaction); err != nil {
+		panic(fmt.Errorf("invalid slowSql.redaction config: %s", err))
+	}
+	imp.maskQueried = !conf.SlowSql.Redaction.MaskLiterals
+	imp.schemas = NewSchemaRegistry(imp.descSchema)
+	if conf.SlowSql.AggregateWindow > 0 {
+		imp.slowSqls = NewSlowSqlAggregator(conf.SlowSql.AggregateWindow, conf.SlowSql.MaxSamples, precision,
+			func(ctx context.Context, rows []db.Row) error {
+				if imp.conn == nil {
+					return errNoConnection
+				}
+				if _, err := imp.conn.Insert(ctx, rows, util.GetQidOwn()); err != nil {
+					recordWriteError(err)
+					return err
+				}
+				recordWrite()
+				return nil
+			})
+	}
+	if conf.WriteBatch.Enable {
+		imp.batcher, err = NewWriteBatcher(conf.WriteBatch.MaxSize, conf.WriteBatch.Window, conf.WriteBatch.AsyncAck,
+			func(ctx context.Context, buf *bytes.Buffer, qids []uint64) error {
+				// the batch is written with its own qid, qids of coalesced requests are logged with it
+				qid := util.GetQidOwn()
+				gmLogger.WithFields(logrus.Fields{config.ReqIDKey: qid}).Tracef("write batch, qids:%s", formatQids(qids))
+				return imp.lineWriteBody(ctx, buf, qid)
+			})
+		if err != nil {
+			panic(fmt.Errorf("invalid writeBatch config: %s", err))
+		}
 	}
 	return imp
 }
 
+// Batcher returns the write batcher, nil if write coalescing is disabled.
+func (gm *GeneralMetric) Batcher() *WriteBatcher {
+	return gm.batcher
+}
+
+// Redactor returns the redactor of slow queries.
+func (gm *GeneralMetric) Redactor() *Redactor {
+	return gm.redactor
+}
+
+// Schemas returns schemas of stables written by general metric.
+func (gm *GeneralMetric) Schemas() *SchemaRegistry {
+	return gm.schemas
+}
+
+// Flush writes line protocol buffered by the batcher and slow queries being aggregated.
+func (gm *GeneralMetric) Flush(ctx context.Context) error {
+	if gm.slowSqls != nil {
+		if err := gm.slowSqls.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	if gm.batcher == nil {
+		return nil
+	}
+	return gm.batcher.Flush(ctx)
+}
+
+// Close closes the connection and idle connections to taosAdapter.
+func (gm *GeneralMetric) Close() error {
+	gm.client.CloseIdleConnections()
+	if gm.conn == nil {
+		return nil
+	}
+	return gm.conn.Close()
+}
+
 func (gm *GeneralMetric) handleFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		qid := util.GetQid(c.GetHeader("X-QID"))
@@ -205,6 +306,7 @@ func (gm *GeneralMetric) handleFunc() gin.HandlerFunc {
 
 		if err := json.Unmarshal(data, &request); err != nil {
 			gmLogger.Errorf("parse general metric data error, data:%s, error:%s", string(data), err)
+			rejected(c, data, qid, err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse general metric data error: %s", err)})
 			return
 		}
@@ -213,12 +315,25 @@ func (gm *GeneralMetric) handleFunc() gin.HandlerFunc {
 			c.JSON(http.StatusOK, gin.H{})
 			return
 		}
+		if !allowCluster(c, metricsClusterID(request)) {
+			return
+		}
+		if !validate(c, data, qid, metricsRecords(request)) {
+			return
+		}
+		request = checkMetricsTimestamps(c, request)
 
-		err = gm.handleBatchMetrics(request, qid)
+		err = gm.handleBatchMetrics(c.Request.Context(), request, qid)
 
+		if errors.Is(err, ErrBatchPending) {
+			// the data is buffered and will be written, the request just can not wait for the result
+			gmLogger.Warnf("request done before its write batch is written")
+			c.JSON(http.StatusAccepted, gin.H{})
+			return
+		}
 		if err != nil {
 			gmLogger.Errorf("process records error. msg:%s", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("process records error. %s", err)})
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": fmt.Sprintf("process records error. %s", err)})
 			return
 		}
 
@@ -226,14 +341,73 @@ func (gm *GeneralMetric) handleFunc() gin.HandlerFunc {
 	}
 }
 
-func (gm *GeneralMetric) handleBatchMetrics(request []StableArrayInfo, qid uint64) error {
+// metricsClusterID returns the first cluster_id tag of request, a request is reported by one cluster.
+func metricsClusterID(request []StableArrayInfo) string {
+	for _, stableArrayInfo := range request {
+		for _, table := range stableArrayInfo.Tables {
+			for _, metricGroup := range table.MetricGroups {
+				for _, tag := range metricGroup.Tags {
+					if tag.Name == "cluster_id" {
+						return tag.Value
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// metricsRecords returns a record for each metric group of request.
+func metricsRecords(request []StableArrayInfo) []record {
+	var records []record
+	for _, stableArrayInfo := range request {
+		for _, table := range stableArrayInfo.Tables {
+			for _, metricGroup := range table.MetricGroups {
+				rec := record{stable: table.Name, tags: make(map[string]string, len(metricGroup.Tags)),
+					ts: stableArrayInfo.Ts}
+				for _, tag := range metricGroup.Tags {
+					rec.tags[tag.Name] = tag.Value
+				}
+				for _, metric := range metricGroup.Metrics {
+					rec.metrics = append(rec.metrics, metric.Name)
+				}
+				records = append(records, rec)
+			}
+		}
+	}
+	return records
+}
+
+// checkMetricsTimestamps returns entries of request whose ts are in bounds, entries without ts are kept for
+// handleBatchMetrics to report.
+func checkMetricsTimestamps(c *gin.Context, request []StableArrayInfo) []StableArrayInfo {
+	valid := request[:0]
+	for _, stableArrayInfo := range request {
+		if stableArrayInfo.Ts != "" {
+			if _, err := checkTimestamp(c, c.ClientIP(), stableArrayInfo.Ts); err != nil {
+				gmLogger.Errorf("skip metrics of invalid ts, msg:%s", err)
+				continue
+			}
+		}
+		valid = append(valid, stableArrayInfo)
+	}
+	return valid
+}
+
+func (gm *GeneralMetric) handleBatchMetrics(ctx context.Context, request []StableArrayInfo, qid uint64) error {
 	var buf bytes.Buffer
+	enc := lineprotocol.NewEncoder(&buf, gm.precision)
 
 	for _, stableArrayInfo := range request {
 		if stableArrayInfo.Ts == "" {
 			gmLogger.Error("ts data is empty")
 			continue
 		}
+		ts, err := ParseTimestamp(stableArrayInfo.Ts)
+		if err != nil {
+			gmLogger.Errorf("invalid ts:%s", stableArrayInfo.Ts)
+			continue
+		}
 
 		for _, table := range stableArrayInfo.Tables {
 			if table.Name == "" {
@@ -242,56 +416,122 @@ func (gm *GeneralMetric) handleBatchMetrics(request []StableArrayInfo, qid uint6
 			}
 
 			table.Name = strings.ToLower(table.Name)
-			if _, ok := Load(table.Name); !ok {
-				Init(table.Name)
-			}
 
 			for _, metricGroup := range table.MetricGroups {
-				buf.WriteString(table.Name)
-				writeTags(metricGroup.Tags, table.Name, &buf)
-				buf.WriteString(" ")
-				writeMetrics(metricGroup.Metrics, table.Name, &buf)
-				buf.WriteString(" ")
-				buf.WriteString(stableArrayInfo.Ts)
-				buf.WriteString("\n")
+				schema, changed := gm.schemas.Ensure(table.Name, metricGroup.Tags, metricGroup.Metrics)
+				if changed {
+					gmLogger.Infof("schema of %s changed, tags:%v, metrics:%v", table.Name, schema.Tags, schema.Metrics)
+				}
+				enc.StartLine(table.Name)
+				writeTags(metricGroup.Tags, schema.Tags, table.Name, gm.subTables, enc)
+				writeMetrics(metricGroup.Metrics, schema, enc)
+				if err := enc.EndLine(ts); err != nil {
+					gmLogger.Errorf("encode metrics of %s error, msg:%s", table.Name, err)
+				}
 			}
 		}
 	}
 
-	if buf.Len() > 0 {
-		return gm.lineWriteBody(&buf, qid)
+	if buf.Len() == 0 {
+		return nil
 	}
-	return nil
+	if gm.batcher != nil {
+		gmLogger.WithFields(logrus.Fields{config.ReqIDKey: qid}).Tracef("add %d bytes to write batch", buf.Len())
+		return gm.batcher.Add(ctx, buf.Bytes(), qid)
+	}
+	return gm.lineWriteBody(ctx, &buf, qid)
 }
 
-func (gm *GeneralMetric) lineWriteBody(buf *bytes.Buffer, qid uint64) error {
+func (gm *GeneralMetric) lineWriteBody(ctx context.Context, buf *bytes.Buffer, qid uint64) error {
 	gmLogger := gmLogger.WithFields(
 		logrus.Fields{config.ReqIDKey: qid},
 	)
 
-	header := map[string][]string{
-		"Connection": {"keep-alive"},
-	}
-	req_data := buf.String()
-
 	//build new URL，add qid to URL
 	urlWithQid := *gm.url
 	query := urlWithQid.Query()
 	query.Set("qid", fmt.Sprintf("%d", qid))
 	urlWithQid.RawQuery = query.Encode()
 
+	if gm.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gm.writeTimeout)
+		defer cancel()
+	}
+	body := buf.Bytes()
+	err := retry.Default().Do(ctx, retry.Idempotent, func(ctx context.Context) error {
+		return gm.write(ctx, &urlWithQid, body, gmLogger)
+	})
+	if err != nil {
+		recordWriteError(err)
+		if isSchemaError(err) {
+			// stables may be altered by others, reload them so that following writes match
+			stables := lineStables(body)
+			if refreshErr := gm.schemas.Refresh(context.Background(), stables...); refreshErr != nil {
+				gmLogger.Errorf("refresh schemas of %v error, msg:%s", stables, refreshErr)
+			}
+		}
+		return err
+	}
+	recordWrite()
+	return nil
+}
+
+// lineWriteError is a failed response of line protocol write, it unwraps to the TDengine error in the body if any.
+type lineWriteError struct {
+	status  int
+	body    string
+	taosErr error
+}
+
+func newLineWriteError(status int, body []byte) *lineWriteError {
+	e := &lineWriteError{status: status, body: string(body)}
+	// taosAdapter responds {"code":<TDengine error code>,"desc":"<message>"}
+	var resp struct {
+		Code int    `json:"code"`
+		Desc string `json:"desc"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Code != 0 {
+		e.taosErr = taosError.NewError(resp.Code, resp.Desc)
+	}
+	return e
+}
+
+func (e *lineWriteError) Error() string {
+	return fmt.Sprintf("unexpected status code %d:body:%s", e.status, e.body)
+}
+
+func (e *lineWriteError) Unwrap() error {
+	return e.taosErr
+}
+
+// write sends line protocol body once through circuit breaker, 5xx responses are temporary errors.
+func (gm *GeneralMetric) write(ctx context.Context, u *url.URL, body []byte, gmLogger *logrus.Entry) (err error) {
+	if err = db.DefaultBreaker.Allow(); err != nil {
+		return err
+	}
+	defer func() { db.DefaultBreaker.Done(err) }()
+
+	header := map[string][]string{
+		"Connection": {"keep-alive"},
+	}
 	req := &http.Request{
 		Method:     http.MethodPost,
-		URL:        &urlWithQid,
+		URL:        u,
 		Proto:      "HTTP/1.1",
 		ProtoMajor: 1,
 		ProtoMinor: 1,
 		Header:     header,
 		Host:       gm.url.Host,
 	}
-	req.SetBasicAuth(gm.username, gm.password)
+	req = req.WithContext(ctx)
+	username, password := gm.username, gm.password
+	if sharedUsername, sharedPassword := db.Credentials(); len(sharedUsername) > 0 {
+		username, password = sharedUsername, sharedPassword
+	}
+	req.SetBasicAuth(username, password)
 
-	req.Body = io.NopCloser(buf)
+	req.Body = io.NopCloser(bytes.NewReader(body))
 
 	startTime := time.Now()
 	resp, err := gm.client.Do(req)
@@ -300,17 +540,24 @@ func (gm *GeneralMetric) lineWriteBody(buf *bytes.Buffer, qid uint64) error {
 	latency := endTime.Sub(startTime)
 
 	if err != nil {
-		gmLogger.Errorf("latency:%v, req_data:%v, url:%s, resp:%d, err:%s", latency, req_data, urlWithQid.String(), resp.StatusCode, err)
+		gmLogger.Errorf("latency:%v, req_data:%s, url:%s, err:%s", latency, body, u.String(), err)
 		return err
 	}
 	if logger.Logger.IsLevelEnabled(logrus.TraceLevel) {
-		gmLogger.Tracef("latency:%v, req_data:%v, url:%s, resp:%d", latency, req_data, urlWithQid.String(), resp.StatusCode)
+		gmLogger.Tracef("latency:%v, req_data:%s, url:%s, resp:%d", latency, body, u.String(), resp.StatusCode)
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code %d:body:%s", resp.StatusCode, string(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		err = newLineWriteError(resp.StatusCode, respBody)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			err = db.NewAuthError(err)
+		case resp.StatusCode >= http.StatusInternalServerError:
+			err = retry.Temporary(err)
+		}
+		return err
 	}
 	return nil
 }
@@ -343,19 +590,40 @@ func (gm *GeneralMetric) handleTaosdClusterBasic() gin.HandlerFunc {
 
 		if err := json.Unmarshal(data, &request); err != nil {
 			gmLogger.Errorf("parse general metric data error, data:%s, msg:%s", string(data), err)
+			rejected(c, data, qid, err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse general metric data error: %s", err)})
 			return
 		}
+		if !allowCluster(c, request.ClusterId) {
+			return
+		}
+		if !validate(c, data, qid, []record{{
+			stable: "taosd_cluster_basic",
+			tags:   map[string]string{"cluster_id": request.ClusterId},
+			ts:     request.Ts,
+		}}) {
+			return
+		}
+
+		ts, err := checkTimestamp(c, c.ClientIP(), request.Ts)
+		if err != nil {
+			gmLogger.Errorf("invalid taosd cluster basic ts, msg:%s", err)
+			rejected(c, data, qid, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		sql := fmt.Sprintf(
-			"insert into %s.taosd_cluster_basic_%s using taosd_cluster_basic tags ('%s') values (%s, '%s', %d, '%s') ",
-			gm.database, request.ClusterId, request.ClusterId, request.Ts, request.FirstEp, request.FirstEpDnodeId, request.ClusterVersion)
+			"insert into %s.taosd_cluster_basic_%s using taosd_cluster_basic tags ('%s') values (%d, '%s', %d, '%s') ",
+			gm.database, request.ClusterId, request.ClusterId, gm.precision.Timestamp(ts), request.FirstEp, request.FirstEpDnodeId, request.ClusterVersion)
 
-		if _, err = gm.conn.Exec(context.Background(), sql, qid); err != nil {
+		if _, err = gm.conn.Exec(c.Request.Context(), sql, qid); err != nil {
 			gmLogger.Errorf("insert taosd_cluster_basic error, msg:%s", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insert taosd_cluster_basic error. %s", err)})
+			recordWriteError(err)
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": fmt.Sprintf("insert taosd_cluster_basic error. %s", err)})
 			return
 		}
+		recordWrite()
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
@@ -375,6 +643,23 @@ func processString(input string) string {
 	return input
 }
 
+// slowSqlRecords returns a record for each slow sql of request, db, user and ip are optional and only set if
+// reported.
+func slowSqlRecords(request []SlowSqlDetailInfo) []record {
+	records := make([]record, 0, len(request))
+	for _, info := range request {
+		rec := record{stable: "taos_slow_sql_detail", tags: map[string]string{"cluster_id": info.ClusterId},
+			ts: info.StartTs}
+		for name, value := range map[string]string{"db": info.Db, "user": info.User, "ip": info.Ip} {
+			if len(value) > 0 {
+				rec.tags[name] = value
+			}
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
 func (gm *GeneralMetric) handleSlowSqlDetailBatch() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		qid := util.GetQid(c.GetHeader("X-QID"))
@@ -403,19 +688,42 @@ func (gm *GeneralMetric) handleSlowSqlDetailBatch() gin.HandlerFunc {
 
 		if err := json.Unmarshal(data, &request); err != nil {
 			gmLogger.Errorf("parse taos slow sql detail error, msg:%s", string(data))
+			rejected(c, data, qid, err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse taos slow sql detail error: %s", err)})
 			return
 		}
+		if len(request) > 0 && !allowCluster(c, request[0].ClusterId) {
+			return
+		}
+		if !validate(c, data, qid, slowSqlRecords(request)) {
+			return
+		}
 
-		var sql_head = "INSERT INTO `taos_slow_sql_detail` (tbname, `db`, `user`, `ip`, `cluster_id`, `start_ts`, `request_id`, `query_time`, `code`, `error_info`, `type`, `rows_num`, `sql`, `process_name`, `process_id`) values "
+		var sql_head = "INSERT INTO `taos_slow_sql_detail` (tbname, `db`, `user`, `ip`, `cluster_id`, `start_ts`, `request_id`, `query_time`, `code`, `error_info`, `type`, `rows_num`, `sql`, `process_name`, `process_id`, `fingerprint_hash`) values "
 		var buf bytes.Buffer
 		buf.WriteString(sql_head)
 		var qid_counter uint8 = 0
+		// slow sqls are aggregated only after they are written
+		var written []slowSql
 		for _, slowSqlDetailInfo := range request {
 			if slowSqlDetailInfo.StartTs == "" {
 				gmLogger.Error("start_ts data is empty")
 				continue
 			}
+			// start_ts is when the query started, not when it is reported, so it tells nothing about clock skew
+			startTs, err := checkTimestamp(c, "", slowSqlDetailInfo.StartTs)
+			if err != nil {
+				gmLogger.Errorf("skip slow sql of invalid start_ts, msg:%s", err)
+				continue
+			}
+
+			redacted, keep := gm.redactor.Redact(slowSqlDetailInfo)
+			if !keep {
+				continue
+			}
+			slowSqlDetailInfo.Sql = redacted
+			fingerprint := Fingerprint(slowSqlDetailInfo.Sql)
+			hash := FingerprintHash(fingerprint)
 
 			// cut string to max len
 			slowSqlDetailInfo.Sql = re.ReplaceAllString(slowSqlDetailInfo.Sql, "'") // 将匹配到的部分替换为一个单引号
@@ -437,52 +745,64 @@ func (gm *GeneralMetric) handleSlowSqlDetailBatch() gin.HandlerFunc {
 			sub_table_name = strings.ToLower(processString(sub_table_name))
 
 			var sql = fmt.Sprintf(
-				"('%s', '%s', '%s', '%s', '%s', %s, %s, %d, %d, '%s', %d, %d, '%s', '%s', '%s') ",
+				"('%s', '%s', '%s', '%s', '%s', %d, %s, %d, %d, '%s', %d, %d, '%s', '%s', '%s', '%s') ",
 				sub_table_name,
-				slowSqlDetailInfo.Db, slowSqlDetailInfo.User, slowSqlDetailInfo.Ip, slowSqlDetailInfo.ClusterId, slowSqlDetailInfo.StartTs, slowSqlDetailInfo.RequestId,
+				slowSqlDetailInfo.Db, slowSqlDetailInfo.User, slowSqlDetailInfo.Ip, slowSqlDetailInfo.ClusterId, gm.precision.Timestamp(startTs), slowSqlDetailInfo.RequestId,
 				slowSqlDetailInfo.QueryTime, slowSqlDetailInfo.Code, slowSqlDetailInfo.ErrorInfo, slowSqlDetailInfo.Type, slowSqlDetailInfo.RowsNum, slowSqlDetailInfo.Sql,
-				slowSqlDetailInfo.ProcessName, slowSqlDetailInfo.ProcessId)
+				slowSqlDetailInfo.ProcessName, slowSqlDetailInfo.ProcessId, hash)
 			if (buf.Len() + len(sql)) < MAX_SQL_LEN {
 				buf.WriteString(sql)
 			} else {
-				if _, err = gm.conn.Exec(context.Background(), buf.String(), qid|uint64((qid_counter%255))); err != nil {
+				if _, err = gm.conn.Exec(c.Request.Context(), buf.String(), qid|uint64((qid_counter%255))); err != nil {
 					gmLogger.Errorf("insert taos_slow_sql_detail error, sql:%s, error:%s", buf.String(), err)
-					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insert taos_slow_sql_detail error. %s", err)})
+					recordWriteError(err)
+					c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": fmt.Sprintf("insert taos_slow_sql_detail error. %s", err)})
 					return
 				}
+				recordWrite()
+				gm.aggregateSlowSqls(written)
+				written = written[:0]
 				buf.Reset()
 				buf.WriteString(sql_head)
 				buf.WriteString(sql)
 				qid_counter++
 			}
+			written = append(written, slowSql{info: slowSqlDetailInfo, fingerprint: fingerprint, hash: hash})
 		}
 
 		if buf.Len() > len(sql_head) {
-			if _, err = gm.conn.Exec(context.Background(), buf.String(), qid|uint64((qid_counter%255))); err != nil {
+			if _, err = gm.conn.Exec(c.Request.Context(), buf.String(), qid|uint64((qid_counter%255))); err != nil {
 				gmLogger.Errorf("insert taos_slow_sql_detail error, data:%s, msg:%s", buf.String(), err)
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insert taos_slow_sql_detail error. %s", err)})
+				recordWriteError(err)
+				c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": fmt.Sprintf("insert taos_slow_sql_detail error. %s", err)})
 				return
 			}
+			recordWrite()
+			gm.aggregateSlowSqls(written)
 		}
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
 
-func writeTags(tags []Tag, stbName string, buf *bytes.Buffer) {
-	var nameArray []string
-	if columnSeq, ok := Load(stbName); ok {
-		if len(columnSeq.tagNames) < len(tags) {
-			// add column, only schema change will hit here
-			for _, tag := range tags {
-				if !contains(columnSeq.tagNames, tag.Name) {
-					columnSeq.tagNames = append(columnSeq.tagNames, tag.Name)
-				}
-			}
-			Store(stbName, columnSeq)
-		}
-		nameArray = columnSeq.tagNames
+// slowSql is a slow sql waiting for its insert to be aggregated.
+type slowSql struct {
+	info        SlowSqlDetailInfo
+	fingerprint string
+	hash        string
+}
+
+// aggregateSlowSqls adds written slow sqls to the aggregator.
+func (gm *GeneralMetric) aggregateSlowSqls(written []slowSql) {
+	if gm.slowSqls == nil {
+		return
+	}
+	for _, s := range written {
+		gm.slowSqls.Add(s.info, s.fingerprint, s.hash)
 	}
+}
 
+// writeTags writes tags in order of names, missing tags are written as unknown.
+func writeTags(tags []Tag, nameArray []string, stbName string, namer *SubTableNamer, enc *lineprotocol.Encoder) {
 	// 将 Tag 切片转换为 map
 	tagMap := make(map[string]string)
 	for _, tag := range tags {
@@ -492,13 +812,13 @@ func writeTags(tags []Tag, stbName string, buf *bytes.Buffer) {
 	for _, name := range nameArray {
 		if value, ok := tagMap[name]; ok {
 			if value != "" {
-				buf.WriteString(fmt.Sprintf(",%s=%s", name, util.EscapeInfluxProtocol(value)))
+				enc.AddTag(name, value)
 			} else {
-				buf.WriteString(fmt.Sprintf(",%s=%s", name, "unknown"))
+				enc.AddTag(name, "unknown")
 				gmLogger.Errorf("tag value is empty, tag name:%s", name)
 			}
 		} else {
-			buf.WriteString(fmt.Sprintf(",%s=%s", name, "unknown"))
+			enc.AddTag(name, "unknown")
 		}
 	}
 
@@ -507,121 +827,17 @@ func writeTags(tags []Tag, stbName string, buf *bytes.Buffer) {
 		return
 	}
 
-	subTableName := get_sub_table_name_valid(stbName, tagMap)
+	subTableName := namer.Name(stbName, tagMap)
 	if subTableName != "" {
-		buf.WriteString(fmt.Sprintf(",%s=%s", STABLE_NAME_KEY, subTableName))
+		enc.AddTag(STABLE_NAME_KEY, subTableName)
 	} else {
 		gmLogger.Errorf("get sub stable name error, stable name:%s, tag map:%v", stbName, tagMap)
 	}
 }
 
-func checkKeysExist(data map[string]string, keys ...string) bool {
-	for _, key := range keys {
-		_, ok := data[key]
-		if !ok {
-			return false
-		}
-	}
-	return true
-}
-
+// get_sub_table_name_valid returns name of the child table of stbName with the built-in rules.
 func get_sub_table_name_valid(stbName string, tagMap map[string]string) string {
-	stbName = get_sub_table_name(stbName, tagMap)
-	return util.ToValidTableName(stbName)
-}
-
-func get_sub_table_name(stbName string, tagMap map[string]string) string {
-	if strings.HasPrefix(stbName, "taosx") {
-		switch stbName {
-		case "taosx_sys":
-			if checkKeysExist(tagMap, "taosx_id") {
-				return fmt.Sprintf("sys_%s", tagMap["taosx_id"])
-			}
-		case "taosx_agent":
-			if checkKeysExist(tagMap, "taosx_id", "agent_id") {
-				return fmt.Sprintf("agent_%s_%s", tagMap["taosx_id"], tagMap["agent_id"])
-			}
-		case "taosx_connector":
-			if checkKeysExist(tagMap, "taosx_id", "ds_name", "task_id") {
-				return fmt.Sprintf("connector_%s_%s_%s", tagMap["taosx_id"], tagMap["ds_name"], tagMap["task_id"])
-			}
-		default:
-			if strings.HasPrefix(stbName, "taosx_task_") {
-				ds_name := stbName[len("taosx_task_"):]
-				if checkKeysExist(tagMap, "taosx_id", "task_id") {
-					return fmt.Sprintf("task_%s_%s_%s", tagMap["taosx_id"], ds_name, tagMap["task_id"])
-				}
-			}
-			return ""
-		}
-	}
-
-	switch stbName {
-	case "taosd_cluster_info":
-		if checkKeysExist(tagMap, "cluster_id") {
-			return fmt.Sprintf("cluster_%s", tagMap["cluster_id"])
-		}
-	case "taosd_vgroups_info":
-		if checkKeysExist(tagMap, "cluster_id", "vgroup_id", "database_name") {
-			return fmt.Sprintf("vginfo_%s_vgroup_%s_cluster_%s", tagMap["database_name"], tagMap["vgroup_id"], tagMap["cluster_id"])
-		}
-	case "taosd_dnodes_info":
-		if checkKeysExist(tagMap, "cluster_id", "dnode_id") {
-			return fmt.Sprintf("dinfo_%s_cluster_%s", tagMap["dnode_id"], tagMap["cluster_id"])
-		}
-	case "taosd_dnodes_status":
-		if checkKeysExist(tagMap, "cluster_id", "dnode_id") {
-			return fmt.Sprintf("dstatus_%s_cluster_%s", tagMap["dnode_id"], tagMap["cluster_id"])
-		}
-	case "taosd_dnodes_log_dirs":
-		if checkKeysExist(tagMap, "cluster_id", "dnode_id", "data_dir_name") {
-			subTableName := fmt.Sprintf("dlog_%s_%s_cluster_%s", tagMap["dnode_id"], tagMap["data_dir_name"], tagMap["cluster_id"])
-			if len(subTableName) <= util.MAX_TABLE_NAME_LEN {
-				return subTableName
-			}
-			return fmt.Sprintf("dlog_%s_%s_cluster_%s", tagMap["dnode_id"],
-				util.GetMd5HexStr(tagMap["data_dir_name"]),
-				tagMap["cluster_id"])
-		}
-	case "taosd_dnodes_data_dirs":
-		if checkKeysExist(tagMap, "cluster_id", "dnode_id", "data_dir_name", "data_dir_level") {
-			subTableName := fmt.Sprintf("ddata_%s_%s_level_%s_cluster_%s", tagMap["dnode_id"], tagMap["data_dir_name"], tagMap["data_dir_level"], tagMap["cluster_id"])
-			if len(subTableName) <= util.MAX_TABLE_NAME_LEN {
-				return subTableName
-			}
-			return fmt.Sprintf("ddata_%s_%s_level_%s_cluster_%s", tagMap["dnode_id"],
-				util.GetMd5HexStr(tagMap["data_dir_name"]),
-				tagMap["data_dir_level"],
-				tagMap["cluster_id"])
-		}
-	case "taosd_mnodes_info":
-		if checkKeysExist(tagMap, "cluster_id", "mnode_id") {
-			return fmt.Sprintf("minfo_%s_cluster_%s", tagMap["mnode_id"], tagMap["cluster_id"])
-		}
-	case "taosd_vnodes_info":
-		if checkKeysExist(tagMap, "cluster_id", "database_name", "vgroup_id", "dnode_id") {
-			return fmt.Sprintf("vninfo_%s_dnode_%s_vgroup_%s_cluster_%s", tagMap["database_name"], tagMap["dnode_id"], tagMap["vgroup_id"], tagMap["cluster_id"])
-		}
-	case "taosd_sql_req":
-		if checkKeysExist(tagMap, "username", "sql_type", "result", "dnode_id", "vgroup_id", "cluster_id") {
-			return fmt.Sprintf("taosdsql_%s_%s_%s_%s_vgroup_%s_cluster_%s", tagMap["username"],
-				tagMap["sql_type"], tagMap["result"], tagMap["dnode_id"], tagMap["vgroup_id"], tagMap["cluster_id"])
-		}
-	case "taos_sql_req":
-		if checkKeysExist(tagMap, "username", "sql_type", "result", "cluster_id") {
-			return fmt.Sprintf("taossql_%s_%s_%s_cluster_%s", tagMap["username"],
-				tagMap["sql_type"], tagMap["result"], tagMap["cluster_id"])
-		}
-	case "taos_slow_sql":
-		if checkKeysExist(tagMap, "username", "duration", "result", "cluster_id") {
-			return fmt.Sprintf("slowsql_%s_%s_%s_cluster_%s", tagMap["username"],
-				tagMap["duration"], tagMap["result"], tagMap["cluster_id"])
-		}
-
-	default:
-		return ""
-	}
-	return ""
+	return defaultSubTableNamer.Name(stbName, tagMap)
 }
 
 func contains(array []string, item string) bool {
@@ -633,67 +849,34 @@ func contains(array []string, item string) bool {
 	return false
 }
 
-func writeMetrics(metrics []Metric, stbName string, buf *bytes.Buffer) {
-	var nameArray []string
-	if columnSeq, ok := Load(stbName); ok {
-		if len(columnSeq.metricNames) < len(metrics) {
-			// add column, only schema change will hit here
-			for _, metric := range metrics {
-				if !contains(columnSeq.metricNames, metric.Name) {
-					columnSeq.metricNames = append(columnSeq.metricNames, metric.Name)
-				}
-			}
-			Store(stbName, columnSeq)
-		}
-		nameArray = columnSeq.metricNames
-	}
-
+// writeMetrics writes metrics in order of schema, missing and null metrics are skipped. Values are converted to
+// types of their columns, those can not be converted are skipped.
+func writeMetrics(metrics []Metric, schema *Schema, enc *lineprotocol.Encoder) {
 	// 将 Metric 切片转换为 map
-	metricMap := make(map[string]float64)
+	metricMap := make(map[string]Metric)
 	for _, metric := range metrics {
-		metricMap[metric.Name] = metric.Value
+		metricMap[metric.Name] = metric
 	}
 
-	for i, name := range nameArray {
-		if value, ok := metricMap[name]; ok {
-			buf.WriteString(fmt.Sprintf("%s=%sf64", name, strconv.FormatFloat(value, 'f', -1, 64)))
-			if i != len(nameArray)-1 {
-				buf.WriteString(",")
-			}
+	for _, name := range schema.Metrics {
+		metric, ok := metricMap[name]
+		if !ok || metric.isNull() {
+			continue
 		}
-	}
-}
-
-// 存储数据
-func Store(key string, value ColumnSeq) {
-	mu.Lock()
-	defer mu.Unlock()
-	gColumnSeqMap[key] = value
-}
-
-// 加载数据
-func Load(key string) (ColumnSeq, bool) {
-	mu.RLock()
-	defer mu.RUnlock()
-	value, ok := gColumnSeqMap[key]
-	return value, ok
-}
-
-// 初始化单表的列序列
-func Init(key string) {
-	mu.Lock()
-	defer mu.Unlock()
-	if _, ok := gColumnSeqMap[key]; !ok {
-		columnSeq := ColumnSeq{
-			tagNames:    []string{},
-			metricNames: []string{},
+		value, err := metric.typed()
+		if err == nil && len(schema.Types[name]) > 0 {
+			value, err = value.convert(schema.Types[name])
 		}
-		gColumnSeqMap[key] = columnSeq
+		if err != nil {
+			gmLogger.Errorf("metric %s error, msg:%s", name, err)
+			continue
+		}
+		value.add(enc, name)
 	}
 }
 
-// 初始化所有列序列
-func (gm *GeneralMetric) initColumnSeqMap() error {
+// loadSchemas loads schemas of all stables of taosd, taos and taosX.
+func (gm *GeneralMetric) loadSchemas() error {
 	query := fmt.Sprintf(`
     select stable_name
     from information_schema.ins_stables
@@ -712,39 +895,48 @@ func (gm *GeneralMetric) initColumnSeqMap() error {
 		return err
 	}
 
-	//get all stables, then init gColumnSeqMap
+	stables := make([]string, 0, len(data.Data))
 	for _, row := range data.Data {
-		stableName := row[0].(string)
-		Init(stableName)
+		stables = append(stables, row[0].(string))
+	}
+	if err = gm.schemas.Refresh(context.Background(), stables...); err != nil {
+		return err
 	}
-	//set gColumnSeqMap with desc stables
-	for tableName, columnSeq := range gColumnSeqMap {
-		data, err := gm.conn.Query(context.Background(), fmt.Sprintf(`desc %s.%s;`, gm.database, tableName), util.GetQidOwn())
 
-		if err != nil {
-			return err
-		}
+	gmLogger.Infof("schemas:%v", gm.schemas.Schemas())
+	return nil
+}
 
-		if len(data.Data) < 1 || len(data.Data[0]) < 4 {
-			return fmt.Errorf("desc %s.%s error", gm.database, tableName)
-		}
+// descSchema loads schema of stable with desc.
+func (gm *GeneralMetric) descSchema(ctx context.Context, stable string) (*Schema, error) {
+	if gm.conn == nil {
+		return nil, errNoConnection
+	}
+	data, err := gm.conn.Query(ctx, fmt.Sprintf(`desc %s.%s;`, gm.database, stable), util.GetQidOwn())
+	if err != nil {
+		return nil, err
+	}
 
-		for i, row := range data.Data {
-			if i == 0 {
-				continue
-			}
+	if len(data.Data) < 1 || len(data.Data[0]) < 4 {
+		return nil, fmt.Errorf("desc %s.%s error", gm.database, stable)
+	}
 
-			if row[3].(string) == "TAG" {
-				columnSeq.tagNames = append(columnSeq.tagNames, row[0].(string))
-			} else {
-				columnSeq.metricNames = append(columnSeq.metricNames, row[0].(string))
+	schema := &Schema{Tags: []string{}, Metrics: []string{}, Types: map[string]string{}}
+	for i, row := range data.Data {
+		if i == 0 {
+			continue
+		}
+
+		if row[3].(string) == "TAG" {
+			schema.Tags = append(schema.Tags, row[0].(string))
+		} else {
+			schema.Metrics = append(schema.Metrics, row[0].(string))
+			if typ := columnType(row[1].(string)); len(typ) > 0 {
+				schema.Types[row[0].(string)] = typ
 			}
 		}
-		Store(tableName, columnSeq)
 	}
-
-	gmLogger.Infof("gColumnSeqMap:%v", gColumnSeqMap)
-	return nil
+	return schema, nil
 }
 
 func (gm *GeneralMetric) createSTables() error {
@@ -762,9 +954,34 @@ func (gm *GeneralMetric) createSTables() error {
 
 	createTableSql = "create stable if not exists taos_slow_sql_detail" +
 		" (start_ts TIMESTAMP, request_id BIGINT UNSIGNED PRIMARY KEY, query_time INT, code INT, error_info varchar(128), " +
-		"type TINYINT, rows_num BIGINT, sql varchar(16384), process_name varchar(32), process_id varchar(32)) " +
+		"type TINYINT, rows_num BIGINT, sql varchar(16384), process_name varchar(32), process_id varchar(32), " +
+		"fingerprint_hash varchar(32)) " +
 		"tags (db varchar(1024), `user` varchar(32), ip varchar(32), cluster_id varchar(32))"
 
 	_, err = gm.conn.Exec(context.Background(), createTableSql, util.GetQidOwn())
+	if err != nil {
+		return err
+	}
+	// stables created by older versions have no fingerprint_hash
+	schema, err := gm.descSchema(context.Background(), "taos_slow_sql_detail")
+	if err != nil {
+		return err
+	}
+	hasHash := false
+	for _, name := range schema.Metrics {
+		if name == "fingerprint_hash" {
+			hasHash = true
+			break
+		}
+	}
+	if !hasHash {
+		_, err = gm.conn.Exec(context.Background(),
+			"alter stable taos_slow_sql_detail add column fingerprint_hash varchar(32)", util.GetQidOwn())
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = gm.conn.Exec(context.Background(), CreateSlowSqlFingerprintSql, util.GetQidOwn())
 	return err
 }
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+// limits hit by ingestion requests
+const (
+	LimitBodySize = "body_size"
+	LimitInFlight = "in_flight"
+	LimitClientIP = "client_ip"
+	LimitCluster  = "cluster_id"
+
+	LimitDecompressedSize = "decompressed_size"
+)
+
+// limitsKey is the key of Limits in gin context, handlers check cluster rate limit with it
+const limitsKey = "keeper_limits"
+
+// idle buckets are removed after bucketIdleTimeout
+const bucketIdleTimeout = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket for each key, rate <= 0 disables it.
+type rateLimiter struct {
+	lock      sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*tokenBucket{}, now: time.Now}
+}
+
+// allow takes a token of key, it returns false and the time until next token if there is none.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Limits protects ingestion endpoints with max body size, max in-flight requests and rate limits by client IP
+// and cluster id. Requests over the limits get 413, or 429 with Retry-After.
+type Limits struct {
+	maxBodySize         int64
+	maxDecompressedSize int64
+	inFlight            chan struct{}
+	client              *rateLimiter
+	cluster             *rateLimiter
+
+	lock sync.Mutex
+	hits map[string]uint64
+}
+
+func NewLimits(conf config.LimitConfig) *Limits {
+	l := &Limits{
+		maxBodySize:         conf.MaxBodySize,
+		maxDecompressedSize: conf.MaxDecompressedSize,
+		client:              newRateLimiter(conf.ClientRate, conf.ClientBurst),
+		cluster:             newRateLimiter(conf.ClusterRate, conf.ClusterBurst),
+		hits:                map[string]uint64{},
+	}
+	if conf.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, conf.MaxInFlight)
+	}
+	return l
+}
+
+// Handler limits in-flight requests, client IP rate and body size. The body is read here, so handlers get at
+// most maxBodySize bytes.
+func (l *Limits) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(limitsKey, l)
+		if l.inFlight != nil {
+			select {
+			case l.inFlight <- struct{}{}:
+				defer func() { <-l.inFlight }()
+			default:
+				l.reject(c, LimitInFlight, http.StatusTooManyRequests, time.Second)
+				return
+			}
+		}
+		if ok, wait := l.client.allow(c.ClientIP()); !ok {
+			l.reject(c, LimitClientIP, http.StatusTooManyRequests, wait)
+			return
+		}
+		if l.maxBodySize > 0 {
+			if c.Request.ContentLength > l.maxBodySize {
+				l.reject(c, LimitBodySize, http.StatusRequestEntityTooLarge, 0)
+				return
+			}
+			data, err := io.ReadAll(io.LimitReader(c.Request.Body, l.maxBodySize+1))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("read request body error. %s", err)})
+				return
+			}
+			if int64(len(data)) > l.maxBodySize {
+				l.reject(c, LimitBodySize, http.StatusRequestEntityTooLarge, 0)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		c.Next()
+	}
+}
+
+// allowCluster checks rate limit of clusterID with Limits of the request, it responds 429 and returns false if
+// over the limit.
+func allowCluster(c *gin.Context, clusterID string) bool {
+	v, _ := c.Get(limitsKey)
+	l, ok := v.(*Limits)
+	if !ok || len(clusterID) == 0 {
+		return true
+	}
+	if ok, wait := l.cluster.allow(clusterID); !ok {
+		l.reject(c, LimitCluster, http.StatusTooManyRequests, wait)
+		return false
+	}
+	return true
+}
+
+func (l *Limits) reject(c *gin.Context, limit string, status int, retryAfter time.Duration) {
+	l.lock.Lock()
+	l.hits[limit]++
+	l.lock.Unlock()
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("request over %s limit", limit)})
+}
+
+// Hits returns times each limit was hit.
+func (l *Limits) Hits() map[string]uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	hits := make(map[string]uint64, len(l.hits))
+	for limit, n := range l.hits {
+		hits[limit] = n
+	}
+	return hits
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.allow("a")
+		assert.True(t, ok)
+	}
+	ok, wait := l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	ok, _ = l.allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+
+	now = now.Add(bucketIdleTimeout)
+	l.allow("c")
+	assert.Len(t, l.buckets, 1)
+
+	ok, _ = newRateLimiter(0, 0).allow("a")
+	assert.True(t, ok)
+}
+
+func limitRouter(limits *Limits, handler gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.POST("/report", limits.Handler(), handler)
+	return router
+}
+
+func TestLimitsBodySize(t *testing.T) {
+	limits := NewLimits(config.LimitConfig{MaxBodySize: 4})
+	var body string
+	router := limitRouter(limits, func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		body = string(data)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/report", strings.NewReader("1234")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1234", body)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/report", strings.NewReader("12345")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// unknown length is limited while reading
+	req := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader("12345"))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, uint64(2), limits.Hits()[LimitBodySize])
+}
+
+func TestLimitsInFlight(t *testing.T) {
+	limits := NewLimits(config.LimitConfig{MaxInFlight: 1})
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := limitRouter(limits, func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/report", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/report", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, uint64(1), limits.Hits()[LimitInFlight])
+}
+
+func TestLimitsRate(t *testing.T) {
+	limits := NewLimits(config.LimitConfig{ClientRate: 0.5, ClientBurst: 1, ClusterRate: 0.1, ClusterBurst: 1})
+	router := limitRouter(limits, func(c *gin.Context) {
+		if !allowCluster(c, c.Query("cluster")) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	send := func(remote, cluster string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/report?cluster="+cluster, nil)
+		req.RemoteAddr = remote + ":6041"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1", "c1").Code)
+	w := send("10.0.0.1", "c2")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = send("10.0.0.2", "c1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.3", "c3").Code)
+
+	hits := limits.Hits()
+	assert.Equal(t, uint64(1), hits[LimitClientIP])
+	assert.Equal(t, uint64(1), hits[LimitCluster])
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+// types of metric values, named after their line protocol suffixes
+const (
+	MetricFloat  = "f64"
+	MetricInt    = "i64"
+	MetricUint   = "u64"
+	MetricBool   = "bool"
+	MetricString = "str"
+)
+
+// types of columns narrower than metric types, such as created by others, named after their line protocol suffixes
+const (
+	columnFloat32 = "f32"
+	columnInt32   = "i32"
+	columnInt16   = "i16"
+	columnInt8    = "i8"
+	columnUint32  = "u32"
+	columnUint16  = "u16"
+	columnUint8   = "u8"
+	columnNchar   = "nchar"
+)
+
+// columnKinds maps column types to metric types of the same kind.
+var columnKinds = map[string]string{
+	columnFloat32: MetricFloat,
+	columnInt32:   MetricInt,
+	columnInt16:   MetricInt,
+	columnInt8:    MetricInt,
+	columnUint32:  MetricUint,
+	columnUint16:  MetricUint,
+	columnUint8:   MetricUint,
+	columnNchar:   MetricString,
+}
+
+// MetricValue is the JSON number, bool or string of a metric as received, so that integers over 2^53 are not
+// rounded before the type is known.
+type MetricValue []byte
+
+func (v *MetricValue) UnmarshalJSON(data []byte) error {
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+func (v MetricValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+// jsonType returns type of the JSON value, numbers are float unless hinted and null has no type.
+func (v MetricValue) jsonType() string {
+	switch {
+	case len(v) == 0 || v[0] == 'n':
+		return ""
+	case v[0] == '"':
+		return MetricString
+	case v[0] == 't' || v[0] == 'f':
+		return MetricBool
+	}
+	return MetricFloat
+}
+
+// typedValue is a metric value resolved to one of metric types, column is set when it is written to a narrower
+// column of the type.
+type typedValue struct {
+	typ    string
+	column string
+	f      float64
+	i      int64
+	u      uint64
+	b      bool
+	s      string
+}
+
+// metricType returns type of m, the type hint if set, otherwise the type of its JSON value.
+func metricType(m Metric) string {
+	if len(m.Type) > 0 {
+		return m.Type
+	}
+	return m.Value.jsonType()
+}
+
+// isNull reports whether m has no value.
+func (m Metric) isNull() bool {
+	return len(m.Value) == 0 || bytes.Equal(m.Value, []byte("null"))
+}
+
+// typed resolves value of m to its type.
+func (m Metric) typed() (typedValue, error) {
+	var text string
+	switch m.Value.jsonType() {
+	case MetricString:
+		if err := json.Unmarshal(m.Value, &text); err != nil {
+			return typedValue{}, err
+		}
+	default:
+		text = string(m.Value)
+	}
+	return parseTyped(text, metricType(m))
+}
+
+// parseTyped parses text as a value of typ, integers written as floats are accepted if integral.
+func parseTyped(text string, typ string) (typedValue, error) {
+	v := typedValue{typ: typ}
+	var err error
+	switch typ {
+	case MetricFloat:
+		v.f, err = strconv.ParseFloat(text, 64)
+	case MetricInt:
+		if v.i, err = strconv.ParseInt(text, 10, 64); err != nil {
+			var f float64
+			if f, err = integral(text); err == nil && f >= math.MinInt64 && f < math.MaxInt64 {
+				v.i = int64(f)
+			} else if err == nil {
+				err = fmt.Errorf("%s out of range of %s", text, typ)
+			}
+		}
+	case MetricUint:
+		if v.u, err = strconv.ParseUint(text, 10, 64); err != nil {
+			var f float64
+			if f, err = integral(text); err == nil && f >= 0 && f < math.MaxUint64 {
+				v.u = uint64(f)
+			} else if err == nil {
+				err = fmt.Errorf("%s out of range of %s", text, typ)
+			}
+		}
+	case MetricBool:
+		v.b, err = strconv.ParseBool(text)
+	case MetricString:
+		v.s = text
+	default:
+		return v, fmt.Errorf("unknown metric type %q", typ)
+	}
+	if err != nil {
+		return v, fmt.Errorf("invalid %s value %s: %w", typ, text, err)
+	}
+	return v, nil
+}
+
+func integral(text string) (float64, error) {
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s is not an integer", text)
+	}
+	return f, nil
+}
+
+// text returns v in the form parseTyped reads.
+func (v typedValue) text() string {
+	switch v.typ {
+	case MetricFloat:
+		return strconv.FormatFloat(v.f, 'f', -1, 64)
+	case MetricInt:
+		return strconv.FormatInt(v.i, 10)
+	case MetricUint:
+		return strconv.FormatUint(v.u, 10)
+	case MetricBool:
+		return strconv.FormatBool(v.b)
+	}
+	return v.s
+}
+
+// convert returns v as a value of typ, a metric or column type. Values out of range of the column are rejected.
+func (v typedValue) convert(typ string) (typedValue, error) {
+	kind, ok := columnKinds[typ]
+	if !ok {
+		return v.convertKind(typ)
+	}
+	v, err := v.convertKind(kind)
+	if err != nil {
+		return v, err
+	}
+	switch typ {
+	case columnFloat32:
+		if math.Abs(v.f) > math.MaxFloat32 && !math.IsInf(v.f, 0) {
+			err = fmt.Errorf("%s out of range of %s", v.text(), typ)
+		}
+	case columnInt32, columnInt16, columnInt8:
+		bits, _ := strconv.Atoi(typ[1:])
+		if v.i < -1<<(bits-1) || v.i >= 1<<(bits-1) {
+			err = fmt.Errorf("%s out of range of %s", v.text(), typ)
+		}
+	case columnUint32, columnUint16, columnUint8:
+		bits, _ := strconv.Atoi(typ[1:])
+		if v.u >= 1<<bits {
+			err = fmt.Errorf("%s out of range of %s", v.text(), typ)
+		}
+	}
+	v.column = typ
+	return v, err
+}
+
+// convertKind returns v as a value of metric type typ.
+func (v typedValue) convertKind(typ string) (typedValue, error) {
+	if v.typ == typ {
+		return v, nil
+	}
+	if v.typ == MetricBool && typ != MetricString {
+		// numeric columns store booleans as 0 and 1
+		if v.b {
+			return parseTyped("1", typ)
+		}
+		return parseTyped("0", typ)
+	}
+	return parseTyped(v.text(), typ)
+}
+
+// add adds v as field key.
+func (v typedValue) add(enc *lineprotocol.Encoder, key string) {
+	switch v.column {
+	case columnFloat32:
+		enc.AddFloat32(key, v.f)
+		return
+	case columnInt32, columnInt16, columnInt8:
+		bits, _ := strconv.Atoi(v.column[1:])
+		enc.AddIntN(key, v.i, bits)
+		return
+	case columnUint32, columnUint16, columnUint8:
+		bits, _ := strconv.Atoi(v.column[1:])
+		enc.AddUintN(key, v.u, bits)
+		return
+	case columnNchar:
+		enc.AddNchar(key, v.s)
+		return
+	}
+	switch v.typ {
+	case MetricFloat:
+		enc.AddFloat(key, v.f)
+	case MetricInt:
+		enc.AddInt(key, v.i)
+	case MetricUint:
+		enc.AddUint(key, v.u)
+	case MetricBool:
+		enc.AddBool(key, v.b)
+	case MetricString:
+		enc.AddString(key, v.s)
+	}
+}
+
+// columnType returns metric or column type of a TDengine column type, empty for types not written by metrics.
+// Columns of narrower types, such as created by others, are written with their exact line protocol suffixes.
+func columnType(dataType string) string {
+	switch dataType {
+	case "DOUBLE":
+		return MetricFloat
+	case "FLOAT":
+		return columnFloat32
+	case "BIGINT":
+		return MetricInt
+	case "INT":
+		return columnInt32
+	case "SMALLINT":
+		return columnInt16
+	case "TINYINT":
+		return columnInt8
+	case "BIGINT UNSIGNED":
+		return MetricUint
+	case "INT UNSIGNED":
+		return columnUint32
+	case "SMALLINT UNSIGNED":
+		return columnUint16
+	case "TINYINT UNSIGNED":
+		return columnUint8
+	case "BOOL":
+		return MetricBool
+	case "VARCHAR", "BINARY":
+		return MetricString
+	case "NCHAR":
+		return columnNchar
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+func TestMetricTyped(t *testing.T) {
+	var metrics []Metric
+	assert.NoError(t, json.Unmarshal([]byte(`[
+		{"name":"uptime","value":12.5},
+		{"name":"rows","value":18446744073709551615,"type":"u64"},
+		{"name":"offset","value":"-9007199254740993","type":"i64"},
+		{"name":"running","value":true},
+		{"name":"status","value":"running"},
+		{"name":"flag","value":1,"type":"bool"},
+		{"name":"empty","value":null}
+	]`), &metrics))
+
+	expected := []typedValue{
+		{typ: MetricFloat, f: 12.5},
+		{typ: MetricUint, u: math.MaxUint64},
+		{typ: MetricInt, i: -9007199254740993},
+		{typ: MetricBool, b: true},
+		{typ: MetricString, s: "running"},
+		{typ: MetricBool, b: true},
+	}
+	for i, want := range expected {
+		value, err := metrics[i].typed()
+		assert.NoError(t, err, metrics[i].Name)
+		assert.Equal(t, want, value, metrics[i].Name)
+	}
+	assert.True(t, metrics[6].isNull())
+
+	for _, m := range []Metric{
+		{Name: "a", Value: MetricValue("1.5"), Type: MetricInt},
+		{Name: "b", Value: MetricValue("-1"), Type: MetricUint},
+		{Name: "c", Value: MetricValue(`"x"`), Type: MetricFloat},
+		{Name: "d", Value: MetricValue("1"), Type: "decimal"},
+	} {
+		_, err := m.typed()
+		assert.Error(t, err, m.Name)
+	}
+
+	data, err := json.Marshal(metrics[1])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"rows","value":18446744073709551615,"type":"u64"}`, string(data))
+}
+
+func TestTypedValueConvert(t *testing.T) {
+	v, err := typedValue{typ: MetricInt, i: 3}.convert(MetricFloat)
+	assert.NoError(t, err)
+	assert.Equal(t, typedValue{typ: MetricFloat, f: 3}, v)
+	v, err = typedValue{typ: MetricFloat, f: 3}.convert(MetricInt)
+	assert.NoError(t, err)
+	assert.Equal(t, typedValue{typ: MetricInt, i: 3}, v)
+	v, err = typedValue{typ: MetricBool, b: true}.convert(MetricFloat)
+	assert.NoError(t, err)
+	assert.Equal(t, typedValue{typ: MetricFloat, f: 1}, v)
+	v, err = typedValue{typ: MetricUint, u: 7}.convert(MetricString)
+	assert.NoError(t, err)
+	assert.Equal(t, typedValue{typ: MetricString, s: "7"}, v)
+	_, err = typedValue{typ: MetricString, s: "running"}.convert(MetricFloat)
+	assert.Error(t, err)
+}
+
+func TestWriteTypedMetrics(t *testing.T) {
+	r := NewSchemaRegistry(nil)
+	// columns created by float-only clients stay double
+	r.Ensure("taosx_task_kafka", nil, []Metric{{Name: "total", Value: MetricValue("1")}})
+	metrics := []Metric{
+		{Name: "total", Value: MetricValue("3"), Type: MetricInt},
+		{Name: "rows", Value: MetricValue("18446744073709551615"), Type: MetricUint},
+		{Name: "status", Value: MetricValue(`"running"`)},
+		{Name: "paused", Value: MetricValue("false")},
+		{Name: "empty", Value: MetricValue("null")},
+	}
+	schema, changed := r.Ensure("taosx_task_kafka", nil, metrics)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]string{"total": MetricFloat, "rows": MetricUint, "status": MetricString,
+		"paused": MetricBool}, schema.Types)
+
+	var buf bytes.Buffer
+	enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
+	enc.StartLine("taosx_task_kafka")
+	writeMetrics(metrics, schema, enc)
+	assert.NoError(t, enc.EndLine(time.UnixMilli(1)))
+	assert.Equal(t, `taosx_task_kafka total=3f64,rows=18446744073709551615u64,status="running",paused=false 1`+"\n",
+		buf.String())
+
+	// values not convertible to their columns are skipped
+	buf.Reset()
+	enc.StartLine("taosx_task_kafka")
+	writeMetrics([]Metric{{Name: "total", Value: MetricValue(`"idle"`)}, {Name: "paused", Value: MetricValue("1")}},
+		schema, enc)
+	assert.NoError(t, enc.EndLine(time.UnixMilli(1)))
+	assert.Equal(t, "taosx_task_kafka paused=true 1\n", buf.String())
+}
+
+func TestWriteColumnTypes(t *testing.T) {
+	for dataType, line := range map[string]string{
+		"DOUBLE":            "m v=1f64 1\n",
+		"FLOAT":             "m v=1f32 1\n",
+		"BIGINT":            "m v=1i64 1\n",
+		"INT":               "m v=1i32 1\n",
+		"SMALLINT":          "m v=1i16 1\n",
+		"TINYINT":           "m v=1i8 1\n",
+		"BIGINT UNSIGNED":   "m v=1u64 1\n",
+		"INT UNSIGNED":      "m v=1u32 1\n",
+		"SMALLINT UNSIGNED": "m v=1u16 1\n",
+		"TINYINT UNSIGNED":  "m v=1u8 1\n",
+		"BOOL":              "m v=true 1\n",
+		"VARCHAR":           `m v="1" 1` + "\n",
+		"BINARY":            `m v="1" 1` + "\n",
+		"NCHAR":             `m v=L"1" 1` + "\n",
+		"TIMESTAMP":         "m v=1f64 1\n",
+	} {
+		schema := &Schema{Metrics: []string{"v"}, Types: map[string]string{}}
+		if typ := columnType(dataType); len(typ) > 0 {
+			schema.Types["v"] = typ
+		}
+		var buf bytes.Buffer
+		enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
+		enc.StartLine("m")
+		writeMetrics([]Metric{{Name: "v", Value: MetricValue("1")}}, schema, enc)
+		assert.NoError(t, enc.EndLine(time.UnixMilli(1)), dataType)
+		assert.Equal(t, line, buf.String(), dataType)
+	}
+
+	// values out of range of narrower columns are skipped
+	schema := &Schema{Metrics: []string{"i8", "u16", "f32", "v"},
+		Types: map[string]string{"i8": columnType("TINYINT"), "u16": columnType("SMALLINT UNSIGNED"),
+			"f32": columnType("FLOAT")}}
+	var buf bytes.Buffer
+	enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
+	enc.StartLine("m")
+	writeMetrics([]Metric{{Name: "i8", Value: MetricValue("128")}, {Name: "u16", Value: MetricValue("65536")},
+		{Name: "f32", Value: MetricValue("1e300")}, {Name: "v", Value: MetricValue("1")}}, schema, enc)
+	assert.NoError(t, enc.EndLine(time.UnixMilli(1)))
+	assert.Equal(t, "m v=1f64 1\n", buf.String())
+}
@@ -10,17 +10,25 @@ import (
 )
 
 type NodeExporter struct {
-	processor *process.Processor
+	processor  *process.Processor
+	collectors []prometheus.Collector
 }
 
-func NewNodeExporter(processor *process.Processor) *NodeExporter {
-	return &NodeExporter{processor: processor}
+// NewNodeExporter exports metrics of processor and other keeper collectors on /metrics
+func NewNodeExporter(processor *process.Processor, collectors ...prometheus.Collector) *NodeExporter {
+	return &NodeExporter{processor: processor, collectors: collectors}
 }
 
 func (z *NodeExporter) Init(c gin.IRouter) {
+	c.GET("metrics", z.Handler())
+}
+
+// Handler returns the handler of /metrics, it registers collectors and must be called only once.
+func (z *NodeExporter) Handler() gin.HandlerFunc {
 	reg := prometheus.NewPedanticRegistry()
 	reg.MustRegister(z.processor)
-	c.GET("metrics", z.myMiddleware(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	reg.MustRegister(z.collectors...)
+	return z.myMiddleware(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 }
 
 func (z *NodeExporter) myMiddleware(next http.Handler) gin.HandlerFunc {
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+// redaction actions, counted by Redactor
+const (
+	RedactionMasked  = "masked"
+	RedactionRule    = "rule"
+	RedactionDropped = "dropped"
+)
+
+// RedactionActions are all actions of Redactor.
+var RedactionActions = []string{RedactionMasked, RedactionRule, RedactionDropped}
+
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Redactor removes sensitive data from slow queries before they are stored.
+type Redactor struct {
+	maskLiterals bool
+	dropUsers    map[string]bool
+	dropDbs      map[string]bool
+	rules        []redactionRule
+
+	lock   sync.Mutex
+	counts map[string]uint64
+}
+
+func NewRedactor(conf config.RedactionConfig) (*Redactor, error) {
+	r := &Redactor{
+		maskLiterals: conf.MaskLiterals,
+		dropUsers:    map[string]bool{},
+		dropDbs:      map[string]bool{},
+		counts:       map[string]uint64{},
+	}
+	for _, user := range conf.DropUsers {
+		r.dropUsers[user] = true
+	}
+	for _, db := range conf.DropDbs {
+		r.dropDbs[db] = true
+	}
+	for i, rule := range conf.Rule {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+		}
+		r.rules = append(r.rules, redactionRule{pattern: pattern, replacement: rule.Replacement})
+	}
+	return r, nil
+}
+
+// Redact returns sql of info to store, keep is false if the query should not be stored.
+func (r *Redactor) Redact(info SlowSqlDetailInfo) (sql string, keep bool) {
+	if r.dropUsers[info.User] || r.dropDbs[info.Db] {
+		r.count(RedactionDropped)
+		return "", false
+	}
+	sql = info.Sql
+	if r.maskLiterals {
+		if masked := MaskLiterals(sql); masked != sql {
+			sql = masked
+			r.count(RedactionMasked)
+		}
+	}
+	changed := false
+	for _, rule := range r.rules {
+		if redacted := rule.pattern.ReplaceAllString(sql, rule.replacement); redacted != sql {
+			sql, changed = redacted, true
+		}
+	}
+	if changed {
+		r.count(RedactionRule)
+	}
+	return sql, true
+}
+
+func (r *Redactor) count(action string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.counts[action]++
+}
+
+// Counts returns count of redacted queries by action.
+func (r *Redactor) Counts() map[string]uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	counts := make(map[string]uint64, len(r.counts))
+	for action, n := range r.counts {
+		counts[action] = n
+	}
+	return counts
+}
+
+// MaskLiterals replaces string and numeric literals of sql with ?, the rest of sql is kept as is.
+func MaskLiterals(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for _, token := range lexSql(sql) {
+		switch token.kind {
+		case tokenString, tokenNumber:
+			b.WriteByte('?')
+		default:
+			b.WriteString(token.text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestMaskLiterals(t *testing.T) {
+	for sql, want := range map[string]string{
+		"SELECT * FROM meters WHERE location = 'beijing' AND ts > 1703226836762": "SELECT * FROM meters WHERE location = ? AND ts > ?",
+		`insert into d1001 values (now, 10.3, 'it''s', "a\"b")`:                  "insert into d1001 values (now, ?, ?, ?)",
+		"select `col1`, c2 from t1 where v in (1, 2) interval(10s) -- 'note'":    "select `col1`, c2 from t1 where v in (?, ?) interval(?) -- 'note'",
+		"create user u1 pass 'secret":                                            "create user u1 pass ?",
+		"show databases":                                                         "show databases",
+	} {
+		assert.Equal(t, want, MaskLiterals(sql), sql)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor(config.RedactionConfig{
+		DropUsers: []string{"audit"},
+		DropDbs:   []string{"secrets"},
+		Rule: []config.RedactionRule{
+			{Pattern: `(?i)(pass\s+)'[^']*'`, Replacement: "${1}'***'"},
+			{Pattern: `\b\d{3}-\d{4}\b`, Replacement: "xxx-xxxx"},
+		},
+	})
+	assert.NoError(t, err)
+
+	sql, keep := r.Redact(SlowSqlDetailInfo{User: "root", Db: "db", Sql: "alter user u1 PASS 'secret'"})
+	assert.True(t, keep)
+	assert.Equal(t, "alter user u1 PASS '***'", sql)
+	sql, keep = r.Redact(SlowSqlDetailInfo{User: "root", Db: "db", Sql: "select * from t where phone = '555-1234'"})
+	assert.True(t, keep)
+	assert.Equal(t, "select * from t where phone = 'xxx-xxxx'", sql)
+	sql, keep = r.Redact(SlowSqlDetailInfo{User: "root", Db: "db", Sql: "select 1"})
+	assert.True(t, keep)
+	assert.Equal(t, "select 1", sql)
+
+	_, keep = r.Redact(SlowSqlDetailInfo{User: "audit", Db: "db", Sql: "select 1"})
+	assert.False(t, keep)
+	_, keep = r.Redact(SlowSqlDetailInfo{User: "root", Db: "secrets", Sql: "select 1"})
+	assert.False(t, keep)
+	assert.Equal(t, map[string]uint64{RedactionRule: 2, RedactionDropped: 2}, r.Counts())
+
+	masking, err := NewRedactor(config.RedactionConfig{MaskLiterals: true,
+		Rule: []config.RedactionRule{{Pattern: `token_\w+`, Replacement: "token"}}})
+	assert.NoError(t, err)
+	sql, _ = masking.Redact(SlowSqlDetailInfo{Sql: "select token_abc from t where id = 'a'"})
+	assert.Equal(t, "select token from t where id = ?", sql)
+	assert.Equal(t, map[string]uint64{RedactionMasked: 1, RedactionRule: 1}, masking.Counts())
+
+	_, err = NewRedactor(config.RedactionConfig{Rule: []config.RedactionRule{{Pattern: "("}}})
+	assert.Error(t, err)
+}
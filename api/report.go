@@ -3,10 +3,14 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -15,6 +19,7 @@ import (
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
 )
 
 var logger = log.GetLogger("REP")
@@ -42,7 +47,9 @@ type Reporter struct {
 	usessl          bool
 	dbname          string
 	databaseOptions map[string]interface{}
-	totalRep        atomic.Value
+	// precision of the metrics database, timestamps of reports are truncated to it
+	precision lineprotocol.Precision
+	totalRep  atomic.Value
 }
 
 func NewReporter(conf *config.Config) *Reporter {
@@ -54,15 +61,27 @@ func NewReporter(conf *config.Config) *Reporter {
 		usessl:          conf.TDengine.Usessl,
 		dbname:          conf.Metrics.Database.Name,
 		databaseOptions: conf.Metrics.Database.Options,
+		precision:       mustDatabasePrecision(conf),
 	}
 	r.totalRep.Store(0)
 	return r
 }
 
 func (r *Reporter) Init(c gin.IRouter) {
+	r.Register(c)
+	r.Prepare()
+}
+
+// Register registers routes of reporter.
+func (r *Reporter) Register(c gin.IRouter) {
 	c.POST("report", r.handlerFunc())
+}
+
+// Prepare creates database and tables, it panics on error.
+func (r *Reporter) Prepare() {
 	r.createDatabase()
 	r.creatTables()
+	r.detectKeeperMonitorFields()
 	// todo: it can delete in the future.
 	if r.shouldDetectFields() {
 		r.detectGrantInfoFieldType()
@@ -73,7 +92,7 @@ func (r *Reporter) Init(c gin.IRouter) {
 
 func (r *Reporter) getConn() *db.Connector {
 
-	conn, err := db.NewConnector(r.username, r.password, r.host, r.port, r.usessl)
+	conn, err := db.DefaultManager.Get(r.username, r.password, r.host, r.port, "", r.usessl)
 	if err != nil {
 		qid := util.GetQidOwn()
 
@@ -90,7 +109,6 @@ func (r *Reporter) detectGrantInfoFieldType() {
 	// `expire_time` `timeseries_used` `timeseries_total` in table `grant_info` changed to bigint from TS-3003.
 	ctx := context.Background()
 	conn := r.getConn()
-	defer r.closeConn(conn)
 
 	r.detectFieldType(ctx, conn, "grants_info", "expire_time", "bigint")
 	r.detectFieldType(ctx, conn, "grants_info", "timeseries_used", "bigint")
@@ -107,7 +125,6 @@ func (r *Reporter) detectClusterInfoFieldType() {
 	// `tbs_total` in table `cluster_info` changed to bigint from TS-3003.
 	ctx := context.Background()
 	conn := r.getConn()
-	defer r.closeConn(conn)
 
 	r.detectFieldType(ctx, conn, "cluster_info", "tbs_total", "bigint")
 
@@ -126,11 +143,27 @@ func (r *Reporter) detectVgroupsInfoType() {
 	// `tables_num` in table `vgroups_info` changed to bigint from TS-3003.
 	ctx := context.Background()
 	conn := r.getConn()
-	defer r.closeConn(conn)
 
 	r.detectFieldType(ctx, conn, "vgroups_info", "tables_num", "bigint")
 }
 
+func (r *Reporter) detectKeeperMonitorFields() {
+	// columns of self telemetry added to `keeper_monitor` after it was created by older versions.
+	ctx := context.Background()
+	conn, err := db.DefaultManager.Get(r.username, r.password, r.host, r.port, r.dbname, r.usessl)
+	if err != nil {
+		logger.Errorf("connect to database error, msg:%s", err)
+		return
+	}
+
+	for _, column := range KeeperMonitorColumns {
+		if exists, _ := r.columnInfo(ctx, conn, "keeper_monitor", column[0]); !exists {
+			logger.Warningf("## %s.keeper_monitor.%s not exists, will add it", r.dbname, column[0])
+			r.addColumn(ctx, conn, "keeper_monitor", column[0], column[1])
+		}
+	}
+}
+
 func (r *Reporter) detectFieldType(ctx context.Context, conn *db.Connector, table, field, fieldType string) {
 	_, colType := r.columnInfo(ctx, conn, table, field)
 	if colType == "INT" {
@@ -146,7 +179,6 @@ func (r *Reporter) detectFieldType(ctx context.Context, conn *db.Connector, tabl
 func (r *Reporter) shouldDetectFields() bool {
 	ctx := context.Background()
 	conn := r.getConn()
-	defer r.closeConn(conn)
 
 	version, err := r.serverVersion(ctx, conn)
 	if err != nil {
@@ -261,7 +293,6 @@ func (r *Reporter) addColumn(ctx context.Context, conn *db.Connector, table stri
 func (r *Reporter) createDatabase() {
 	ctx := context.Background()
 	conn := r.getConn()
-	defer r.closeConn(conn)
 
 	createDBSql := r.generateCreateDBSql()
 	logger.Warningf("create database sql: %s", createDBSql)
@@ -293,12 +324,11 @@ func (r *Reporter) generateCreateDBSql() string {
 
 func (r *Reporter) creatTables() {
 	ctx := context.Background()
-	conn, err := db.NewConnectorWithDb(r.username, r.password, r.host, r.port, r.dbname, r.usessl)
+	conn, err := db.DefaultManager.Get(r.username, r.password, r.host, r.port, r.dbname, r.usessl)
 	if err != nil {
 		logger.Errorf("connect to database error, msg:%s", err)
 		return
 	}
-	defer r.closeConn(conn)
 
 	for _, createSql := range createList {
 		logger.Infof("execute sql:%s", createSql)
@@ -308,12 +338,6 @@ func (r *Reporter) creatTables() {
 	}
 }
 
-func (r *Reporter) closeConn(conn *db.Connector) {
-	if err := conn.Close(); err != nil {
-		logger.Errorf("close connection error, msg:%s", err)
-	}
-}
-
 func (r *Reporter) handlerFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		qid := util.GetQid(c.GetHeader("X-QID"))
@@ -333,38 +357,85 @@ func (r *Reporter) handlerFunc() gin.HandlerFunc {
 
 		logger.Tracef("report data:%s", string(data))
 		if e := json.Unmarshal(data, &report); e != nil {
-			logger.Errorf("error occurred while unmarshal request, data:%s, error:%s", data, err)
+			logger.Errorf("error occurred while unmarshal request, data:%s, error:%s", data, e)
+			rejected(c, data, qid, e.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse report data error: %s", e)})
 			return
 		}
-		var sqls []string
-		if report.ClusterInfo != nil {
-			sqls = append(sqls, insertClusterInfoSql(*report.ClusterInfo, report.ClusterID, report.Protocol, report.Ts)...)
+		if !allowCluster(c, report.ClusterID) {
+			return
 		}
-		sqls = append(sqls, insertDnodeSql(report.DnodeInfo, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts))
-		if report.GrantInfo != nil {
-			sqls = append(sqls, insertGrantSql(*report.GrantInfo, report.DnodeID, report.ClusterID, report.Ts))
+		if !validate(c, data, qid, []record{{
+			stable: "dnodes_info",
+			tags: map[string]string{"cluster_id": report.ClusterID, "dnode_id": strconv.Itoa(report.DnodeID),
+				"dnode_ep": report.DnodeEp},
+			ts: report.Ts,
+		}}) {
+			return
 		}
-		sqls = append(sqls, insertDataDirSql(report.DiskInfos, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts)...)
-		for _, group := range report.VgroupInfos {
-			sqls = append(sqls, insertVgroupSql(group, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts)...)
+		ts, err := checkTimestamp(c, report.DnodeEp, report.Ts)
+		if err != nil {
+			logger.Errorf("invalid report ts, msg:%s", err)
+			rejected(c, data, qid, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		sqls = append(sqls, insertLogSummary(report.LogInfos, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts))
+		report.Ts = truncate(ts, r.precision).Format(time.RFC3339Nano)
+		rows := reportRows(report)
 
-		conn, err := db.NewConnectorWithDb(r.username, r.password, r.host, r.port, r.dbname, r.usessl)
+		conn, err := db.DefaultManager.Get(r.username, r.password, r.host, r.port, r.dbname, r.usessl)
 		if err != nil {
 			logger.Errorf("connect to database error, msg:%s", err)
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			return
 		}
-		defer r.closeConn(conn)
-		ctx := context.Background()
-
-		for _, sql := range sqls {
-			logger.Tracef("execute sql:%s", sql)
-			if _, err := conn.Exec(ctx, sql, util.GetQidOwn()); err != nil {
-				logger.Errorf("execute sql error, sql:%s, error:%s", sql, err)
+		// tables are written on their own, a failed one does not stop the others
+		if _, err := conn.Insert(c.Request.Context(), rows, util.GetQidOwn()); err != nil {
+			logger.Errorf("insert report error, rows:%d, error:%s", len(rows), err)
+			recordWriteError(err)
+			// the report is accepted if some tables are written, failed ones are listed in the body
+			var insertErr *db.InsertError
+			if errors.As(err, &insertErr) && insertErr.Partial() {
+				c.JSON(http.StatusOK, gin.H{"failed_tables": failedTables(insertErr)})
+				return
 			}
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
 		}
+		recordWrite()
+	}
+}
+
+// failedTables returns sorted names of tables failed by err with their errors.
+func failedTables(err *db.InsertError) []gin.H {
+	tables := make([]string, 0, len(err.Failed))
+	for table := range err.Failed {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	failed := make([]gin.H, 0, len(tables))
+	for _, table := range tables {
+		failed = append(failed, gin.H{"table": table, "error": err.Failed[table].Error()})
+	}
+	return failed
+}
+
+// reportRows returns rows of all tables written by a report.
+func reportRows(report Report) []db.Row {
+	var rows []db.Row
+	if report.ClusterInfo != nil {
+		rows = append(rows, insertClusterInfoRows(*report.ClusterInfo, report.ClusterID, report.Protocol, report.Ts)...)
+	}
+	rows = append(rows, insertDnodeRow(report.DnodeInfo, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts))
+	if report.GrantInfo != nil {
+		rows = append(rows, insertGrantRow(*report.GrantInfo, report.DnodeID, report.ClusterID, report.Ts))
+	}
+	rows = append(rows, insertDataDirRows(report.DiskInfos, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts)...)
+	for _, group := range report.VgroupInfos {
+		rows = append(rows, insertVgroupRows(group, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts)...)
 	}
+	rows = append(rows, insertLogSummaryRow(report.LogInfos, report.DnodeID, report.DnodeEp, report.ClusterID, report.Ts))
+	return rows
 }
 
 func (r *Reporter) recordTotalRep() {
@@ -378,102 +449,201 @@ func (r *Reporter) GetTotalRep() *atomic.Value {
 	return &r.totalRep
 }
 
-func insertClusterInfoSql(info ClusterInfo, ClusterID string, protocol int, ts string) []string {
-	var sqls []string
-	var dtotal, dalive, mtotal, malive int
+// dnodeTags are tags of tables of a dnode
+type dnodeTags struct {
+	DnodeID   int    `taos:"dnode_id"`
+	DnodeEp   string `taos:"dnode_ep"`
+	ClusterID string `taos:"cluster_id"`
+}
+
+type clusterTags struct {
+	ClusterID string `taos:"cluster_id"`
+}
+
+type dnodeStatusColumns struct {
+	Status string `taos:"status"`
+}
+
+type mnodeRoleColumns struct {
+	Role string `taos:"role"`
+}
+
+type clusterInfoColumns struct {
+	ClusterInfo
+	DnodesTotal int `taos:"dnodes_total"`
+	DnodesAlive int `taos:"dnodes_alive"`
+	MnodesTotal int `taos:"mnodes_total"`
+	MnodesAlive int `taos:"mnodes_alive"`
+	Protocol    int `taos:"protocol"`
+}
+
+type dirColumns struct {
+	Name  string `taos:"name"`
+	Avail int64  `taos:"avail"`
+	Used  int64  `taos:"used"`
+	Total int64  `taos:"total"`
+}
+
+type dataDirColumns struct {
+	dirColumns
+	Level int `taos:"level"`
+}
+
+type vnodeRoleColumns struct {
+	VnodeRole string `taos:"vnode_role"`
+}
+
+type logSummaryColumns struct {
+	Error int `taos:"error"`
+	Info  int `taos:"info"`
+	Debug int `taos:"debug"`
+	Trace int `taos:"trace"`
+}
+
+func insertClusterInfoRows(info ClusterInfo, ClusterID string, protocol int, ts string) []db.Row {
+	var rows []db.Row
+	columns := &clusterInfoColumns{ClusterInfo: info, Protocol: protocol}
 	for _, dnode := range info.Dnodes {
-		sqls = append(sqls, fmt.Sprintf("insert into d_info_%s using d_info tags (%d, '%s', '%s') values ('%s', '%s')",
-			ClusterID+strconv.Itoa(dnode.DnodeID), dnode.DnodeID, dnode.DnodeEp, ClusterID, ts, dnode.Status))
-		dtotal++
+		rows = append(rows, db.Row{
+			STable:  "d_info",
+			Table:   "d_info_" + ClusterID + strconv.Itoa(dnode.DnodeID),
+			Tags:    dnodeTags{DnodeID: dnode.DnodeID, DnodeEp: dnode.DnodeEp, ClusterID: ClusterID},
+			Ts:      ts,
+			Columns: dnodeStatusColumns{Status: dnode.Status},
+		})
+		columns.DnodesTotal++
 		if "ready" == dnode.Status {
-			dalive++
+			columns.DnodesAlive++
 		}
 	}
 
 	for _, mnode := range info.Mnodes {
-		sqls = append(sqls, fmt.Sprintf("insert into m_info_%s using m_info tags (%d, '%s', '%s') values ('%s', '%s')",
-			ClusterID+strconv.Itoa(mnode.MnodeID), mnode.MnodeID, mnode.MnodeEp, ClusterID, ts, mnode.Role))
-		mtotal++
+		rows = append(rows, db.Row{
+			STable: "m_info",
+			Table:  "m_info_" + ClusterID + strconv.Itoa(mnode.MnodeID),
+			Tags: struct {
+				MnodeID   int    `taos:"mnode_id"`
+				MnodeEp   string `taos:"mnode_ep"`
+				ClusterID string `taos:"cluster_id"`
+			}{mnode.MnodeID, mnode.MnodeEp, ClusterID},
+			Ts:      ts,
+			Columns: mnodeRoleColumns{Role: mnode.Role},
+		})
+		columns.MnodesTotal++
 		//LEADER FOLLOWER CANDIDATE ERROR
 		if "ERROR" != mnode.Role {
-			malive++
+			columns.MnodesAlive++
 		}
 	}
 
-	sqls = append(sqls, fmt.Sprintf(
-		"insert into cluster_info_%s using cluster_info tags('%s') (ts, first_ep, first_ep_dnode_id, version, "+
-			"master_uptime, monitor_interval, dbs_total, tbs_total, stbs_total, dnodes_total, dnodes_alive, "+
-			"mnodes_total, mnodes_alive, vgroups_total, vgroups_alive, vnodes_total, vnodes_alive, connections_total, "+
-			"topics_total, streams_total, protocol) values ('%s', '%s', %d, '%s', %f, %d, %d, %d, %d, %d, %d, %d, %d, "+
-			"%d, %d, %d, %d, %d, %d, %d, %d)",
-		ClusterID, ClusterID, ts, info.FirstEp, info.FirstEpDnodeID, info.Version, info.MasterUptime, info.MonitorInterval,
-		info.DbsTotal, info.TbsTotal, info.StbsTotal, dtotal, dalive, mtotal, malive, info.VgroupsTotal, info.VgroupsAlive,
-		info.VnodesTotal, info.VnodesAlive, info.ConnectionsTotal, info.TopicsTotal, info.StreamsTotal, protocol))
-	return sqls
+	rows = append(rows, db.Row{
+		STable:  "cluster_info",
+		Table:   "cluster_info_" + ClusterID,
+		Tags:    clusterTags{ClusterID: ClusterID},
+		Ts:      ts,
+		Columns: columns,
+	})
+	return rows
 }
 
-func insertDnodeSql(info DnodeInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) string {
-	return fmt.Sprintf("insert into dnode_info_%s using dnodes_info tags (%d, '%s', '%s') values ('%s', %f, %f, %f, %f, %d, %d, %d, %d, %d, %d, %f, %f, %f, %f, %f, %f, %d, %f, %d, %d, %f, %d, %d, %f, %d, %d, %d, %d, %d, %d, %d)",
-		ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID,
-		ts, info.Uptime, info.CPUEngine, info.CPUSystem, info.CPUCores, info.MemEngine, info.MemSystem, info.MemTotal,
-		info.DiskEngine, info.DiskUsed, info.DiskTotal, info.NetIn, info.NetOut, info.IoRead, info.IoWrite,
-		info.IoReadDisk, info.IoWriteDisk, info.ReqSelect, info.ReqSelectRate, info.ReqInsert, info.ReqInsertSuccess,
-		info.ReqInsertRate, info.ReqInsertBatch, info.ReqInsertBatchSuccess, info.ReqInsertBatchRate, info.Errors,
-		info.VnodesNum, info.Masters, info.HasMnode, info.HasQnode, info.HasSnode, info.HasBnode)
+func insertDnodeRow(info DnodeInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) db.Row {
+	return db.Row{
+		STable:  "dnodes_info",
+		Table:   "dnode_info_" + ClusterID + strconv.Itoa(DnodeID),
+		Tags:    dnodeTags{DnodeID: DnodeID, DnodeEp: DnodeEp, ClusterID: ClusterID},
+		Ts:      ts,
+		Columns: info,
+	}
 }
 
-func insertDataDirSql(disk DiskInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) []string {
-	var sqls []string
+func insertDataDirRows(disk DiskInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) []db.Row {
+	var rows []db.Row
+	table := ClusterID + strconv.Itoa(DnodeID)
+	tags := dnodeTags{DnodeID: DnodeID, DnodeEp: DnodeEp, ClusterID: ClusterID}
 	for _, data := range disk.Datadir {
-		sqls = append(sqls,
-			fmt.Sprintf("insert into data_dir_%s using data_dir tags (%d, '%s', '%s') values ('%s', '%s', %d, %d, %d, %d)",
-				ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID,
-				ts, data.Name, data.Level, data.Avail.IntPart(), data.Used.IntPart(), data.Total.IntPart()),
-		)
-	}
-	sqls = append(sqls,
-		fmt.Sprintf("insert into log_dir_%s using log_dir tags (%d, '%s', '%s') values ('%s', '%s', %d, %d, %d)",
-			ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID,
-			ts, disk.Logdir.Name, disk.Logdir.Avail.IntPart(), disk.Logdir.Used.IntPart(), disk.Logdir.Total.IntPart()),
-		fmt.Sprintf("insert into temp_dir_%s using temp_dir tags (%d, '%s', '%s') values ('%s', '%s', %d, %d, %d)",
-			ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID,
-			ts, disk.Tempdir.Name, disk.Tempdir.Avail.IntPart(), disk.Tempdir.Used.IntPart(), disk.Tempdir.Total.IntPart()),
+		rows = append(rows, db.Row{
+			STable: "data_dir",
+			Table:  "data_dir_" + table,
+			Tags:   tags,
+			Ts:     ts,
+			Columns: dataDirColumns{
+				dirColumns: dirColumns{Name: data.Name, Avail: data.Avail.IntPart(), Used: data.Used.IntPart(),
+					Total: data.Total.IntPart()},
+				Level: data.Level,
+			},
+		})
+	}
+	rows = append(rows,
+		db.Row{
+			STable: "log_dir",
+			Table:  "log_dir_" + table,
+			Tags:   tags,
+			Ts:     ts,
+			Columns: dirColumns{Name: disk.Logdir.Name, Avail: disk.Logdir.Avail.IntPart(),
+				Used: disk.Logdir.Used.IntPart(), Total: disk.Logdir.Total.IntPart()},
+		},
+		db.Row{
+			STable: "temp_dir",
+			Table:  "temp_dir_" + table,
+			Tags:   tags,
+			Ts:     ts,
+			Columns: dirColumns{Name: disk.Tempdir.Name, Avail: disk.Tempdir.Avail.IntPart(),
+				Used: disk.Tempdir.Used.IntPart(), Total: disk.Tempdir.Total.IntPart()},
+		},
 	)
-	return sqls
+	return rows
 }
 
-func insertVgroupSql(g VgroupInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) []string {
-	var sqls []string
-	sqls = append(sqls, fmt.Sprintf("insert into vgroups_info_%s using vgroups_info tags (%d, '%s', '%s') "+
-		"(ts, vgroup_id, database_name, tables_num, status, ) values ( '%s','%d', '%s', %d, '%s')",
-		ClusterID+strconv.Itoa(DnodeID)+strconv.Itoa(g.VgroupID), DnodeID, DnodeEp, ClusterID,
-		ts, g.VgroupID, g.DatabaseName, g.TablesNum, g.Status))
+func insertVgroupRows(g VgroupInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) []db.Row {
+	tags := dnodeTags{DnodeID: DnodeID, DnodeEp: DnodeEp, ClusterID: ClusterID}
+	rows := []db.Row{{
+		STable:  "vgroups_info",
+		Table:   "vgroups_info_" + ClusterID + strconv.Itoa(DnodeID) + strconv.Itoa(g.VgroupID),
+		Tags:    tags,
+		Ts:      ts,
+		Columns: g,
+	}}
 	for _, v := range g.Vnodes {
-		sqls = append(sqls, fmt.Sprintf("insert into vnodes_role_%s using vnodes_role tags (%d, '%s', '%s') values ('%s', '%s')",
-			ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID, ts, v.VnodeRole))
-	}
-	return sqls
+		rows = append(rows, db.Row{
+			STable:  "vnodes_role",
+			Table:   "vnodes_role_" + ClusterID + strconv.Itoa(DnodeID),
+			Tags:    tags,
+			Ts:      ts,
+			Columns: vnodeRoleColumns{VnodeRole: v.VnodeRole},
+		})
+	}
+	return rows
 }
 
-func insertLogSummary(log LogInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) string {
-	var e, info, debug, trace int
+func insertLogSummaryRow(log LogInfo, DnodeID int, DnodeEp string, ClusterID string, ts string) db.Row {
+	var columns logSummaryColumns
 	for _, s := range log.Summary {
 		switch s.Level {
 		case "error":
-			e = s.Total
+			columns.Error = s.Total
 		case "info":
-			info = s.Total
+			columns.Info = s.Total
 		case "debug":
-			debug = s.Total
+			columns.Debug = s.Total
 		case "trace":
-			trace = s.Total
+			columns.Trace = s.Total
 		}
 	}
-	return fmt.Sprintf("insert into log_summary_%s using log_summary tags (%d, '%s', '%s') values ('%s', %d, %d, %d, %d)",
-		ClusterID+strconv.Itoa(DnodeID), DnodeID, DnodeEp, ClusterID, ts, e, info, debug, trace)
+	return db.Row{
+		STable:  "log_summary",
+		Table:   "log_summary_" + ClusterID + strconv.Itoa(DnodeID),
+		Tags:    dnodeTags{DnodeID: DnodeID, DnodeEp: DnodeEp, ClusterID: ClusterID},
+		Ts:      ts,
+		Columns: columns,
+	}
 }
 
-func insertGrantSql(g GrantInfo, DnodeID int, ClusterID string, ts string) string {
-	return fmt.Sprintf("insert into grants_info_%s using grants_info tags ('%s') (ts, expire_time, "+
-		"timeseries_used, timeseries_total) values ('%s', %d, %d, %d)", ClusterID+strconv.Itoa(DnodeID), ClusterID, ts, g.ExpireTime, g.TimeseriesUsed, g.TimeseriesTotal)
+func insertGrantRow(g GrantInfo, DnodeID int, ClusterID string, ts string) db.Row {
+	return db.Row{
+		STable:  "grants_info",
+		Table:   "grants_info_" + ClusterID + strconv.Itoa(DnodeID),
+		Tags:    clusterTags{ClusterID: ClusterID},
+		Ts:      ts,
+		Columns: g,
+	}
 }
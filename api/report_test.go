@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+)
+
+func TestReportRows(t *testing.T) {
+	report := Report{
+		Ts:        "2024-01-01T00:00:00.000+08:00",
+		DnodeID:   1,
+		DnodeEp:   "localhost:6030",
+		ClusterID: "123",
+		ClusterInfo: &ClusterInfo{
+			FirstEp: "localhost:6030",
+			Version: "3.3.0.0",
+			Dnodes:  []Dnode{{DnodeID: 1, DnodeEp: "localhost:6030", Status: "ready"}},
+			Mnodes:  []Mnode{{MnodeID: 1, MnodeEp: "localhost:6030", Role: "leader"}},
+		},
+		VgroupInfos: []VgroupInfo{{VgroupID: 2, DatabaseName: "db", TablesNum: 10, Status: "ready",
+			Vnodes: []Vnode{{DnodeID: 1, VnodeRole: "leader"}}}},
+		DiskInfos: DiskInfo{
+			Datadir: []DataDir{{Name: "/var/lib/taos", Level: 0, Avail: decimal.NewFromInt(1), Used: decimal.NewFromInt(2),
+				Total: decimal.NewFromInt(3)}},
+		},
+		LogInfos: LogInfo{Summary: []Summary{{Level: "error", Total: 4}}},
+	}
+	rows := reportRows(report)
+	tables := make([]string, 0, len(rows))
+	for _, row := range rows {
+		tables = append(tables, row.Table)
+	}
+	assert.Equal(t, []string{"d_info_1231", "m_info_1231", "cluster_info_123", "dnode_info_1231", "data_dir_1231",
+		"log_dir_1231", "temp_dir_1231", "vgroups_info_12312", "vnodes_role_1231", "log_summary_1231"}, tables)
+
+	tags := dnodeTags{DnodeID: 1, DnodeEp: "localhost:6030", ClusterID: "123"}
+	assert.Equal(t, db.Row{STable: "vgroups_info", Table: "vgroups_info_12312", Tags: tags,
+		Ts: "2024-01-01T00:00:00.000+08:00", Columns: report.VgroupInfos[0]}, rows[7])
+	assert.Equal(t, db.Row{STable: "data_dir", Table: "data_dir_1231", Tags: tags, Ts: "2024-01-01T00:00:00.000+08:00",
+		Columns: dataDirColumns{dirColumns: dirColumns{Name: "/var/lib/taos", Avail: 1, Used: 2, Total: 3}}}, rows[4])
+	assert.Equal(t, &clusterInfoColumns{ClusterInfo: *report.ClusterInfo, DnodesTotal: 1, DnodesAlive: 1, MnodesTotal: 1,
+		MnodesAlive: 1}, rows[2].Columns)
+	assert.Equal(t, logSummaryColumns{Error: 4}, rows[9].Columns)
+}
+
+func TestFailedTables(t *testing.T) {
+	err := &db.InsertError{Failed: map[string]error{"t2": errors.New("b"), "t1": errors.New("a")}, Tables: 3}
+	assert.Equal(t, []gin.H{{"table": "t1", "error": "a"}, {"table": "t2", "error": "b"}}, failedTables(err))
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	taosError "github.com/taosdata/driver-go/v3/errors"
+)
+
+// Schema is the column sequence of a stable, tags and metrics of line protocol are written in this order. Types
+// are metric types of columns, values are written as them. A Schema is never modified after stored, changes store
+// a new one.
+type Schema struct {
+	Tags    []string          `json:"tags"`
+	Metrics []string          `json:"metrics"`
+	Types   map[string]string `json:"types,omitempty"`
+}
+
+// has reports whether all tags and metrics are known.
+func (s *Schema) has(tags []Tag, metrics []Metric) bool {
+	for _, tag := range tags {
+		if !contains(s.Tags, tag.Name) {
+			return false
+		}
+	}
+	for _, metric := range metrics {
+		if !contains(s.Metrics, metric.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// with returns a copy of s with unknown tags and metrics appended.
+func (s *Schema) with(tags []Tag, metrics []Metric) *Schema {
+	schema := &Schema{
+		Tags:    append(make([]string, 0, len(s.Tags)+len(tags)), s.Tags...),
+		Metrics: append(make([]string, 0, len(s.Metrics)+len(metrics)), s.Metrics...),
+		Types:   make(map[string]string, len(s.Types)+len(metrics)),
+	}
+	for name, typ := range s.Types {
+		schema.Types[name] = typ
+	}
+	for _, tag := range tags {
+		if !contains(schema.Tags, tag.Name) {
+			schema.Tags = append(schema.Tags, tag.Name)
+		}
+	}
+	for _, metric := range metrics {
+		if !contains(schema.Metrics, metric.Name) {
+			schema.Metrics = append(schema.Metrics, metric.Name)
+			// column is created with type of the first value
+			if typ := metricType(metric); len(typ) > 0 {
+				schema.Types[metric.Name] = typ
+			}
+		}
+	}
+	return schema
+}
+
+// merge returns a copy of s with tags and metrics of stored missing from s appended, types of s take precedence.
+func (s *Schema) merge(stored *Schema) *Schema {
+	schema := &Schema{
+		Tags:    append([]string{}, s.Tags...),
+		Metrics: append([]string{}, s.Metrics...),
+		Types:   make(map[string]string, len(s.Types)+len(stored.Types)),
+	}
+	for _, tag := range stored.Tags {
+		if !contains(schema.Tags, tag) {
+			schema.Tags = append(schema.Tags, tag)
+		}
+	}
+	for _, metric := range stored.Metrics {
+		if !contains(schema.Metrics, metric) {
+			schema.Metrics = append(schema.Metrics, metric)
+		}
+	}
+	for name, typ := range stored.Types {
+		schema.Types[name] = typ
+	}
+	for name, typ := range s.Types {
+		schema.Types[name] = typ
+	}
+	return schema
+}
+
+// SchemaRegistry holds schemas of stables written by general metric. Lookups share the stored schemas, adding
+// columns copies the schema of the stable under lock, so concurrent requests never lose a column.
+type SchemaRegistry struct {
+	lock    sync.RWMutex
+	schemas map[string]*Schema
+	// desc loads schema of a stable from database
+	desc func(ctx context.Context, stable string) (*Schema, error)
+}
+
+func NewSchemaRegistry(desc func(ctx context.Context, stable string) (*Schema, error)) *SchemaRegistry {
+	return &SchemaRegistry{schemas: map[string]*Schema{}, desc: desc}
+}
+
+// Get returns schema of stable.
+func (r *SchemaRegistry) Get(stable string) (*Schema, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	schema, ok := r.schemas[stable]
+	return schema, ok
+}
+
+// Ensure returns schema of stable containing all tags and metrics, changed is true if columns are added.
+func (r *SchemaRegistry) Ensure(stable string, tags []Tag, metrics []Metric) (schema *Schema, changed bool) {
+	r.lock.RLock()
+	schema, ok := r.schemas[stable]
+	r.lock.RUnlock()
+	if ok && schema.has(tags, metrics) {
+		return schema, false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	schema, ok = r.schemas[stable]
+	if !ok {
+		schema = &Schema{}
+	} else if schema.has(tags, metrics) {
+		return schema, false
+	}
+	schema = schema.with(tags, metrics)
+	r.schemas[stable] = schema
+	return schema, true
+}
+
+// Refresh merges schemas of stables with the ones in database. Columns in database come first in their order,
+// columns only known by keeper are kept after them, as they may be added by writes not yet seen by desc.
+func (r *SchemaRegistry) Refresh(ctx context.Context, stables ...string) error {
+	for _, stable := range stables {
+		described, err := r.desc(ctx, stable)
+		if err != nil {
+			return err
+		}
+		r.lock.Lock()
+		if stored, ok := r.schemas[stable]; ok {
+			described = described.merge(stored)
+		}
+		r.schemas[stable] = described
+		r.lock.Unlock()
+	}
+	return nil
+}
+
+// Schemas returns all schemas by stable.
+func (r *SchemaRegistry) Schemas() map[string]*Schema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	schemas := make(map[string]*Schema, len(r.schemas))
+	for stable, schema := range r.schemas {
+		schemas[stable] = schema
+	}
+	return schemas
+}
+
+// Init registers route to inspect schemas.
+func (r *SchemaRegistry) Init(c gin.IRouter) {
+	c.GET("debug/schemas", func(c *gin.Context) {
+		c.JSON(http.StatusOK, r.Schemas())
+	})
+}
+
+// TDengine error codes returned when line protocol does not match the stable
+var schemaErrorCodes = map[int32]bool{
+	0x0369: true, // TSDB_CODE_MND_TAG_ALREADY_EXIST
+	0x036A: true, // TSDB_CODE_MND_TAG_NOT_EXIST
+	0x036B: true, // TSDB_CODE_MND_COLUMN_ALREADY_EXIST
+	0x036C: true, // TSDB_CODE_MND_COLUMN_NOT_EXIST
+	0x2602: true, // TSDB_CODE_PAR_INVALID_COLUMN
+	0x2605: true, // TSDB_CODE_PAR_WRONG_VALUE_TYPE
+	0x3002: true, // TSDB_CODE_SML_INVALID_DATA
+	0x3004: true, // TSDB_CODE_SML_NOT_SAME_TYPE
+}
+
+// isSchemaError reports whether err is caused by a stale schema.
+func isSchemaError(err error) bool {
+	var taosErr *taosError.TaosError
+	return errors.As(err, &taosErr) && schemaErrorCodes[taosErr.Code]
+}
+
+// lineMeasurement returns the unescaped measurement of line, which ends at the first comma or space not escaped by
+// backslash.
+func lineMeasurement(line []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '\\' && i+1 < len(line):
+			i++
+			b.WriteByte(line[i])
+		case ch == ',' || ch == ' ':
+			return b.String()
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return ""
+}
+
+// lineStables returns sorted stables written by line protocol body.
+func lineStables(body []byte) []string {
+	seen := map[string]struct{}{}
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if stable := lineMeasurement(line); len(stable) > 0 {
+			seen[stable] = struct{}{}
+		}
+	}
+	stables := make([]string, 0, len(seen))
+	for stable := range seen {
+		stables = append(stables, stable)
+	}
+	sort.Strings(stables)
+	return stables
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+func TestSchemaRegistryEnsure(t *testing.T) {
+	r := NewSchemaRegistry(nil)
+
+	schema, changed := r.Ensure("taosd_dnodes_info", []Tag{{Name: "cluster_id"}}, []Metric{{Name: "uptime"}})
+	assert.True(t, changed)
+	assert.Equal(t, &Schema{Tags: []string{"cluster_id"}, Metrics: []string{"uptime"}, Types: map[string]string{}}, schema)
+
+	same, changed := r.Ensure("taosd_dnodes_info", []Tag{{Name: "cluster_id"}}, nil)
+	assert.False(t, changed)
+	assert.Same(t, schema, same)
+
+	// stored schema is not modified by later changes
+	_, changed = r.Ensure("taosd_dnodes_info", []Tag{{Name: "dnode_id"}}, []Metric{{Name: "cpu_engine"}})
+	assert.True(t, changed)
+	assert.Equal(t, []string{"cluster_id"}, schema.Tags)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.Ensure("taosd_dnodes_info", []Tag{{Name: fmt.Sprintf("tag_%d", i)}}, []Metric{{Name: fmt.Sprintf("metric_%d", i)}})
+		}(i)
+	}
+	wg.Wait()
+	schema, ok := r.Get("taosd_dnodes_info")
+	assert.True(t, ok)
+	assert.Len(t, schema.Tags, 52)
+	assert.Len(t, schema.Metrics, 52)
+}
+
+func TestSchemaRegistryRefresh(t *testing.T) {
+	var described []string
+	r := NewSchemaRegistry(func(ctx context.Context, stable string) (*Schema, error) {
+		described = append(described, stable)
+		if stable == "missing" {
+			return nil, errors.New("table does not exist")
+		}
+		return &Schema{Tags: []string{"cluster_id"}, Metrics: []string{"uptime", "cpu_engine"}}, nil
+	})
+	r.Ensure("taosd_dnodes_info", []Tag{{Name: "cluster_id"}, {Name: "dnode_ep"}},
+		[]Metric{{Name: "cpu_engine"}, {Name: "mem_engine", Value: MetricValue(`"1"`)}})
+
+	// columns in database come first, columns not yet described are kept after them
+	assert.NoError(t, r.Refresh(context.Background(), "taosd_dnodes_info"))
+	schema, _ := r.Get("taosd_dnodes_info")
+	assert.Equal(t, []string{"cluster_id", "dnode_ep"}, schema.Tags)
+	assert.Equal(t, []string{"uptime", "cpu_engine", "mem_engine"}, schema.Metrics)
+	assert.Equal(t, map[string]string{"mem_engine": MetricString}, schema.Types)
+	assert.Error(t, r.Refresh(context.Background(), "missing"))
+	assert.Equal(t, []string{"taosd_dnodes_info", "missing"}, described)
+
+	router := gin.New()
+	r.Init(router)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/schemas", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var schemas map[string]*Schema
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schemas))
+	assert.Equal(t, map[string]*Schema{"taosd_dnodes_info": schema}, schemas)
+}
+
+func TestWriteWithSchema(t *testing.T) {
+	var buf bytes.Buffer
+	enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
+	enc.StartLine("taosd_dnodes_info")
+	writeTags([]Tag{{Name: "dnode_id", Value: "1"}, {Name: "cluster_id", Value: "c 1"}},
+		[]string{"cluster_id", "dnode_id", "dnode_ep"}, "taosd_dnodes_info", defaultSubTableNamer, enc)
+	// metrics missing from the request are skipped without empty fields
+	writeMetrics([]Metric{{Name: "uptime", Value: MetricValue("1")}, {Name: "mem_engine", Value: MetricValue("0.5")}},
+		&Schema{Metrics: []string{"uptime", "cpu_engine", "mem_engine"}}, enc)
+	assert.NoError(t, enc.EndLine(time.UnixMilli(1703226836762)))
+	assert.Equal(t, `taosd_dnodes_info,cluster_id=c\ 1,dnode_id=1,dnode_ep=unknown,priv_stn=dinfo_1_cluster_c_1 `+
+		"uptime=1f64,mem_engine=0.5f64 1703226836762\n", buf.String())
+}
+
+func TestSchemaErrorHelpers(t *testing.T) {
+	err := newLineWriteError(http.StatusInternalServerError, []byte(`{"code":9730,"desc":"Invalid column name: xx"}`))
+	assert.EqualError(t, err, `unexpected status code 500:body:{"code":9730,"desc":"Invalid column name: xx"}`)
+	assert.True(t, isSchemaError(retry.Temporary(err)))
+	// matched by code rather than message
+	assert.False(t, isSchemaError(newLineWriteError(http.StatusInternalServerError,
+		[]byte(`{"code":11,"desc":"Invalid column name"}`))))
+	assert.False(t, isSchemaError(newLineWriteError(http.StatusBadGateway, []byte("Invalid column name"))))
+	assert.False(t, isSchemaError(errors.New("connection refused")))
+	assert.False(t, isSchemaError(nil))
+	assert.Equal(t, []string{"taosd_dnodes_info", "taosx_sys"},
+		lineStables([]byte("taosd_dnodes_info,cluster_id=1 uptime=1f64 1\ntaosx_sys,taosx_id=a x=1f64 1\ntaosd_dnodes_info x=1f64 2\n")))
+}
+
+func TestLineStablesEscaped(t *testing.T) {
+	var buf bytes.Buffer
+	enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
+	enc.StartLine(`my stable,a\b`)
+	enc.AddTag("t", "1")
+	enc.AddFloat("x", 1)
+	assert.NoError(t, enc.EndLine(time.UnixMilli(1)))
+	assert.Equal(t, []string{`my stable,a\b`}, lineStables(buf.Bytes()))
+}
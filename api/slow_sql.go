@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+// CreateSlowSqlFingerprintSql creates the stable of slow queries aggregated by fingerprint, a row for each window.
+var CreateSlowSqlFingerprintSql = "create stable if not exists taos_slow_sql_fingerprint " +
+	"(ts timestamp, query_count bigint, query_time_p50 int, query_time_p95 int, query_time_max int, " +
+	"rows_p50 bigint, rows_p95 bigint, rows_max bigint) " +
+	"tags (cluster_id varchar(32), db varchar(1024), `user` varchar(32), fingerprint_hash varchar(32), " +
+	"fingerprint varchar(4096))"
+
+// fingerprints longer than maxFingerprintTagLen are truncated in tags, their hashes are still of the whole ones
+const maxFingerprintTagLen = 4096
+
+type slowSqlKey struct {
+	clusterID string
+	db        string
+	user      string
+	hash      string
+}
+
+type slowSqlFingerprintTags struct {
+	ClusterID   string `taos:"cluster_id"`
+	DB          string `taos:"db"`
+	User        string `taos:"user"`
+	Hash        string `taos:"fingerprint_hash"`
+	Fingerprint string `taos:"fingerprint"`
+}
+
+type slowSqlFingerprintColumns struct {
+	Count        int64 `taos:"query_count"`
+	QueryTimeP50 int32 `taos:"query_time_p50"`
+	QueryTimeP95 int32 `taos:"query_time_p95"`
+	QueryTimeMax int32 `taos:"query_time_max"`
+	RowsP50      int64 `taos:"rows_p50"`
+	RowsP95      int64 `taos:"rows_p95"`
+	RowsMax      int64 `taos:"rows_max"`
+}
+
+// slowSqlSamples are slow queries of a fingerprint in a window. Maxima are exact, percentiles are of at most
+// maxSamples queries kept by reservoir sampling.
+type slowSqlSamples struct {
+	fingerprint  string
+	count        int64
+	queryTimeMax int32
+	rowsMax      int64
+	queryTimes   []int32
+	rows         []int64
+}
+
+// SlowSqlAggregator aggregates slow queries by fingerprint, cluster, db and user. A window is written when window
+// passed since its first query.
+type SlowSqlAggregator struct {
+	lock       sync.Mutex
+	window     time.Duration
+	maxSamples int
+	precision  lineprotocol.Precision
+	write      func(ctx context.Context, rows []db.Row) error
+	now        func() time.Time
+	rand       *rand.Rand
+
+	start   time.Time
+	groups  map[slowSqlKey]*slowSqlSamples
+	timer   *time.Timer
+	writing sync.WaitGroup
+}
+
+func NewSlowSqlAggregator(window time.Duration, maxSamples int, precision lineprotocol.Precision,
+	write func(ctx context.Context, rows []db.Row) error) *SlowSqlAggregator {
+	if maxSamples <= 0 {
+		maxSamples = 1
+	}
+	return &SlowSqlAggregator{
+		window:     window,
+		maxSamples: maxSamples,
+		precision:  precision,
+		write:      write,
+		now:        time.Now,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		groups:     map[slowSqlKey]*slowSqlSamples{},
+	}
+}
+
+// Add adds a slow query of fingerprint with hash.
+func (a *SlowSqlAggregator) Add(info SlowSqlDetailInfo, fingerprint, hash string) {
+	key := slowSqlKey{clusterID: info.ClusterId, db: info.Db, user: info.User, hash: hash}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.groups) == 0 {
+		a.start = a.now()
+		a.timer = time.AfterFunc(a.window, a.flushWindow)
+	}
+	samples, ok := a.groups[key]
+	if !ok {
+		samples = &slowSqlSamples{fingerprint: fingerprint, queryTimeMax: math.MinInt32, rowsMax: math.MinInt64}
+		a.groups[key] = samples
+	}
+	samples.count++
+	if info.QueryTime > samples.queryTimeMax {
+		samples.queryTimeMax = info.QueryTime
+	}
+	if info.RowsNum > samples.rowsMax {
+		samples.rowsMax = info.RowsNum
+	}
+	if len(samples.queryTimes) < a.maxSamples {
+		samples.queryTimes = append(samples.queryTimes, info.QueryTime)
+		samples.rows = append(samples.rows, info.RowsNum)
+	} else if i := a.rand.Int63n(samples.count); i < int64(a.maxSamples) {
+		samples.queryTimes[i] = info.QueryTime
+		samples.rows[i] = info.RowsNum
+	}
+}
+
+// take returns the pending window and starts a new one, it must be called with lock held.
+func (a *SlowSqlAggregator) take() (time.Time, map[slowSqlKey]*slowSqlSamples) {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	start, groups := a.start, a.groups
+	a.groups = map[slowSqlKey]*slowSqlSamples{}
+	a.writing.Add(1)
+	return start, groups
+}
+
+func (a *SlowSqlAggregator) flushWindow() {
+	a.lock.Lock()
+	if len(a.groups) == 0 {
+		a.lock.Unlock()
+		return
+	}
+	start, groups := a.take()
+	a.lock.Unlock()
+	a.flush(context.Background(), start, groups)
+}
+
+func (a *SlowSqlAggregator) flush(ctx context.Context, start time.Time, groups map[slowSqlKey]*slowSqlSamples) {
+	defer a.writing.Done()
+	if err := a.write(ctx, a.rows(start, groups)); err != nil {
+		gmLogger.Errorf("write slow sql fingerprints error, fingerprints:%d, msg:%s", len(groups), err)
+	}
+}
+
+// rows returns a row for each group at start of the window.
+func (a *SlowSqlAggregator) rows(start time.Time, groups map[slowSqlKey]*slowSqlSamples) []db.Row {
+	ts := a.precision.Timestamp(start)
+	rows := make([]db.Row, 0, len(groups))
+	for key, samples := range groups {
+		queryTimes := append([]int32(nil), samples.queryTimes...)
+		sort.Slice(queryTimes, func(i, j int) bool { return queryTimes[i] < queryTimes[j] })
+		rowsNum := append([]int64(nil), samples.rows...)
+		sort.Slice(rowsNum, func(i, j int) bool { return rowsNum[i] < rowsNum[j] })
+		rows = append(rows, db.Row{
+			STable: "taos_slow_sql_fingerprint",
+			Table:  "slowsqlfp_" + util.GetMd5HexStr(key.clusterID+"\x00"+key.db+"\x00"+key.user+"\x00"+key.hash),
+			Tags: slowSqlFingerprintTags{ClusterID: key.clusterID, DB: key.db, User: key.user, Hash: key.hash,
+				Fingerprint: util.SafeSubstring(samples.fingerprint, maxFingerprintTagLen)},
+			Ts: ts,
+			Columns: slowSqlFingerprintColumns{
+				Count:        samples.count,
+				QueryTimeP50: queryTimes[percentileIndex(len(queryTimes), 0.5)],
+				QueryTimeP95: queryTimes[percentileIndex(len(queryTimes), 0.95)],
+				QueryTimeMax: samples.queryTimeMax,
+				RowsP50:      rowsNum[percentileIndex(len(rowsNum), 0.5)],
+				RowsP95:      rowsNum[percentileIndex(len(rowsNum), 0.95)],
+				RowsMax:      samples.rowsMax,
+			},
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Table < rows[j].Table })
+	return rows
+}
+
+// percentileIndex returns the index of percentile p in n sorted values by nearest rank.
+func percentileIndex(n int, p float64) int {
+	i := int(math.Ceil(p*float64(n))) - 1
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// Flush writes the pending window and waits for windows being written.
+func (a *SlowSqlAggregator) Flush(ctx context.Context) error {
+	a.lock.Lock()
+	if len(a.groups) > 0 {
+		start, groups := a.take()
+		a.lock.Unlock()
+		a.flush(ctx, start, groups)
+	} else {
+		a.lock.Unlock()
+	}
+	return waitGroup(ctx, &a.writing)
+}
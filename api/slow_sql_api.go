@@ -0,0 +1,267 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+// modes of grouping slow queries by top
+const (
+	SlowSqlTopFingerprint = "fingerprint"
+	SlowSqlTopUser        = "user"
+)
+
+const (
+	defaultSlowSqlPageSize = 100
+	maxSlowSqlPageSize     = 1000
+	// maxSlowSqlOffset bounds rows skipped by page, so that the offset never overflows
+	maxSlowSqlOffset = 1000000
+	// defaultSlowSqlRange is the time range queried if start is not set
+	defaultSlowSqlRange = 24 * time.Hour
+)
+
+// columns of slow queries listed
+var slowSqlColumns = []string{"start_ts", "request_id", "query_time", "code", "error_info", "type", "rows_num", "sql",
+	"process_name", "process_id", "fingerprint_hash", "db", "`user`", "ip", "cluster_id"}
+
+// slowSqlSorts are columns slow queries can be sorted by, listed or grouped by top
+var slowSqlSorts = map[bool][]string{
+	false: {"start_ts", "query_time", "rows_num", "code"},
+	true:  {"query_count", "avg_query_time", "max_query_time", "total_rows"},
+}
+
+// slowSqlQuery is a query of GET /api/v1/slow-sql.
+type slowSqlQuery struct {
+	clusterID    string
+	db           string
+	user         string
+	ip           string
+	start        time.Time
+	end          time.Time
+	minQueryTime *int64
+	code         *int64
+	top          string
+	sort         string
+	desc         bool
+	page         int
+	pageSize     int
+}
+
+// parseSlowSqlQuery reads query parameters of c, start is now minus defaultSlowSqlRange if not set.
+func parseSlowSqlQuery(c *gin.Context, now time.Time) (*slowSqlQuery, error) {
+	q := &slowSqlQuery{
+		clusterID: c.Query("cluster_id"),
+		db:        c.Query("db"),
+		user:      c.Query("user"),
+		ip:        c.Query("ip"),
+		top:       c.Query("top"),
+		desc:      true,
+		page:      1,
+		pageSize:  defaultSlowSqlPageSize,
+	}
+	var err error
+	if q.start, err = queryTime(c, "start", now.Add(-defaultSlowSqlRange)); err != nil {
+		return nil, err
+	}
+	if q.end, err = queryTime(c, "end", time.Time{}); err != nil {
+		return nil, err
+	}
+	if !q.end.IsZero() && q.end.Before(q.start) {
+		return nil, fmt.Errorf("end is before start")
+	}
+	if q.minQueryTime, err = queryInt(c, "min_query_time"); err != nil {
+		return nil, err
+	}
+	if q.code, err = queryInt(c, "code"); err != nil {
+		return nil, err
+	}
+	switch q.top {
+	case "", SlowSqlTopFingerprint, SlowSqlTopUser:
+	default:
+		return nil, fmt.Errorf("top must be %s or %s", SlowSqlTopFingerprint, SlowSqlTopUser)
+	}
+	sorts := slowSqlSorts[len(q.top) > 0]
+	q.sort = c.DefaultQuery("sort", sorts[0])
+	if !contains(sorts, q.sort) {
+		return nil, fmt.Errorf("sort must be one of %s", strings.Join(sorts, ", "))
+	}
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "desc":
+	case "asc":
+		q.desc = false
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+	if page, err := queryInt(c, "page"); err != nil {
+		return nil, err
+	} else if page != nil {
+		if *page < 1 {
+			return nil, fmt.Errorf("page must be positive")
+		}
+		q.page = int(*page)
+	}
+	if pageSize, err := queryInt(c, "page_size"); err != nil {
+		return nil, err
+	} else if pageSize != nil {
+		if *pageSize < 1 || *pageSize > maxSlowSqlPageSize {
+			return nil, fmt.Errorf("page_size must be in [1, %d]", maxSlowSqlPageSize)
+		}
+		q.pageSize = int(*pageSize)
+	}
+	if maxPage := maxSlowSqlOffset/q.pageSize + 1; q.page > maxPage {
+		return nil, fmt.Errorf("page must be at most %d with page_size %d", maxPage, q.pageSize)
+	}
+	return q, nil
+}
+
+func queryTime(c *gin.Context, key string, def time.Time) (time.Time, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return def, nil
+	}
+	t, err := ParseTimestamp(value)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return t, nil
+}
+
+func queryInt(c *gin.Context, key string) (*int64, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return &n, nil
+}
+
+// quoteString returns s as a quoted string literal of TDengine SQL.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// where returns the where clause of q, timestamps are in precision of the database.
+func (q *slowSqlQuery) where(precision lineprotocol.Precision) string {
+	conditions := []string{fmt.Sprintf("start_ts >= %d", precision.Timestamp(q.start))}
+	if !q.end.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("start_ts < %d", precision.Timestamp(q.end)))
+	}
+	for _, tag := range []struct{ column, value string }{
+		{"cluster_id", q.clusterID}, {"db", q.db}, {"`user`", q.user}, {"ip", q.ip},
+	} {
+		if len(tag.value) > 0 {
+			conditions = append(conditions, tag.column+" = "+quoteString(tag.value))
+		}
+	}
+	if q.minQueryTime != nil {
+		conditions = append(conditions, fmt.Sprintf("query_time >= %d", *q.minQueryTime))
+	}
+	if q.code != nil {
+		conditions = append(conditions, fmt.Sprintf("code = %d", *q.code))
+	}
+	return " where " + strings.Join(conditions, " and ")
+}
+
+// sql returns the statement of the page and the one counting all rows or groups.
+func (q *slowSqlQuery) sql(database string, precision lineprotocol.Precision) (page string, count string) {
+	from := fmt.Sprintf(" from %s.taos_slow_sql_detail", database) + q.where(precision)
+	order := " asc"
+	if q.desc {
+		order = " desc"
+	}
+	limit := fmt.Sprintf(" limit %d offset %d", q.pageSize, (q.page-1)*q.pageSize)
+	if len(q.top) == 0 {
+		return "select " + strings.Join(slowSqlColumns, ", ") + from + " order by " + q.sort + order + limit,
+			"select count(*)" + from
+	}
+	group := "fingerprint_hash"
+	columns := "fingerprint_hash, last(sql) as `sql`"
+	if q.top == SlowSqlTopUser {
+		group = "`user`"
+		columns = "`user`"
+	}
+	page = "select " + columns + ", count(*) as query_count, avg(query_time) as avg_query_time, " +
+		"max(query_time) as max_query_time, sum(rows_num) as total_rows" + from + " group by " + group +
+		" order by " + q.sort + order + limit
+	count = "select count(*) from (select count(*)" + from + " group by " + group + ")"
+	return page, count
+}
+
+// slowSqlRows returns rows of data as objects keyed by column.
+func slowSqlRows(data *db.Data) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(data.Data))
+	for _, values := range data.Data {
+		row := make(map[string]interface{}, len(data.Head))
+		for i, column := range data.Head {
+			if i < len(values) {
+				row[strings.Trim(column, "`")] = values[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// maskSlowSqlRows replaces literals of sql of rows with ?.
+func maskSlowSqlRows(rows []map[string]interface{}) {
+	for _, row := range rows {
+		if sql, ok := row["sql"].(string); ok {
+			row["sql"] = MaskLiterals(sql)
+		}
+	}
+}
+
+// handleSlowSqlQuery lists slow queries matching filters of query parameters, or groups them by fingerprint or user
+// if top is set.
+func (gm *GeneralMetric) handleSlowSqlQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := parseSlowSqlQuery(c, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if gm.conn == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "no connection"})
+			return
+		}
+		page, count := q.sql(gm.database, gm.precision)
+		qid := util.GetQid(c.GetHeader("X-QID"))
+		data, err := gm.conn.Query(c.Request.Context(), page, qid)
+		if err != nil {
+			gmLogger.Errorf("query slow sql error, sql:%s, msg:%s", page, err)
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		total, err := gm.conn.Query(c.Request.Context(), count, qid)
+		if err != nil {
+			gmLogger.Errorf("count slow sql error, sql:%s, msg:%s", count, err)
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		var n interface{} = 0
+		if len(total.Data) > 0 && len(total.Data[0]) > 0 {
+			n = total.Data[0][0]
+		}
+		rows := slowSqlRows(data)
+		if gm.maskQueried {
+			maskSlowSqlRows(rows)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"total":     n,
+			"page":      q.page,
+			"page_size": q.pageSize,
+			"data":      rows,
+		})
+	}
+}
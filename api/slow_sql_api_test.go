@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+func slowSqlQueryOf(rawQuery string, now time.Time) (*slowSqlQuery, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/slow-sql?"+rawQuery, nil)
+	return parseSlowSqlQuery(c, now)
+}
+
+func TestSlowSqlQuery(t *testing.T) {
+	now := time.Unix(1703226836, 0)
+	q, err := slowSqlQueryOf("", now)
+	assert.NoError(t, err)
+	page, count := q.sql("log", lineprotocol.Millisecond)
+	assert.Equal(t, "select start_ts, request_id, query_time, code, error_info, type, rows_num, sql, process_name, "+
+		"process_id, fingerprint_hash, db, `user`, ip, cluster_id from log.taos_slow_sql_detail "+
+		"where start_ts >= 1703140436000 order by start_ts desc limit 100 offset 0", page)
+	assert.Equal(t, "select count(*) from log.taos_slow_sql_detail where start_ts >= 1703140436000", count)
+
+	q, err = slowSqlQueryOf("cluster_id=1&db=power&user=it%27s&ip=127.0.0.1&start=2023-12-22T00:00:00Z"+
+		"&end=1703226836&min_query_time=1000&code=0&sort=query_time&order=asc&page=3&page_size=20", now)
+	assert.NoError(t, err)
+	page, _ = q.sql("log", lineprotocol.Microsecond)
+	assert.Contains(t, page, " where start_ts >= 1703203200000000 and start_ts < 1703226836000000 and "+
+		"cluster_id = '1' and db = 'power' and `user` = 'it\\'s' and ip = '127.0.0.1' and query_time >= 1000 and "+
+		"code = 0 order by query_time asc limit 20 offset 40")
+
+	q, err = slowSqlQueryOf("top=fingerprint&db=power", now)
+	assert.NoError(t, err)
+	page, count = q.sql("log", lineprotocol.Millisecond)
+	assert.Equal(t, "select fingerprint_hash, last(sql) as `sql`, count(*) as query_count, "+
+		"avg(query_time) as avg_query_time, max(query_time) as max_query_time, sum(rows_num) as total_rows "+
+		"from log.taos_slow_sql_detail where start_ts >= 1703140436000 and db = 'power' group by fingerprint_hash "+
+		"order by query_count desc limit 100 offset 0", page)
+	assert.Equal(t, "select count(*) from (select count(*) from log.taos_slow_sql_detail "+
+		"where start_ts >= 1703140436000 and db = 'power' group by fingerprint_hash)", count)
+
+	q, err = slowSqlQueryOf("top=user&sort=max_query_time", now)
+	assert.NoError(t, err)
+	page, _ = q.sql("log", lineprotocol.Millisecond)
+	assert.Contains(t, page, "select `user`, count(*) as query_count")
+	assert.Contains(t, page, " group by `user` order by max_query_time desc")
+
+	for _, rawQuery := range []string{"top=db", "sort=sql", "top=user&sort=query_time", "order=up", "page=0",
+		"page_size=1001", "min_query_time=1s", "code=x", "start=yesterday", "start=1703226836&end=1703140436",
+		"page=10002", "page=9223372036854775807&page_size=1000"} {
+		_, err = slowSqlQueryOf(rawQuery, now)
+		assert.Error(t, err, rawQuery)
+	}
+}
+
+func TestSlowSqlRows(t *testing.T) {
+	rows := slowSqlRows(&db.Data{Head: []string{"`user`", "query_count"}, Data: [][]interface{}{{"root", 2}}})
+	assert.Equal(t, []map[string]interface{}{{"user": "root", "query_count": 2}}, rows)
+}
+
+func TestMaskSlowSqlRows(t *testing.T) {
+	rows := []map[string]interface{}{{"sql": "select * from t where name = 'alice' and id = 42"}, {"user": "root"}}
+	maskSlowSqlRows(rows)
+	assert.Equal(t, "select * from t where name = ? and id = ?", rows[0]["sql"])
+	assert.Equal(t, map[string]interface{}{"user": "root"}, rows[1])
+}
+
+func TestBearerAuth(t *testing.T) {
+	router := gin.New()
+	router.GET("/a", BearerAuth("secret"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/b", BearerAuth(""), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tc := range []struct {
+		path, auth string
+		code       int
+	}{
+		{"/a", "", http.StatusUnauthorized},
+		{"/a", "Bearer wrong", http.StatusUnauthorized},
+		{"/a", "secret", http.StatusUnauthorized},
+		{"/a", "Bearer secret", http.StatusOK},
+		{"/b", "", http.StatusUnauthorized},
+		{"/b", "Bearer ", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if len(tc.auth) > 0 {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc.auth)
+	}
+}
+
+func TestSlowSqlQueryHandler(t *testing.T) {
+	gm := &GeneralMetric{}
+	router := gin.New()
+	gm.RegisterQuery(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/slow-sql?top=db", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/slow-sql", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
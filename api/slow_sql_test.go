@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+func TestSlowSqlAggregator(t *testing.T) {
+	var lock sync.Mutex
+	var written [][]db.Row
+	a := NewSlowSqlAggregator(time.Hour, 100, lineprotocol.Millisecond, func(ctx context.Context, rows []db.Row) error {
+		lock.Lock()
+		defer lock.Unlock()
+		written = append(written, rows)
+		return nil
+	})
+	start := time.Unix(1703226836, 0)
+	a.now = func() time.Time { return start }
+
+	for i := 1; i <= 100; i++ {
+		a.Add(SlowSqlDetailInfo{ClusterId: "1", Db: "db", User: "root", QueryTime: int32(i), RowsNum: int64(i * 10)},
+			"select * from t where a = ?", "h1")
+	}
+	a.Add(SlowSqlDetailInfo{ClusterId: "1", Db: "db", User: "other", QueryTime: 7, RowsNum: 1}, "select ?", "h2")
+	assert.NoError(t, a.Flush(context.Background()))
+	assert.NoError(t, a.Flush(context.Background()))
+
+	assert.Len(t, written, 1)
+	rows := map[string]db.Row{}
+	for _, row := range written[0] {
+		assert.Equal(t, "taos_slow_sql_fingerprint", row.STable)
+		assert.Equal(t, start.UnixMilli(), row.Ts)
+		rows[row.Tags.(slowSqlFingerprintTags).Hash] = row
+	}
+	assert.Equal(t, slowSqlFingerprintTags{ClusterID: "1", DB: "db", User: "root", Hash: "h1",
+		Fingerprint: "select * from t where a = ?"}, rows["h1"].Tags)
+	assert.Equal(t, slowSqlFingerprintColumns{Count: 100, QueryTimeP50: 50, QueryTimeP95: 95, QueryTimeMax: 100,
+		RowsP50: 500, RowsP95: 950, RowsMax: 1000}, rows["h1"].Columns)
+	assert.Equal(t, slowSqlFingerprintColumns{Count: 1, QueryTimeP50: 7, QueryTimeP95: 7, QueryTimeMax: 7,
+		RowsP50: 1, RowsP95: 1, RowsMax: 1}, rows["h2"].Columns)
+	assert.NotEqual(t, rows["h1"].Table, rows["h2"].Table)
+}
+
+func TestSlowSqlAggregatorSampling(t *testing.T) {
+	done := make(chan []db.Row, 1)
+	a := NewSlowSqlAggregator(10*time.Millisecond, 10, lineprotocol.Millisecond,
+		func(ctx context.Context, rows []db.Row) error {
+			done <- rows
+			return nil
+		})
+	for i := 1; i <= 1000; i++ {
+		a.Add(SlowSqlDetailInfo{QueryTime: int32(i), RowsNum: int64(i)}, "select ?", "h")
+	}
+	select {
+	case rows := <-done:
+		columns := rows[0].Columns.(slowSqlFingerprintColumns)
+		assert.Equal(t, int64(1000), columns.Count)
+		assert.Equal(t, int32(1000), columns.QueryTimeMax)
+		assert.Equal(t, int64(1000), columns.RowsMax)
+		assert.LessOrEqual(t, columns.QueryTimeP50, columns.QueryTimeP95)
+	case <-time.After(5 * time.Second):
+		t.Fatal("window is not flushed")
+	}
+	assert.Len(t, a.groups, 0)
+}
+
+func TestPercentileIndex(t *testing.T) {
+	assert.Equal(t, 0, percentileIndex(1, 0.95))
+	assert.Equal(t, 49, percentileIndex(100, 0.5))
+	assert.Equal(t, 1, percentileIndex(3, 0.5))
+	assert.Equal(t, 0, percentileIndex(0, 0.5))
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
+)
+
+// DefaultSubTableRules name child tables of stables reported by taosd, taos and taosX.
+var DefaultSubTableRules = []config.SubTableRule{
+	{Stable: "taosx_sys", Template: "sys_{taosx_id}"},
+	{Stable: "taosx_agent", Template: "agent_{taosx_id}_{agent_id}"},
+	{Stable: "taosx_connector", Template: "connector_{taosx_id}_{ds_name}_{task_id}"},
+	{Stable: "taosx_task_*", Template: "task_{taosx_id}_{*}_{task_id}"},
+	{Stable: "taosd_cluster_info", Template: "cluster_{cluster_id}"},
+	{Stable: "taosd_vgroups_info", Template: "vginfo_{database_name}_vgroup_{vgroup_id}_cluster_{cluster_id}"},
+	{Stable: "taosd_dnodes_info", Template: "dinfo_{dnode_id}_cluster_{cluster_id}"},
+	{Stable: "taosd_dnodes_status", Template: "dstatus_{dnode_id}_cluster_{cluster_id}"},
+	{Stable: "taosd_dnodes_log_dirs", Template: "dlog_{dnode_id}_{data_dir_name}_cluster_{cluster_id}",
+		Md5: []string{"data_dir_name"}},
+	{Stable: "taosd_dnodes_data_dirs",
+		Template: "ddata_{dnode_id}_{data_dir_name}_level_{data_dir_level}_cluster_{cluster_id}",
+		Md5:      []string{"data_dir_name"}},
+	{Stable: "taosd_mnodes_info", Template: "minfo_{mnode_id}_cluster_{cluster_id}"},
+	{Stable: "taosd_vnodes_info",
+		Template: "vninfo_{database_name}_dnode_{dnode_id}_vgroup_{vgroup_id}_cluster_{cluster_id}"},
+	{Stable: "taosd_sql_req",
+		Template: "taosdsql_{username}_{sql_type}_{result}_{dnode_id}_vgroup_{vgroup_id}_cluster_{cluster_id}"},
+	{Stable: "taos_sql_req", Template: "taossql_{username}_{sql_type}_{result}_cluster_{cluster_id}"},
+	{Stable: "taos_slow_sql", Template: "slowsql_{username}_{duration}_{result}_cluster_{cluster_id}"},
+}
+
+var defaultSubTableNamer = mustNewSubTableNamer()
+
+func mustNewSubTableNamer() *SubTableNamer {
+	namer, err := NewSubTableNamer(nil)
+	if err != nil {
+		panic(err)
+	}
+	return namer
+}
+
+// templatePart is a literal, a tag or the part of stable name matched by *.
+type templatePart struct {
+	literal string
+	tag     string
+	star    bool
+}
+
+type subTableRule struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+	parts    []templatePart
+	md5      map[string]bool
+}
+
+// match returns the part of stable matched by *.
+func (r *subTableRule) match(stable string) (string, bool) {
+	if !r.wildcard {
+		return "", stable == r.prefix
+	}
+	if len(stable) < len(r.prefix)+len(r.suffix) || !strings.HasPrefix(stable, r.prefix) ||
+		!strings.HasSuffix(stable, r.suffix) {
+		return "", false
+	}
+	return stable[len(r.prefix) : len(stable)-len(r.suffix)], true
+}
+
+// render returns the name, empty if a tag is missing.
+func (r *subTableRule) render(star string, tagMap map[string]string, md5 bool) string {
+	var b strings.Builder
+	for _, part := range r.parts {
+		switch {
+		case part.star:
+			b.WriteString(star)
+		case len(part.tag) > 0:
+			value, ok := tagMap[part.tag]
+			if !ok {
+				return ""
+			}
+			if md5 && r.md5[part.tag] {
+				value = util.GetMd5HexStr(value)
+			}
+			b.WriteString(value)
+		default:
+			b.WriteString(part.literal)
+		}
+	}
+	return b.String()
+}
+
+// SubTableNamer names child tables of general metric stables with the first rule matching the stable.
+type SubTableNamer struct {
+	rules []*subTableRule
+}
+
+// NewSubTableNamer returns a namer checking rules before DefaultSubTableRules.
+func NewSubTableNamer(rules []config.SubTableRule) (*SubTableNamer, error) {
+	n := &SubTableNamer{}
+	for _, rule := range append(append([]config.SubTableRule{}, rules...), DefaultSubTableRules...) {
+		compiled, err := compileSubTableRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("sub table rule of %s: %w", rule.Stable, err)
+		}
+		n.rules = append(n.rules, compiled)
+	}
+	return n, nil
+}
+
+func compileSubTableRule(rule config.SubTableRule) (*subTableRule, error) {
+	r := &subTableRule{prefix: rule.Stable, md5: map[string]bool{}}
+	if len(rule.Stable) == 0 {
+		return nil, fmt.Errorf("empty stable")
+	}
+	switch strings.Count(rule.Stable, "*") {
+	case 0:
+	case 1:
+		r.wildcard = true
+		i := strings.Index(rule.Stable, "*")
+		r.prefix, r.suffix = rule.Stable[:i], rule.Stable[i+1:]
+	default:
+		return nil, fmt.Errorf("more than one * in stable")
+	}
+	for _, tag := range rule.Md5 {
+		r.md5[tag] = true
+	}
+
+	template := rule.Template
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			r.parts = append(r.parts, templatePart{literal: template})
+			break
+		}
+		if start > 0 {
+			r.parts = append(r.parts, templatePart{literal: template[:start]})
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in template %s", rule.Template)
+		}
+		name := template[start+1 : start+end]
+		switch {
+		case len(name) == 0:
+			return nil, fmt.Errorf("empty {} in template %s", rule.Template)
+		case name == "*" && !r.wildcard:
+			return nil, fmt.Errorf("{*} in template %s of stable without *", rule.Template)
+		case name == "*":
+			r.parts = append(r.parts, templatePart{star: true})
+		default:
+			r.parts = append(r.parts, templatePart{tag: name})
+		}
+		template = template[start+end+1:]
+	}
+	return r, nil
+}
+
+// hashPrefix returns the leading literal of the template, which prefixes md5 of names still too long.
+func (r *subTableRule) hashPrefix() string {
+	prefix := "t_"
+	if len(r.parts) > 0 && len(r.parts[0].literal) > 0 {
+		prefix = r.parts[0].literal
+	}
+	if max := util.MAX_TABLE_NAME_LEN - 32; len(prefix) > max {
+		prefix = prefix[:max]
+	}
+	return prefix
+}
+
+// Name returns valid name of the child table of stable with tags, empty if no rule matches or a tag is missing.
+// If the name is longer than util.MAX_TABLE_NAME_LEN, tags listed in md5 of the rule are replaced by their md5. If it
+// is still too long, the name is the leading literal of the template followed by md5 of the whole name.
+func (n *SubTableNamer) Name(stable string, tagMap map[string]string) string {
+	for _, rule := range n.rules {
+		star, ok := rule.match(stable)
+		if !ok {
+			continue
+		}
+		name := rule.render(star, tagMap, false)
+		if len(name) > util.MAX_TABLE_NAME_LEN && len(rule.md5) > 0 {
+			name = rule.render(star, tagMap, true)
+		}
+		if len(name) > util.MAX_TABLE_NAME_LEN {
+			name = rule.hashPrefix() + util.GetMd5HexStr(name)
+		}
+		return util.ToValidTableName(name)
+	}
+	return ""
+}
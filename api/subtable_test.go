@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
+)
+
+func TestSubTableNamer(t *testing.T) {
+	namer, err := NewSubTableNamer([]config.SubTableRule{
+		{Stable: "taosx_task_*", Template: "t_{task_id}_{*}"},
+		{Stable: "custom_*_info", Template: "{*}-{host}", Md5: []string{"host"}},
+		{Stable: "taosd_mnodes_info", Template: ""},
+	})
+	assert.NoError(t, err)
+
+	tags := map[string]string{"taosx_id": "x1", "task_id": "7", "host": "Node.A", "cluster_id": "1", "mnode_id": "2"}
+	// configured rules are checked before built-in rules
+	assert.Equal(t, "t_7_kafka", namer.Name("taosx_task_kafka", tags))
+	assert.Equal(t, "disk_node_a", namer.Name("custom_disk_info", tags))
+	assert.Equal(t, "", namer.Name("taosd_mnodes_info", tags))
+	assert.Equal(t, "cluster_1", namer.Name("taosd_cluster_info", tags))
+	assert.Equal(t, "task_x1_kafka_7", defaultSubTableNamer.Name("taosx_task_kafka", tags))
+
+	// a missing tag or stable without rule leaves naming to TDengine
+	assert.Equal(t, "", namer.Name("taosx_agent", tags))
+	assert.Equal(t, "", namer.Name("custom_info", map[string]string{}))
+	assert.Equal(t, "", namer.Name("unknown", tags))
+
+	long := strings.Repeat("h", 200)
+	assert.Equal(t, "disk_"+util.GetMd5HexStr(long), namer.Name("custom_disk_info", map[string]string{"host": long}))
+}
+
+func TestSubTableNamerTooLong(t *testing.T) {
+	namer, err := NewSubTableNamer([]config.SubTableRule{
+		{Stable: "taosx_task_*", Template: "task_{taosx_id}_{task_id}"},
+		{Stable: "custom_info", Template: "{host}_{id}", Md5: []string{"host"}},
+	})
+	assert.NoError(t, err)
+
+	long := strings.Repeat("x", 200)
+	// a rule without md5 falls back to the leading literal and md5 of the name
+	name := namer.Name("taosx_task_kafka", map[string]string{"taosx_id": long, "task_id": "7"})
+	assert.Equal(t, "task_"+util.GetMd5HexStr("task_"+long+"_7"), name)
+
+	// the name is still too long with tags in md5 replaced
+	tags := map[string]string{"host": "h", "id": long}
+	name = namer.Name("custom_info", tags)
+	assert.Equal(t, "t_"+util.GetMd5HexStr(util.GetMd5HexStr("h")+"_"+long), name)
+	assert.LessOrEqual(t, len(name), util.MAX_TABLE_NAME_LEN)
+}
+
+func TestSubTableRuleInvalid(t *testing.T) {
+	for _, rule := range []config.SubTableRule{
+		{Stable: "", Template: "a"},
+		{Stable: "a_*_*", Template: "a"},
+		{Stable: "a", Template: "{*}"},
+		{Stable: "a", Template: "x_{id"},
+		{Stable: "a", Template: "x_{}"},
+	} {
+		_, err := NewSubTableNamer([]config.SubTableRule{rule})
+		assert.Error(t, err, rule)
+	}
+}
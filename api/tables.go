@@ -22,21 +22,21 @@ type Report struct {
 }
 
 type ClusterInfo struct {
-	FirstEp          string  `json:"first_ep"`
-	FirstEpDnodeID   int     `json:"first_ep_dnode_id"`
-	Version          string  `json:"version"`
-	MasterUptime     float32 `json:"master_uptime"`
-	MonitorInterval  int     `json:"monitor_interval"`
-	DbsTotal         int     `json:"dbs_total"`
-	TbsTotal         int64   `json:"tbs_total"` // change to bigint since TS-3003
-	StbsTotal        int     `json:"stbs_total"`
-	VgroupsTotal     int     `json:"vgroups_total"`
-	VgroupsAlive     int     `json:"vgroups_alive"`
-	VnodesTotal      int     `json:"vnodes_total"`
-	VnodesAlive      int     `json:"vnodes_alive"`
-	ConnectionsTotal int     `json:"connections_total"`
-	TopicsTotal      int     `json:"topics_total"`
-	StreamsTotal     int     `json:"streams_total"`
+	FirstEp          string  `json:"first_ep" taos:"first_ep"`
+	FirstEpDnodeID   int     `json:"first_ep_dnode_id" taos:"first_ep_dnode_id"`
+	Version          string  `json:"version" taos:"version"`
+	MasterUptime     float32 `json:"master_uptime" taos:"master_uptime"`
+	MonitorInterval  int     `json:"monitor_interval" taos:"monitor_interval"`
+	DbsTotal         int     `json:"dbs_total" taos:"dbs_total"`
+	TbsTotal         int64   `json:"tbs_total" taos:"tbs_total"` // change to bigint since TS-3003
+	StbsTotal        int     `json:"stbs_total" taos:"stbs_total"`
+	VgroupsTotal     int     `json:"vgroups_total" taos:"vgroups_total"`
+	VgroupsAlive     int     `json:"vgroups_alive" taos:"vgroups_alive"`
+	VnodesTotal      int     `json:"vnodes_total" taos:"vnodes_total"`
+	VnodesAlive      int     `json:"vnodes_alive" taos:"vnodes_alive"`
+	ConnectionsTotal int     `json:"connections_total" taos:"connections_total"`
+	TopicsTotal      int     `json:"topics_total" taos:"topics_total"`
+	StreamsTotal     int     `json:"streams_total" taos:"streams_total"`
 	Dnodes           []Dnode `json:"dnodes"`
 	Mnodes           []Mnode `json:"mnodes"`
 }
@@ -90,37 +90,37 @@ var CreateMnodeSql = "create table if not exists m_info (" +
 	") tags (mnode_id int, mnode_ep nchar(" + dnodeEpLen + "), cluster_id nchar(32))"
 
 type DnodeInfo struct {
-	Uptime                float32 `json:"uptime"`
-	CPUEngine             float32 `json:"cpu_engine"`
-	CPUSystem             float32 `json:"cpu_system"`
-	CPUCores              float32 `json:"cpu_cores"`
-	MemEngine             int     `json:"mem_engine"`
-	MemSystem             int     `json:"mem_system"`
-	MemTotal              int     `json:"mem_total"`
-	DiskEngine            int64   `json:"disk_engine"`
-	DiskUsed              int64   `json:"disk_used"`
-	DiskTotal             int64   `json:"disk_total"`
-	NetIn                 float32 `json:"net_in"`
-	NetOut                float32 `json:"net_out"`
-	IoRead                float32 `json:"io_read"`
-	IoWrite               float32 `json:"io_write"`
-	IoReadDisk            float32 `json:"io_read_disk"`
-	IoWriteDisk           float32 `json:"io_write_disk"`
-	ReqSelect             int     `json:"req_select"`
-	ReqSelectRate         float32 `json:"req_select_rate"`
-	ReqInsert             int     `json:"req_insert"`
-	ReqInsertSuccess      int     `json:"req_insert_success"`
-	ReqInsertRate         float32 `json:"req_insert_rate"`
-	ReqInsertBatch        int     `json:"req_insert_batch"`
-	ReqInsertBatchSuccess int     `json:"req_insert_batch_success"`
-	ReqInsertBatchRate    float32 `json:"req_insert_batch_rate"`
-	Errors                int     `json:"errors"`
-	VnodesNum             int     `json:"vnodes_num"`
-	Masters               int     `json:"masters"`
-	HasMnode              int8    `json:"has_mnode"`
-	HasQnode              int8    `json:"has_qnode"`
-	HasSnode              int8    `json:"has_snode"`
-	HasBnode              int8    `json:"has_bnode"`
+	Uptime                float32 `json:"uptime" taos:"uptime"`
+	CPUEngine             float32 `json:"cpu_engine" taos:"cpu_engine"`
+	CPUSystem             float32 `json:"cpu_system" taos:"cpu_system"`
+	CPUCores              float32 `json:"cpu_cores" taos:"cpu_cores"`
+	MemEngine             int     `json:"mem_engine" taos:"mem_engine"`
+	MemSystem             int     `json:"mem_system" taos:"mem_system"`
+	MemTotal              int     `json:"mem_total" taos:"mem_total"`
+	DiskEngine            int64   `json:"disk_engine" taos:"disk_engine"`
+	DiskUsed              int64   `json:"disk_used" taos:"disk_used"`
+	DiskTotal             int64   `json:"disk_total" taos:"disk_total"`
+	NetIn                 float32 `json:"net_in" taos:"net_in"`
+	NetOut                float32 `json:"net_out" taos:"net_out"`
+	IoRead                float32 `json:"io_read" taos:"io_read"`
+	IoWrite               float32 `json:"io_write" taos:"io_write"`
+	IoReadDisk            float32 `json:"io_read_disk" taos:"io_read_disk"`
+	IoWriteDisk           float32 `json:"io_write_disk" taos:"io_write_disk"`
+	ReqSelect             int     `json:"req_select" taos:"req_select"`
+	ReqSelectRate         float32 `json:"req_select_rate" taos:"req_select_rate"`
+	ReqInsert             int     `json:"req_insert" taos:"req_insert"`
+	ReqInsertSuccess      int     `json:"req_insert_success" taos:"req_insert_success"`
+	ReqInsertRate         float32 `json:"req_insert_rate" taos:"req_insert_rate"`
+	ReqInsertBatch        int     `json:"req_insert_batch" taos:"req_insert_batch"`
+	ReqInsertBatchSuccess int     `json:"req_insert_batch_success" taos:"req_insert_batch_success"`
+	ReqInsertBatchRate    float32 `json:"req_insert_batch_rate" taos:"req_insert_batch_rate"`
+	Errors                int     `json:"errors" taos:"errors"`
+	VnodesNum             int     `json:"vnodes_num" taos:"vnodes_num"`
+	Masters               int     `json:"masters" taos:"masters"`
+	HasMnode              int8    `json:"has_mnode" taos:"has_mnode"`
+	HasQnode              int8    `json:"has_qnode" taos:"has_qnode"`
+	HasSnode              int8    `json:"has_snode" taos:"has_snode"`
+	HasBnode              int8    `json:"has_bnode" taos:"has_bnode"`
 }
 
 var CreateDnodeInfoSql = "create table if not exists dnodes_info (" +
@@ -217,10 +217,10 @@ type StbInfo struct {
 }
 
 type VgroupInfo struct {
-	VgroupID     int     `json:"vgroup_id"`
-	DatabaseName string  `json:"database_name"`
-	TablesNum    int64   `json:"tables_num"`
-	Status       string  `json:"status"`
+	VgroupID     int     `json:"vgroup_id" taos:"vgroup_id"`
+	DatabaseName string  `json:"database_name" taos:"database_name"`
+	TablesNum    int64   `json:"tables_num" taos:"tables_num"`
+	Status       string  `json:"status" taos:"status"`
 	Vnodes       []Vnode `json:"vnodes"`
 }
 
@@ -266,9 +266,9 @@ var CreateSummarySql = "create table if not exists log_summary(" +
 	") tags (dnode_id int, dnode_ep nchar(" + dnodeEpLen + "), cluster_id nchar(32))"
 
 type GrantInfo struct {
-	ExpireTime      int64 `json:"expire_time"`
-	TimeseriesUsed  int64 `json:"timeseries_used"`
-	TimeseriesTotal int64 `json:"timeseries_total"`
+	ExpireTime      int64 `json:"expire_time" taos:"expire_time"`
+	TimeseriesUsed  int64 `json:"timeseries_used" taos:"timeseries_used"`
+	TimeseriesTotal int64 `json:"timeseries_total" taos:"timeseries_total"`
 }
 
 var CreateGrantInfoSql = "create table if not exists grants_info(" +
@@ -282,5 +282,42 @@ var CreateKeeperSql = "create table if not exists keeper_monitor (" +
 	"ts timestamp, " +
 	"cpu float, " +
 	"mem float, " +
-	"total_reports int " +
+	"total_reports int, " +
+	"goroutines int, " +
+	"threads int, " +
+	"rss bigint, " +
+	"open_fds int, " +
+	"gc_count bigint, " +
+	"gc_pause_total double, " +
+	"gc_pause_last double, " +
+	"in_flight int, " +
+	"req_report int, " +
+	"req_adapter_report int, " +
+	"req_general_metric int, " +
+	"req_taosd_cluster_basic int, " +
+	"req_slow_sql_detail_batch int, " +
+	"req_metrics int, " +
+	"req_other int, " +
+	"last_write timestamp " +
 	") tags (identify nchar(50))"
+
+// KeeperMonitorColumns lists the columns added to `keeper_monitor` after its first release, they are
+// added to existing tables by `Reporter.Init`.
+var KeeperMonitorColumns = [][2]string{
+	{"goroutines", "int"},
+	{"threads", "int"},
+	{"rss", "bigint"},
+	{"open_fds", "int"},
+	{"gc_count", "bigint"},
+	{"gc_pause_total", "double"},
+	{"gc_pause_last", "double"},
+	{"in_flight", "int"},
+	{"req_report", "int"},
+	{"req_adapter_report", "int"},
+	{"req_general_metric", "int"},
+	{"req_taosd_cluster_basic", "int"},
+	{"req_slow_sql_detail_batch", "int"},
+	{"req_metrics", "int"},
+	{"req_other", "int"},
+	{"last_write", "timestamp"},
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+// timestampsKey is the key of Timestamps in gin context
+const timestampsKey = "keeper_timestamps"
+
+// skews of sources not reporting for skewIdleTimeout are dropped
+const skewIdleTimeout = 10 * time.Minute
+
+// epochs below these magnitudes are in seconds, milliseconds and microseconds, others in nanoseconds. Seconds
+// reach year 5138 and milliseconds start from 1973, so the units of reports of these years never overlap.
+const (
+	maxEpochSecond      = 1e11
+	maxEpochMillisecond = 1e14
+	maxEpochMicrosecond = 1e17
+)
+
+// ParseTimestamp parses RFC3339 time or epoch in seconds, milliseconds, microseconds or nanoseconds.
+func ParseTimestamp(s string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ParseEpoch(epoch), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return t, nil
+}
+
+// ParseEpoch returns time of epoch, its unit is told by its magnitude.
+func ParseEpoch(epoch int64) time.Time {
+	abs := epoch
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < maxEpochSecond:
+		return time.Unix(epoch, 0)
+	case abs < maxEpochMillisecond:
+		return time.UnixMilli(epoch)
+	case abs < maxEpochMicrosecond:
+		return time.UnixMicro(epoch)
+	}
+	return time.Unix(0, epoch)
+}
+
+// DatabasePrecision returns precision of the metrics database set by its precision option, milliseconds if not set.
+func DatabasePrecision(conf *config.Config) (lineprotocol.Precision, error) {
+	precision, ok := conf.Metrics.Database.Options["precision"]
+	if !ok {
+		return lineprotocol.Millisecond, nil
+	}
+	return lineprotocol.ParsePrecision(fmt.Sprint(precision))
+}
+
+func mustDatabasePrecision(conf *config.Config) lineprotocol.Precision {
+	precision, err := DatabasePrecision(conf)
+	if err != nil {
+		panic(fmt.Errorf("invalid metrics.database.options.precision: %s", err))
+	}
+	return precision
+}
+
+// truncate drops the part of t finer than precision.
+func truncate(t time.Time, precision lineprotocol.Precision) time.Time {
+	switch precision {
+	case lineprotocol.Microsecond:
+		return t.Truncate(time.Microsecond)
+	case lineprotocol.Millisecond:
+		return t.Truncate(time.Millisecond)
+	case lineprotocol.Second:
+		return t.Truncate(time.Second)
+	}
+	return t
+}
+
+type clockSkew struct {
+	skew time.Duration
+	seen time.Time
+}
+
+// Timestamps checks timestamps of reports against keeper's clock. Timestamps later or earlier than it by more than
+// the bounds are rejected, and the latest difference of each source is kept as its clock skew, so sources with bad
+// NTP are visible even if their reports are rejected.
+type Timestamps struct {
+	maxFuture time.Duration
+	maxPast   time.Duration
+	now       func() time.Time
+
+	lock     sync.Mutex
+	skews    map[string]*clockSkew
+	rejected map[string]uint64
+}
+
+func NewTimestamps(conf config.TimestampConfig) *Timestamps {
+	return &Timestamps{
+		maxFuture: conf.MaxFuture,
+		maxPast:   conf.MaxPast,
+		now:       time.Now,
+		skews:     map[string]*clockSkew{},
+		rejected:  map[string]uint64{},
+	}
+}
+
+// Handler makes the timestamps available to handlers of the request.
+func (ts *Timestamps) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(timestampsKey, ts)
+		c.Next()
+	}
+}
+
+// Check parses s of endpoint, records skew of source unless source is empty and checks the bounds.
+func (ts *Timestamps) Check(endpoint, source, s string) (time.Time, error) {
+	t, err := ParseTimestamp(s)
+	if err != nil {
+		ts.reject(endpoint)
+		return t, err
+	}
+	now := ts.now()
+	skew := now.Sub(t)
+	ts.lock.Lock()
+	if len(source) > 0 {
+		ts.skews[source] = &clockSkew{skew: skew, seen: now}
+	}
+	ts.lock.Unlock()
+	if ts.maxFuture > 0 && -skew > ts.maxFuture {
+		ts.reject(endpoint)
+		return t, fmt.Errorf("timestamp %s is %s later than keeper", s, -skew)
+	}
+	if ts.maxPast > 0 && skew > ts.maxPast {
+		ts.reject(endpoint)
+		return t, fmt.Errorf("timestamp %s is %s earlier than keeper", s, skew)
+	}
+	return t, nil
+}
+
+func (ts *Timestamps) reject(endpoint string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.rejected[endpoint]++
+}
+
+// Skews returns clock skew by source, positive if the source is behind keeper.
+func (ts *Timestamps) Skews() map[string]time.Duration {
+	now := ts.now()
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	skews := make(map[string]time.Duration, len(ts.skews))
+	for source, skew := range ts.skews {
+		if now.Sub(skew.seen) > skewIdleTimeout {
+			delete(ts.skews, source)
+			continue
+		}
+		skews[source] = skew.skew
+	}
+	return skews
+}
+
+// Rejected returns count of rejected timestamps by endpoint.
+func (ts *Timestamps) Rejected() map[string]uint64 {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	rejected := make(map[string]uint64, len(ts.rejected))
+	for endpoint, n := range ts.rejected {
+		rejected[endpoint] = n
+	}
+	return rejected
+}
+
+// checkTimestamp checks timestamp s of the request reported by source, it is only parsed if the request is not
+// handled by Timestamps.Handler.
+func checkTimestamp(c *gin.Context, source, s string) (time.Time, error) {
+	value, ok := c.Get(timestampsKey)
+	if !ok {
+		return ParseTimestamp(s)
+	}
+	return value.(*Timestamps).Check(c.FullPath(), source, s)
+}
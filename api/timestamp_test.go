@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2023, 12, 22, 6, 33, 56, 762000000, time.UTC)
+	for _, s := range []string{"1703226836762", "1703226836762000", "1703226836762000000",
+		"2023-12-22T06:33:56.762Z", "2023-12-22T14:33:56.762+08:00"} {
+		ts, err := ParseTimestamp(s)
+		assert.NoError(t, err, s)
+		assert.True(t, want.Equal(ts), s)
+	}
+	ts, err := ParseTimestamp("1703226836")
+	assert.NoError(t, err)
+	assert.Equal(t, want.Truncate(time.Second).Unix(), ts.Unix())
+	assert.Equal(t, int64(-1), ParseEpoch(-1).Unix())
+
+	for _, s := range []string{"", "abc", "2023-12-22 06:33:56"} {
+		_, err = ParseTimestamp(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDatabasePrecision(t *testing.T) {
+	conf := &config.Config{}
+	precision, err := DatabasePrecision(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, lineprotocol.Millisecond, precision)
+
+	conf.Metrics.Database.Options = map[string]interface{}{"precision": "us"}
+	precision, err = DatabasePrecision(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, lineprotocol.Microsecond, precision)
+
+	ts := time.Unix(1, 2003004)
+	assert.Equal(t, time.Unix(1, 2003000), truncate(ts, precision))
+	assert.Equal(t, time.Unix(1, 2000000), truncate(ts, lineprotocol.Millisecond))
+
+	conf.Metrics.Database.Options["precision"] = "h"
+	_, err = DatabasePrecision(conf)
+	assert.Error(t, err)
+}
+
+func TestTimestamps(t *testing.T) {
+	ts := NewTimestamps(config.TimestampConfig{MaxFuture: time.Minute, MaxPast: time.Hour})
+	now := time.Unix(1703226836, 0)
+	ts.now = func() time.Time { return now }
+
+	_, err := ts.Check("/report", "dnode1:6030", "1703226806000")
+	assert.NoError(t, err)
+	_, err = ts.Check("/report", "dnode2:6030", "1703226956")
+	assert.EqualError(t, err, "timestamp 1703226956 is 2m0s later than keeper")
+	_, err = ts.Check("/general-metric", "", "1703219636")
+	assert.EqualError(t, err, "timestamp 1703219636 is 2h0m0s earlier than keeper")
+	_, err = ts.Check("/general-metric", "", "x")
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]time.Duration{"dnode1:6030": 30 * time.Second, "dnode2:6030": -2 * time.Minute},
+		ts.Skews())
+	assert.Equal(t, map[string]uint64{"/report": 1, "/general-metric": 2}, ts.Rejected())
+
+	now = now.Add(skewIdleTimeout)
+	_, err = ts.Check("/report", "dnode1:6030", "1703227435")
+	assert.NoError(t, err)
+	now = now.Add(time.Second)
+	assert.Equal(t, map[string]time.Duration{"dnode1:6030": time.Second}, ts.Skews())
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/infrastructure/log"
+)
+
+var validationLogger = log.GetLogger("VAL")
+
+// validation modes
+const (
+	ValidationLenient = "lenient"
+	ValidationStrict  = "strict"
+)
+
+// validatorKey is the key of Validator in gin context
+const validatorKey = "keeper_validator"
+
+// record is the part of a payload checked by validation, a payload has a record for each row it writes.
+type record struct {
+	stable  string
+	tags    map[string]string
+	metrics []string
+	ts      string
+}
+
+type validationRule struct {
+	endpoint      string
+	stable        string
+	strict        bool
+	requiredTags  []string
+	metricPattern *regexp.Regexp
+	maxSkew       time.Duration
+}
+
+func (r *validationRule) matches(endpoint, stable string) bool {
+	if len(r.endpoint) > 0 && r.endpoint != endpoint {
+		return false
+	}
+	if len(r.stable) == 0 {
+		return true
+	}
+	ok, _ := path.Match(r.stable, stable)
+	return ok
+}
+
+// check appends violations of rec to violations.
+func (r *validationRule) check(rec record, ts time.Time, now time.Time, violations []string) []string {
+	for _, tag := range r.requiredTags {
+		if len(rec.tags[tag]) == 0 {
+			violations = append(violations, fmt.Sprintf("%s: missing tag %s", rec.stable, tag))
+		}
+	}
+	if r.metricPattern != nil {
+		for _, metric := range rec.metrics {
+			if !r.metricPattern.MatchString(metric) {
+				violations = append(violations, fmt.Sprintf("%s: metric name %s not matching %s", rec.stable, metric,
+					r.metricPattern))
+			}
+		}
+	}
+	if r.maxSkew > 0 && !ts.IsZero() {
+		if skew := now.Sub(ts); skew > r.maxSkew || skew < -r.maxSkew {
+			violations = append(violations, fmt.Sprintf("%s: ts %s differs from now by %s", rec.stable, rec.ts, skew))
+		}
+	}
+	return violations
+}
+
+// ValidationStats counts payloads with violations and payloads rejected of an endpoint.
+type ValidationStats struct {
+	Invalid  uint64
+	Rejected uint64
+}
+
+// Validator checks payloads of ingestion endpoints. Besides configured rules, records must have a valid ts, a
+// stable and no empty tag values. In lenient mode violations are logged and the payload is written with invalid
+// parts skipped or patched, in strict mode the payload is rejected with 400. Rejected payloads are stored in the
+// dead-letter directory.
+type Validator struct {
+	strict     bool
+	rules      []*validationRule
+	deadLetter *DeadLetter
+	now        func() time.Time
+
+	lock  sync.Mutex
+	stats map[string]*ValidationStats
+}
+
+func NewValidator(conf config.ValidationConfig) (*Validator, error) {
+	strict, err := strictMode(conf.Mode)
+	if err != nil {
+		return nil, err
+	}
+	v := &Validator{strict: strict, now: time.Now, stats: map[string]*ValidationStats{}}
+	for i, rule := range conf.Rule {
+		compiled := &validationRule{
+			endpoint:     rule.Endpoint,
+			stable:       rule.Stable,
+			strict:       strict,
+			requiredTags: rule.RequiredTags,
+			maxSkew:      rule.MaxSkew,
+		}
+		if len(rule.Mode) > 0 {
+			if compiled.strict, err = strictMode(rule.Mode); err != nil {
+				return nil, fmt.Errorf("validation rule %d: %w", i, err)
+			}
+		}
+		if _, err = path.Match(rule.Stable, ""); err != nil {
+			return nil, fmt.Errorf("validation rule %d: invalid stable %s", i, rule.Stable)
+		}
+		if len(rule.MetricPattern) > 0 {
+			if compiled.metricPattern, err = regexp.Compile("^(?:" + rule.MetricPattern + ")$"); err != nil {
+				return nil, fmt.Errorf("validation rule %d: %w", i, err)
+			}
+		}
+		v.rules = append(v.rules, compiled)
+	}
+	if len(conf.DeadLetter.Dir) > 0 {
+		if v.deadLetter, err = NewDeadLetter(conf.DeadLetter.Dir, conf.DeadLetter.MaxFiles); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func strictMode(mode string) (bool, error) {
+	switch mode {
+	case ValidationLenient, "":
+		return false, nil
+	case ValidationStrict:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown validation mode %q", mode)
+}
+
+// Handler makes the validator available to handlers of the request.
+func (v *Validator) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(validatorKey, v)
+		c.Next()
+	}
+}
+
+// check returns violations of records and whether the payload should be rejected.
+func (v *Validator) check(endpoint string, records []record) (violations []string, reject bool) {
+	now := v.now()
+	for _, rec := range records {
+		before := len(violations)
+		if len(rec.stable) == 0 {
+			violations = append(violations, "empty stable name")
+		}
+		for name, value := range rec.tags {
+			if len(value) == 0 {
+				violations = append(violations, fmt.Sprintf("%s: empty value of tag %s", rec.stable, name))
+			}
+		}
+		var ts time.Time
+		if len(rec.ts) == 0 {
+			violations = append(violations, fmt.Sprintf("%s: empty ts", rec.stable))
+		} else {
+			var err error
+			if ts, err = ParseTimestamp(rec.ts); err != nil {
+				violations = append(violations, fmt.Sprintf("%s: invalid ts %s", rec.stable, rec.ts))
+			}
+		}
+		reject = reject || (v.strict && len(violations) > before)
+		for _, rule := range v.rules {
+			if !rule.matches(endpoint, rec.stable) {
+				continue
+			}
+			before = len(violations)
+			violations = rule.check(rec, ts, now, violations)
+			reject = reject || (rule.strict && len(violations) > before)
+		}
+	}
+	sort.Strings(violations)
+	return violations, reject
+}
+
+func (v *Validator) count(endpoint string, rejected bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	stats, ok := v.stats[endpoint]
+	if !ok {
+		stats = &ValidationStats{}
+		v.stats[endpoint] = stats
+	}
+	stats.Invalid++
+	if rejected {
+		stats.Rejected++
+	}
+}
+
+// Stats returns validation stats by endpoint.
+func (v *Validator) Stats() map[string]ValidationStats {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	stats := make(map[string]ValidationStats, len(v.stats))
+	for endpoint, s := range v.stats {
+		stats[endpoint] = *s
+	}
+	return stats
+}
+
+func validatorOf(c *gin.Context) *Validator {
+	value, _ := c.Get(validatorKey)
+	v, _ := value.(*Validator)
+	return v
+}
+
+// validate checks records of the payload data, it responds 400 and returns false if the payload is rejected.
+func validate(c *gin.Context, data []byte, qid uint64, records []record) bool {
+	v := validatorOf(c)
+	if v == nil {
+		return true
+	}
+	endpoint := c.FullPath()
+	violations, reject := v.check(endpoint, records)
+	if len(violations) == 0 {
+		return true
+	}
+	if !reject {
+		v.count(endpoint, false)
+		validationLogger.WithFields(logrus.Fields{config.ReqIDKey: qid}).
+			Warnf("invalid payload of %s from %s, violations:%s", endpoint, c.ClientIP(), strings.Join(violations, "; "))
+		return true
+	}
+	rejected(c, data, qid, violations...)
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "reasons": violations})
+	return false
+}
+
+// rejected counts the rejected payload data and stores it as a dead letter, the caller responds.
+func rejected(c *gin.Context, data []byte, qid uint64, reasons ...string) {
+	v := validatorOf(c)
+	if v == nil {
+		return
+	}
+	endpoint := c.FullPath()
+	v.count(endpoint, true)
+	validationLogger.WithFields(logrus.Fields{config.ReqIDKey: qid}).
+		Errorf("reject payload of %s from %s, reasons:%s", endpoint, c.ClientIP(), strings.Join(reasons, "; "))
+	if v.deadLetter == nil {
+		return
+	}
+	err := v.deadLetter.Store(DeadLetterEntry{
+		Time:     v.now(),
+		Endpoint: endpoint,
+		ClientIP: c.ClientIP(),
+		QID:      qid,
+		Reasons:  reasons,
+		Payload:  string(data),
+	})
+	if err != nil {
+		validationLogger.Errorf("store dead letter error, msg:%s", err)
+	}
+}
+
+// DeadLetterEntry is a rejected payload, Payload can be posted to Endpoint again to replay it.
+type DeadLetterEntry struct {
+	Time     time.Time `json:"time"`
+	Endpoint string    `json:"endpoint"`
+	ClientIP string    `json:"client_ip"`
+	QID      uint64    `json:"qid"`
+	Reasons  []string  `json:"reasons"`
+	Payload  string    `json:"payload"`
+}
+
+// DeadLetter stores rejected payloads in a directory, a json file for each. The oldest files are removed when
+// there are more than maxFiles.
+type DeadLetter struct {
+	lock     sync.Mutex
+	dir      string
+	maxFiles int
+	// seq tells apart entries of the same time and QID
+	seq uint64
+}
+
+func NewDeadLetter(dir string, maxFiles int) (*DeadLetter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create dead letter dir error, %w", err)
+	}
+	return &DeadLetter{dir: dir, maxFiles: maxFiles}, nil
+}
+
+// Store writes entry to a file named by its time, QID and a sequence, so that files are listed in order of time.
+func (d *DeadLetter) Store(entry DeadLetterEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.seq++
+	name := fmt.Sprintf("%s_%016x_%d.json", entry.Time.UTC().Format("20060102T150405.000000000"), entry.QID, d.seq)
+	if err = os.WriteFile(filepath.Join(d.dir, name), data, 0644); err != nil {
+		return err
+	}
+	if d.maxFiles <= 0 {
+		return nil
+	}
+	files, err := d.files()
+	if err != nil {
+		return err
+	}
+	for len(files) > d.maxFiles {
+		if err = os.Remove(filepath.Join(d.dir, files[0])); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// files returns names of stored files from the oldest.
+func (d *DeadLetter) files() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+// validationRouter validates general metric payloads and records whether the handler writes them.
+func validationRouter(v *Validator, written *bool) *gin.Engine {
+	router := gin.New()
+	router.POST("/general-metric", v.Handler(), func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		var request []StableArrayInfo
+		if err := json.Unmarshal(data, &request); err != nil {
+			rejected(c, data, 1, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !validate(c, data, 1, metricsRecords(request)) {
+			return
+		}
+		*written = true
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	return router
+}
+
+const invalidMetrics = `[{"ts":"abc","protocol":2,"tables":[{"name":"taosd_dnodes_info","metric_groups":[` +
+	`{"tags":[{"name":"cluster_id","value":""}],"metrics":[{"name":"uptime","value":1}]}]}]}]`
+
+func TestValidatorLenient(t *testing.T) {
+	v, err := NewValidator(config.ValidationConfig{Mode: ValidationLenient})
+	assert.NoError(t, err)
+	var written bool
+	w := httptest.NewRecorder()
+	validationRouter(v, &written).ServeHTTP(w,
+		httptest.NewRequest(http.MethodPost, "/general-metric", strings.NewReader(invalidMetrics)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, written)
+	assert.Equal(t, map[string]ValidationStats{"/general-metric": {Invalid: 1}}, v.Stats())
+}
+
+func TestValidatorStrict(t *testing.T) {
+	dir := t.TempDir()
+	v, err := NewValidator(config.ValidationConfig{
+		Mode:       ValidationStrict,
+		DeadLetter: config.DeadLetterConfig{Dir: dir, MaxFiles: 10},
+	})
+	assert.NoError(t, err)
+	v.now = func() time.Time { return time.Unix(1703226836, 0) }
+	var written bool
+	router := validationRouter(v, &written)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/general-metric", strings.NewReader(invalidMetrics)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, written)
+	var resp struct {
+		Reasons []string `json:"reasons"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"taosd_dnodes_info: empty value of tag cluster_id", "taosd_dnodes_info: invalid ts abc"},
+		resp.Reasons)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/general-metric", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, map[string]ValidationStats{"/general-metric": {Invalid: 2, Rejected: 2}}, v.Stats())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	// the first file is the payload with violations
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	var entry DeadLetterEntry
+	assert.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "/general-metric", entry.Endpoint)
+	assert.Equal(t, uint64(1), entry.QID)
+	assert.Equal(t, resp.Reasons, entry.Reasons)
+	assert.Equal(t, invalidMetrics, entry.Payload)
+}
+
+func TestValidatorRules(t *testing.T) {
+	v, err := NewValidator(config.ValidationConfig{Rule: []config.ValidationRule{
+		{Stable: "taosd_*", Mode: ValidationStrict, RequiredTags: []string{"cluster_id", "dnode_id"}},
+		{Endpoint: "/general-metric", MetricPattern: "[a-z_]+", MaxSkew: time.Hour},
+	}})
+	assert.NoError(t, err)
+	now := time.Unix(1703226836, 0)
+	v.now = func() time.Time { return now }
+	ts := "1703226836000"
+
+	violations, reject := v.check("/general-metric", []record{{stable: "taosd_dnodes_info",
+		tags: map[string]string{"cluster_id": "1", "dnode_id": "1"}, metrics: []string{"uptime"}, ts: ts}})
+	assert.Empty(t, violations)
+	assert.False(t, reject)
+
+	violations, reject = v.check("/general-metric", []record{{stable: "taosd_dnodes_info",
+		tags: map[string]string{"cluster_id": "1"}, metrics: []string{"uptime"}, ts: ts}})
+	assert.Equal(t, []string{"taosd_dnodes_info: missing tag dnode_id"}, violations)
+	assert.True(t, reject)
+
+	violations, reject = v.check("/general-metric", []record{{stable: "taosx_sys",
+		metrics: []string{"Mem-Total"}, ts: now.Add(2 * time.Hour).Format(time.RFC3339)}})
+	assert.Equal(t, []string{
+		"taosx_sys: metric name Mem-Total not matching ^(?:[a-z_]+)$",
+		"taosx_sys: ts 2023-12-22T08:33:56Z differs from now by -2h0m0s",
+	}, violations)
+	assert.False(t, reject)
+
+	violations, _ = v.check("/adapter_report", []record{{stable: "adapter_requests", metrics: []string{"Mem"},
+		ts: "0"}})
+	assert.Empty(t, violations)
+
+	_, err = NewValidator(config.ValidationConfig{Mode: "loose"})
+	assert.Error(t, err)
+	_, err = NewValidator(config.ValidationConfig{Rule: []config.ValidationRule{{MetricPattern: "("}}})
+	assert.Error(t, err)
+	_, err = NewValidator(config.ValidationConfig{Rule: []config.ValidationRule{{Stable: "["}}})
+	assert.Error(t, err)
+}
+
+func TestDeadLetterRotation(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDeadLetter(dir, 2)
+	assert.NoError(t, err)
+	start := time.Unix(1703226836, 0)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, d.Store(DeadLetterEntry{Time: start.Add(time.Duration(i) * time.Second), QID: uint64(i)}))
+	}
+	files, err := d.files()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20231222T063357.000000000_0000000000000001_2.json",
+		"20231222T063358.000000000_0000000000000002_3.json"}, files)
+}
@@ -9,7 +9,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"strconv"
 	"sync"
 	"time"
 
@@ -18,7 +17,9 @@ import (
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/lineprotocol"
 	"github.com/taosdata/taoskeeper/util/pool"
+	"github.com/taosdata/taoskeeper/util/retry"
 )
 
 var logger = log.GetLogger("CMD")
@@ -32,6 +33,8 @@ type Command struct {
 	username string
 	password string
 	url      *url.URL
+	// writeTimeout is the deadline of a line protocol write including retries
+	writeTimeout time.Duration
 }
 
 func NewCommand(conf *config.Config) *Command {
@@ -52,22 +55,23 @@ func NewCommand(conf *config.Config) *Command {
 		},
 	}
 
-	conn, err := db.NewConnectorWithDb(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host, conf.TDengine.Port, conf.Metrics.Database.Name, conf.TDengine.Usessl)
+	conn, err := db.DefaultManager.Get(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host, conf.TDengine.Port, conf.Metrics.Database.Name, conf.TDengine.Usessl)
 	if err != nil {
 		logger.Errorf("init db connect error, msg:%s", err)
 		panic(err)
 	}
 
 	imp := &Command{
-		client:   client,
-		conn:     conn,
-		username: conf.TDengine.Username,
-		password: conf.TDengine.Password,
+		client:       client,
+		conn:         conn,
+		username:     conf.TDengine.Username,
+		password:     conf.TDengine.Password,
+		writeTimeout: conf.Timeout.Write,
 		url: &url.URL{
 			Scheme:   "http",
 			Host:     fmt.Sprintf("%s:%d", conf.TDengine.Host, conf.TDengine.Port),
 			Path:     "/influxdb/v1/write",
-			RawQuery: fmt.Sprintf("db=%s&precision=ms", conf.Metrics.Database.Name),
+			RawQuery: fmt.Sprintf("db=%s&precision=%s", conf.Metrics.Database.Name, lineprotocol.Millisecond),
 		},
 	}
 	return imp
@@ -231,9 +235,10 @@ func (cmd *Command) TransferDataToDest(data *db.Data, dstTable string, tagNum in
 		return
 	}
 
+	enc := lineprotocol.NewEncoder(&buf, lineprotocol.Millisecond)
 	for _, row := range data.Data {
 		// get one row here
-		buf.WriteString(dstTable)
+		enc.StartLine(dstTable)
 
 		// write tags
 		var tag string
@@ -252,41 +257,36 @@ func (cmd *Command) TransferDataToDest(data *db.Data, dstTable string, tagNum in
 			}
 
 			if tag != "" {
-				buf.WriteString(fmt.Sprintf(",%s=%s", data.Head[j], util.EscapeInfluxProtocol(tag)))
+				enc.AddTag(data.Head[j], tag)
 			} else {
-				buf.WriteString(fmt.Sprintf(",%s=%s", data.Head[j], "unknown"))
+				enc.AddTag(data.Head[j], "unknown")
 				logger.Errorf("tag value is empty, tag_name:%s", data.Head[j])
 			}
 		}
-		buf.WriteString(" ")
 
-		// write metrics
+		// write metrics, all of them are double in destination stables
 		for j := tagNum; j < len(row)-1; j++ {
-
 			switch v := row[j].(type) {
 			case int:
-				buf.WriteString(fmt.Sprintf("%s=%ff64", data.Head[j], float64(v)))
+				enc.AddFloat(data.Head[j], float64(v))
 			case int32:
-				buf.WriteString(fmt.Sprintf("%s=%ff64", data.Head[j], float64(v)))
+				enc.AddFloat(data.Head[j], float64(v))
 			case int64:
-				buf.WriteString(fmt.Sprintf("%s=%ff64", data.Head[j], float64(v)))
+				enc.AddFloat(data.Head[j], float64(v))
 			case float32:
-				buf.WriteString(fmt.Sprintf("%s=%sf64", data.Head[j], strconv.FormatFloat(float64(v), 'f', -1, 64)))
+				enc.AddFloat(data.Head[j], float64(v))
 			case float64:
-				buf.WriteString(fmt.Sprintf("%s=%sf64", data.Head[j], strconv.FormatFloat(v, 'f', -1, 64)))
+				enc.AddFloat(data.Head[j], v)
 			default:
 				panic(fmt.Sprintf("Unexpected type for row[%d]: %T", j, row[j]))
 			}
-
-			if j != len(row)-2 {
-				buf.WriteString(",")
-			}
 		}
 
 		// write timestamp
-		buf.WriteString(" ")
-		buf.WriteString(fmt.Sprintf("%v", row[len(row)-1].(time.Time).UnixMilli()))
-		buf.WriteString("\n")
+		if err := enc.EndLine(row[len(row)-1].(time.Time)); err != nil {
+			logger.Errorf("encode row of %s error, msg:%s", dstTable, err)
+			continue
+		}
 
 		if buf.Len() >= MAX_SQL_LEN {
 			if logger.Logger.IsLevelEnabled(logrus.TraceLevel) {
@@ -429,6 +429,25 @@ func (cmd *Command) TransferTableToDst(sql string, dstTable string, tagNum int)
 }
 
 func (cmd *Command) lineWriteBody(buf *bytes.Buffer) error {
+	ctx := context.Background()
+	if cmd.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.writeTimeout)
+		defer cancel()
+	}
+	body := buf.Bytes()
+	return retry.Default().Do(ctx, retry.Idempotent, func(ctx context.Context) error {
+		return cmd.write(ctx, body)
+	})
+}
+
+// write sends line protocol body once through circuit breaker, 5xx responses are temporary errors.
+func (cmd *Command) write(ctx context.Context, body []byte) (err error) {
+	if err = db.DefaultBreaker.Allow(); err != nil {
+		return err
+	}
+	defer func() { db.DefaultBreaker.Done(err) }()
+
 	header := map[string][]string{
 		"Connection": {"keep-alive"},
 	}
@@ -442,9 +461,10 @@ func (cmd *Command) lineWriteBody(buf *bytes.Buffer) error {
 		Header:     header,
 		Host:       cmd.url.Host,
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(cmd.username, cmd.password)
 
-	req.Body = io.NopCloser(buf)
+	req.Body = io.NopCloser(bytes.NewReader(body))
 	resp, err := cmd.client.Do(req)
 
 	if err != nil {
@@ -454,8 +474,12 @@ func (cmd *Command) lineWriteBody(buf *bytes.Buffer) error {
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code %d:body:%s", resp.StatusCode, string(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		err = fmt.Errorf("unexpected status code %d:body:%s", resp.StatusCode, string(respBody))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = retry.Temporary(err)
+		}
+		return err
 	}
 	return nil
 }
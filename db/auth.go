@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	taosError "github.com/taosdata/driver-go/v3/errors"
+	"github.com/taosdata/taoskeeper/util"
+)
+
+// AuthError is returned by Connector when TDengine rejects the credentials.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return "authentication failure: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+func IsAuthError(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr)
+}
+
+// TSDB_CODE_MND_AUTH_FAILURE, returned by TDengine when it rejects the credentials
+const authFailureCode = 0x0357
+
+// isAuthFailure returns true if TDengine rejects the credentials, or taosAdapter responds 401 to the restful driver.
+func isAuthFailure(err error) bool {
+	var taosErr *taosError.TaosError
+	if errors.As(err, &taosErr) {
+		return taosErr.Code == authFailureCode
+	}
+	return restStatus(err) == http.StatusUnauthorized
+}
+
+// credentials shared by connectors, connectors created with them reconnect when they change
+var credentials struct {
+	sync.RWMutex
+	username string
+	password string
+	version  uint64
+}
+
+// SetCredentials sets credentials used by connectors, connectors reconnect on next call if changed.
+func SetCredentials(username, password string) {
+	credentials.Lock()
+	defer credentials.Unlock()
+	if credentials.version > 0 && credentials.username == username && credentials.password == password {
+		return
+	}
+	credentials.username = username
+	credentials.password = password
+	credentials.version++
+	if credentials.version > 1 {
+		dbLogger.Infof("credentials changed, user:%s", username)
+	}
+}
+
+// Credentials returns credentials set by SetCredentials.
+func Credentials() (username, password string) {
+	username, password, _ = currentCredentials()
+	return username, password
+}
+
+func currentCredentials() (username, password string, version uint64) {
+	credentials.RLock()
+	defer credentials.RUnlock()
+	return credentials.username, credentials.password, credentials.version
+}
+
+// authState is set when TDengine rejected credentials and cleared when any call succeeded
+var authState struct {
+	failed  int32
+	lastErr atomic.Value
+}
+
+// NewAuthError marks authentication failure state and returns err as AuthError.
+func NewAuthError(err error) error {
+	if atomic.CompareAndSwapInt32(&authState.failed, 0, 1) {
+		dbLogger.Errorf("authentication failure, keeper is degraded until re-authenticated, error:%s", err)
+	}
+	authState.lastErr.Store(err)
+	return &AuthError{Err: err}
+}
+
+func markAuthOK() {
+	if atomic.CompareAndSwapInt32(&authState.failed, 1, 0) {
+		dbLogger.Info("re-authenticated, keeper recovered from authentication failure")
+	}
+}
+
+// AuthFailed returns the latest authentication error, nil if not in authentication failure state.
+func AuthFailed() error {
+	if atomic.LoadInt32(&authState.failed) == 0 {
+		return nil
+	}
+	err, _ := authState.lastErr.Load().(error)
+	return err
+}
+
+// StartReauth tries credentials returned by load every interval while in authentication failure state.
+func StartReauth(ctx context.Context, interval time.Duration, host string, port int, usessl bool,
+	load func() (username, password string, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if AuthFailed() == nil {
+			continue
+		}
+		username, password, err := load()
+		if err != nil {
+			dbLogger.Errorf("load credentials error, msg:%s", err)
+			continue
+		}
+		if err = tryAuth(ctx, username, password, host, port, usessl); err != nil {
+			dbLogger.Errorf("re-authenticate error, user:%s, msg:%s", username, err)
+			continue
+		}
+		SetCredentials(username, password)
+		markAuthOK()
+	}
+}
+
+func tryAuth(ctx context.Context, username, password, host string, port int, usessl bool) error {
+	conn, err := newConnector(username, password, host, port, "", usessl, false)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Query(ctx, "select server_version()", util.GetQidOwn())
+	return err
+}
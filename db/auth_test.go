@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestAuthError(t *testing.T) {
+	defer markAuthOK()
+	assert.NoError(t, AuthFailed())
+
+	cause := errors.New("[0x357] Authentication failure")
+	err := fmt.Errorf("insert error: %w", NewAuthError(cause))
+	assert.True(t, IsAuthError(err))
+	assert.ErrorIs(t, err, cause)
+	assert.False(t, IsAuthError(cause))
+	assert.Equal(t, cause, AuthFailed())
+
+	markAuthOK()
+	assert.NoError(t, AuthFailed())
+}
+
+func TestConnectorFollowCredentials(t *testing.T) {
+	config.Conf = &config.Config{}
+	SetCredentials("root", "taosdata")
+	defer SetCredentials("root", "taosdata")
+
+	conn, err := NewConnector("root", "taosdata", "127.0.0.1", 6041, false)
+	assert.NoError(t, err)
+	defer conn.Close()
+	other, err := NewConnector("other", "secret", "127.0.0.1", 6041, false)
+	assert.NoError(t, err)
+	defer other.Close()
+	assert.True(t, conn.follow)
+	assert.False(t, other.follow)
+
+	db := conn.getDB()
+	assert.Same(t, db, conn.getDB())
+
+	SetCredentials("root", "newpassword")
+	assert.NotSame(t, db, conn.getDB())
+	assert.Equal(t, "newpassword", conn.password)
+	assert.Equal(t, "secret", other.password)
+	assert.Same(t, other.db, other.getDB())
+}
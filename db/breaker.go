@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+// ErrBreakerOpen is returned without calling TDengine while the circuit breaker is open.
+var ErrBreakerOpen = errors.New("circuit breaker is open, TDengine backend is unavailable")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker opens after failureThreshold consecutive backend failures and rejects calls for openTimeout, then lets
+// halfOpenRequests calls probe the backend, it closes if they succeed and opens again if any fails.
+type Breaker struct {
+	lock             sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+	probes      int
+	transitions map[BreakerState]uint64
+	rejected    uint64
+	now         func() time.Time
+}
+
+type BreakerStats struct {
+	State       BreakerState
+	Transitions map[BreakerState]uint64
+	Rejected    uint64
+}
+
+// DefaultBreaker guards all calls to TDengine backend, it is disabled until configured.
+var DefaultBreaker = NewBreaker(0, 0, 0)
+
+// NewBreaker creates a breaker, failureThreshold <= 0 disables it.
+func NewBreaker(failureThreshold int, openTimeout time.Duration, halfOpenRequests int) *Breaker {
+	b := &Breaker{transitions: map[BreakerState]uint64{}, now: time.Now}
+	b.Configure(failureThreshold, openTimeout, halfOpenRequests)
+	return b
+}
+
+func (b *Breaker) Configure(failureThreshold int, openTimeout time.Duration, halfOpenRequests int) {
+	if halfOpenRequests < 1 {
+		halfOpenRequests = 1
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failureThreshold = failureThreshold
+	b.openTimeout = openTimeout
+	b.halfOpenRequests = halfOpenRequests
+}
+
+// Allow returns ErrBreakerOpen if the call should fail fast, else Done must be called with the call result.
+func (b *Breaker) Allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+	switch b.state {
+	case BreakerOpen:
+		b.rejected++
+		return ErrBreakerOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.halfOpenRequests {
+			b.rejected++
+			return ErrBreakerOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Done records the result of a call allowed by Allow. Calls canceled by the caller tell nothing about the backend,
+// they change no state and a canceled probe frees its slot.
+func (b *Breaker) Done(err error) {
+	failure := isBackendFailure(err)
+	canceled := !failure && errors.Is(err, context.Canceled)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failureThreshold <= 0 {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		if canceled {
+			return
+		}
+		if !failure {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		switch {
+		case failure:
+			b.setState(BreakerOpen)
+		case canceled:
+			if b.probes > 0 {
+				b.probes--
+			}
+		default:
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// State returns current state, open breaker reports half-open once openTimeout passed.
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	state := b.State()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	transitions := make(map[BreakerState]uint64, len(b.transitions))
+	for s, n := range b.transitions {
+		transitions[s] = n
+	}
+	return BreakerStats{State: state, Transitions: transitions, Rejected: b.rejected}
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	dbLogger.Warnf("circuit breaker of TDengine backend changed from %s to %s, consecutive failures:%d", b.state,
+		state, b.failures)
+	b.state = state
+	b.transitions[state]++
+	b.failures = 0
+	b.probes = 0
+	if state == BreakerOpen {
+		b.openedAt = b.now()
+	}
+}
+
+// IsBackendError returns true if err means TDengine backend is unreachable or unavailable, including calls rejected by
+// the open circuit breaker. Errors returned by TDengine for the statement, such as bad values, are not.
+func IsBackendError(err error) bool {
+	return errors.Is(err, ErrBreakerOpen) || isBackendFailure(err)
+}
+
+// isBackendFailure returns true if err means backend is unavailable or overloaded, errors returned by TDengine
+// such as syntax error or authentication failure are not counted.
+func isBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || retry.Retryable(err, retry.Idempotent)
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute, 1)
+	b.now = func() time.Time { return now }
+	backendErr := &net.OpError{Op: "read", Err: errors.New("connection reset")}
+
+	// errors returned by server do not open breaker
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Allow())
+		b.Done(errors.New("[0x2603] Table does not exist"))
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Done(backendErr)
+	}
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrBreakerOpen)
+
+	// half-open lets one probe through, a failed probe opens it again
+	now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrBreakerOpen)
+	b.Done(retry.Temporary(errors.New("server response: 503 Service Unavailable")))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Done(nil)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	stats := b.Stats()
+	assert.Equal(t, uint64(2), stats.Transitions[BreakerOpen])
+	assert.Equal(t, uint64(2), stats.Transitions[BreakerHalfOpen])
+	assert.Equal(t, uint64(1), stats.Transitions[BreakerClosed])
+	assert.Equal(t, uint64(2), stats.Rejected)
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := NewBreaker(0, time.Minute, 1)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, b.Allow())
+		b.Done(context.DeadlineExceeded)
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestIsBackendError(t *testing.T) {
+	assert.True(t, IsBackendError(ErrBreakerOpen))
+	assert.True(t, IsBackendError(fmt.Errorf("write: %w", ErrBreakerOpen)))
+	assert.True(t, IsBackendError(context.DeadlineExceeded))
+	assert.True(t, IsBackendError(retry.Temporary(errors.New("server response: 502 Bad Gateway"))))
+	assert.False(t, IsBackendError(nil))
+	assert.False(t, IsBackendError(errors.New("invalid data")))
+}
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(1, time.Minute, 1)
+	b.now = func() time.Time { return now }
+	assert.NoError(t, b.Allow())
+	b.Done(context.DeadlineExceeded)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Done(fmt.Errorf("query: %w", context.Canceled))
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	// the slot of the canceled probe is free again
+	assert.NoError(t, b.Allow())
+	b.Done(nil)
+	assert.Equal(t, BreakerClosed, b.State())
+}
@@ -3,23 +3,49 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/taosdata/driver-go/v3/common"
+	taosError "github.com/taosdata/driver-go/v3/errors"
 
 	_ "github.com/taosdata/driver-go/v3/taosRestful"
+	_ "github.com/taosdata/driver-go/v3/taosWS"
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/retry"
 )
 
 type Connector struct {
-	db *sql.DB
+	lock     sync.RWMutex
+	db       *sql.DB
+	username string
+	password string
+	host     string
+	port     int
+	dbname   string
+	usessl   bool
+	protocol string
+	// skipVerify skips certificate verification of websocket connections of protocol ws
+	skipVerify bool
+	// follow means connector was created with shared credentials and reconnects when they change
+	follow  bool
+	version uint64
+	// shared connectors are handed out by Manager, Close does nothing and Manager closes them
+	shared  bool
+	manager *Manager
+	// inserter writes rows by Insert
+	inserter inserter
 }
 
 type Data struct {
@@ -29,69 +55,236 @@ type Data struct {
 
 var dbLogger = log.GetLogger("DB ")
 
-func NewConnector(username, password, host string, port int, usessl bool) (*Connector, error) {
-	var protocol string
-	if usessl {
-		protocol = "https"
-	} else {
-		protocol = "http"
-	}
-	dbLogger := dbLogger.WithFields(logrus.Fields{config.ReqIDKey: util.GetQidOwn()})
-	dbLogger.Tracef("connect to adapter, host:%s, port:%d, usessl:%v", host, port, usessl)
+const (
+	// ProtocolREST sends each statement as a http request to taosAdapter
+	ProtocolREST = "rest"
+	// ProtocolWS keeps websocket sessions to taosAdapter
+	ProtocolWS = "ws"
+)
 
-	db, err := sql.Open("taosRestful", fmt.Sprintf("%s:%s@%s(%s:%d)/?skipVerify=true", username, password, protocol, host, port))
-	if err != nil {
-		dbLogger.Errorf("connect to adapter failed, host:%s, port:%d, usessl:%v, error:%s", host, port, usessl, err)
-		return nil, err
+// protocol used by connectors created afterwards
+var protocol atomic.Value
+
+func init() {
+	protocol.Store(ProtocolREST)
+}
+
+// SetProtocol sets protocol of connectors created afterwards, "rest" or "ws".
+func SetProtocol(p string) error {
+	switch p {
+	case ProtocolREST, ProtocolWS:
+		protocol.Store(p)
+		return nil
 	}
+	return fmt.Errorf("unknown TDengine protocol %q, should be %q or %q", p, ProtocolREST, ProtocolWS)
+}
+
+func currentProtocol() string {
+	return protocol.Load().(string)
+}
 
-	dbLogger.Tracef("connect to adapter success, host:%s, port:%d, usessl:%v", host, port, usessl)
-	return &Connector{db: db}, nil
+func NewConnector(username, password, host string, port int, usessl bool) (*Connector, error) {
+	return newConnector(username, password, host, port, "", usessl, true)
 }
 
 func NewConnectorWithDb(username, password, host string, port int, dbname string, usessl bool) (*Connector, error) {
-	var protocol string
-	if usessl {
-		protocol = "https"
-	} else {
-		protocol = "http"
-	}
+	return newConnector(username, password, host, port, dbname, usessl, true)
+}
 
+func newConnector(username, password, host string, port int, dbname string, usessl bool, follow bool) (*Connector, error) {
 	dbLogger := dbLogger.WithFields(logrus.Fields{config.ReqIDKey: util.GetQidOwn()})
-	dbLogger.Tracef("connect to adapter, host:%s, port:%d, usessl:%v", host, port, usessl)
+	c := &Connector{username: username, password: password, host: host, port: port, dbname: dbname, usessl: usessl,
+		protocol: currentProtocol()}
+	c.skipVerify = currentWSSkipVerify()
+	dbLogger.Tracef("connect to adapter, host:%s, port:%d, db:%s, usessl:%v, protocol:%s", host, port, dbname, usessl,
+		c.protocol)
 
-	db, err := sql.Open("taosRestful", fmt.Sprintf("%s:%s@%s(%s:%d)/%s?skipVerify=true", username, password, protocol, host, port, dbname))
+	if follow {
+		sharedUsername, sharedPassword, version := currentCredentials()
+		c.follow = version > 0 && sharedUsername == username && sharedPassword == password
+		c.version = version
+	}
+	db, err := c.open()
 	if err != nil {
 		dbLogger.Errorf("connect to adapter failed, host:%s, port:%d, db:%s, usessl:%v, error:%s", host, port, dbname, usessl, err)
 		return nil, err
 	}
+	c.db = db
 
 	dbLogger.Tracef("connect to adapter success, host:%s, port:%d, db:%s, usessl:%v", host, port, dbname, usessl)
-	return &Connector{db: db}, nil
+	return c, nil
+}
+
+func (c *Connector) open() (*sql.DB, error) {
+	driver, scheme := "taosRestful", "http"
+	if c.protocol == ProtocolWS {
+		driver, scheme = "taosWS", "ws"
+		if c.usessl && c.skipVerify {
+			skipWSVerify(c.host)
+		}
+	}
+	if c.usessl {
+		scheme += "s"
+	}
+	return sql.Open(driver, fmt.Sprintf("%s:%s@%s(%s:%d)/%s?skipVerify=true", c.username, c.password,
+		scheme, c.host, c.port, c.dbname))
+}
+
+// getDB returns the database handle, reopened with shared credentials if they changed.
+func (c *Connector) getDB() *sql.DB {
+	if !c.follow {
+		return c.db
+	}
+	username, password, version := currentCredentials()
+	c.lock.RLock()
+	db := c.db
+	changed := version != c.version
+	c.lock.RUnlock()
+	if !changed {
+		return db
+	}
+
+	// read pool config before locking connector, Manager.Configure locks them in the other order
+	pool := PoolConfig{}
+	if c.manager != nil {
+		pool = c.manager.poolConfig()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if version == c.version {
+		return c.db
+	}
+	c.username, c.password, c.version = username, password, version
+	newDB, err := c.open()
+	if err != nil {
+		dbLogger.Errorf("reconnect to adapter failed, host:%s, port:%d, db:%s, error:%s", c.host, c.port, c.dbname, err)
+		return c.db
+	}
+	pool.apply(newDB)
+	_ = c.db.Close()
+	c.db = newDB
+	return c.db
+}
+
+// deadlines of Query and Exec in nanoseconds including retries, zero means no deadline
+var (
+	queryTimeout int64
+	execTimeout  int64
+)
+
+// SetTimeouts sets deadlines of Query and Exec, the earlier one of ctx deadline and them is used.
+func SetTimeouts(query, exec time.Duration) {
+	atomic.StoreInt64(&queryTimeout, int64(query))
+	atomic.StoreInt64(&execTimeout, int64(exec))
 }
 
+func withTimeout(ctx context.Context, timeout *int64) (context.Context, context.CancelFunc) {
+	if d := time.Duration(atomic.LoadInt64(timeout)); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// idempotency classifies sql, keeper always inserts with timestamp so insert is idempotent.
+func idempotency(sql string) retry.Idempotency {
+	sql = strings.ToLower(strings.TrimSpace(sql))
+	switch {
+	case strings.HasPrefix(sql, "select"), strings.HasPrefix(sql, "show"), strings.HasPrefix(sql, "desc"),
+		strings.HasPrefix(sql, "insert"):
+		return retry.Idempotent
+	case strings.HasPrefix(sql, "create"):
+		if strings.Contains(sql, "if not exists") {
+			return retry.Idempotent
+		}
+	case strings.HasPrefix(sql, "drop"):
+		if strings.Contains(sql, "if exists") {
+			return retry.Idempotent
+		}
+	}
+	return retry.NonIdempotent
+}
+
+// TDengine error codes of network failures between taosAdapter and TDengine
+var unavailableCodes = map[int32]bool{
+	0x000B: true, // TSDB_CODE_RPC_NETWORK_UNAVAIL
+	0x0018: true, // TSDB_CODE_RPC_BROKEN_LINK
+	0x0019: true, // TSDB_CODE_RPC_TIMEOUT
+	0x0020: true, // TSDB_CODE_RPC_SOMENODE_NOT_CONNECTED
+	0x0021: true, // TSDB_CODE_RPC_MAX_SESSIONS
+	0x0022: true, // TSDB_CODE_RPC_NETWORK_ERROR
+	0x0023: true, // TSDB_CODE_RPC_NETWORK_BUSY
+}
+
+// isServerUnavailable returns true if TDengine is unreachable from taosAdapter, the websocket connection to
+// taosAdapter is lost, or taosAdapter or a proxy in front of it responds 5xx.
+func isServerUnavailable(err error) bool {
+	var taosErr *taosError.TaosError
+	if errors.As(err, &taosErr) {
+		return unavailableCodes[taosErr.Code]
+	}
+	// taosWS.BadConnError unwraps to driver.ErrBadConn
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	return restStatus(err) >= http.StatusInternalServerError
+}
+
+// restResponsePrefix starts errors of the restful driver for non-200 responses
+const restResponsePrefix = "server response: "
+
+// restStatus returns the http status of a non-200 response of the restful driver, 0 for other errors. The driver has
+// no error type for them and reports the status only in the message, "server response: <status> - <body>".
+func restStatus(err error) int {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, restResponsePrefix) {
+		return 0
+	}
+	fields := strings.Fields(msg[len(restResponsePrefix):])
+	if len(fields) == 0 {
+		return 0
+	}
+	status, _ := strconv.Atoi(fields[0])
+	return status
+}
+
+// Exec executes sql with retry policy, it returns AuthError if TDengine rejects credentials.
 func (c *Connector) Exec(ctx context.Context, sql string, qid uint64) (int64, error) {
+	ctx, cancel := withTimeout(ctx, &execTimeout)
+	defer cancel()
+	var rowsAffected int64
+	err := retry.Default().Do(ctx, idempotency(sql), func(ctx context.Context) (err error) {
+		rowsAffected, err = c.exec(ctx, sql, qid)
+		return err
+	})
+	return rowsAffected, err
+}
+
+func (c *Connector) exec(ctx context.Context, sql string, qid uint64) (int64, error) {
 	dbLogger := dbLogger.WithFields(logrus.Fields{config.ReqIDKey: qid})
 	ctx = context.WithValue(ctx, common.ReqIDKey, int64(qid))
 
 	dbLogger.Tracef("call adapter to execute sql:%s", sql)
+	if err := DefaultBreaker.Allow(); err != nil {
+		return 0, err
+	}
 	startTime := time.Now()
-	res, err := c.db.ExecContext(ctx, sql)
+	res, err := c.getDB().ExecContext(ctx, sql)
+	if err != nil && isServerUnavailable(err) {
+		err = retry.Temporary(err)
+	}
+	DefaultBreaker.Done(err)
 
 	endTime := time.Now()
 	latency := endTime.Sub(startTime)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "Authentication failure") {
-			dbLogger.Error("Authentication failure")
-			ctxLog, cancelLog := context.WithTimeout(context.Background(), 3*time.Second)
-			defer cancelLog()
-			log.Close(ctxLog)
-			os.Exit(1)
+		if isAuthFailure(err) {
+			return 0, NewAuthError(err)
 		}
 		dbLogger.Errorf("latency:%v, sql:%s, err:%s", latency, sql, err)
 		return 0, err
 	}
+	markAuthOK()
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
@@ -118,29 +311,45 @@ func logData(data *Data, logger *logrus.Entry) {
 	logger.Tracef("query result data:%s", jsonData)
 }
 
+// Query executes query with retry policy, it returns AuthError if TDengine rejects credentials.
 func (c *Connector) Query(ctx context.Context, sql string, qid uint64) (*Data, error) {
+	ctx, cancel := withTimeout(ctx, &queryTimeout)
+	defer cancel()
+	var data *Data
+	err := retry.Default().Do(ctx, idempotency(sql), func(ctx context.Context) (err error) {
+		data, err = c.query(ctx, sql, qid)
+		return err
+	})
+	return data, err
+}
+
+func (c *Connector) query(ctx context.Context, sql string, qid uint64) (*Data, error) {
 	dbLogger := dbLogger.WithFields(logrus.Fields{config.ReqIDKey: qid})
 	ctx = context.WithValue(ctx, common.ReqIDKey, int64(qid))
 
 	dbLogger.Tracef("call adapter to execute query, sql:%s", sql)
 
+	if err := DefaultBreaker.Allow(); err != nil {
+		return nil, err
+	}
 	startTime := time.Now()
-	rows, err := c.db.QueryContext(ctx, sql)
+	rows, err := c.getDB().QueryContext(ctx, sql)
+	if err != nil && isServerUnavailable(err) {
+		err = retry.Temporary(err)
+	}
+	DefaultBreaker.Done(err)
 
 	endTime := time.Now()
 	latency := endTime.Sub(startTime)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "Authentication failure") {
-			dbLogger.Error("Authentication failure")
-			ctxLog, cancelLog := context.WithTimeout(context.Background(), 3*time.Second)
-			defer cancelLog()
-			log.Close(ctxLog)
-			os.Exit(1)
+		if isAuthFailure(err) {
+			return nil, NewAuthError(err)
 		}
 		dbLogger.Errorf("latency:%v, sql:%s, err:%s", latency, sql, err)
 		return nil, err
 	}
+	markAuthOK()
 
 	dbLogger.Tracef("response ok, latency:%v, sql:%s", latency, sql)
 
@@ -172,6 +381,17 @@ func (c *Connector) Query(ctx context.Context, sql string, qid uint64) (*Data, e
 	return data, nil
 }
 
+// Close closes the connector, it does nothing if the connector is shared by Manager.
 func (c *Connector) Close() error {
+	if c.shared {
+		return nil
+	}
+	return c.closeDB()
+}
+
+func (c *Connector) closeDB() error {
+	c.closeStmtConnector()
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.db.Close()
 }
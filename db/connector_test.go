@@ -0,0 +1,99 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	taosError "github.com/taosdata/driver-go/v3/errors"
+	"github.com/taosdata/driver-go/v3/taosRestful"
+	"github.com/taosdata/driver-go/v3/taosWS"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+func TestIdempotency(t *testing.T) {
+	assert.Equal(t, retry.Idempotent, idempotency(" SELECT server_version()"))
+	assert.Equal(t, retry.Idempotent, idempotency("insert into t values (1700000000000, 1)"))
+	assert.Equal(t, retry.Idempotent, idempotency("create database if not exists log"))
+	assert.Equal(t, retry.Idempotent, idempotency("drop table if exists t"))
+	assert.Equal(t, retry.NonIdempotent, idempotency("create table t (ts timestamp, v int)"))
+	assert.Equal(t, retry.NonIdempotent, idempotency("alter table t add column v2 int"))
+}
+
+func TestProtocol(t *testing.T) {
+	config.Conf = &config.Config{}
+	defer func() { _ = SetProtocol(ProtocolREST) }()
+
+	rest, err := NewConnector("root", "taosdata", "127.0.0.1", 6041, false)
+	assert.NoError(t, err)
+	defer rest.Close()
+	assert.IsType(t, &taosRestful.TDengineDriver{}, rest.getDB().Driver())
+
+	assert.NoError(t, SetProtocol(ProtocolWS))
+	ws, err := NewConnectorWithDb("root", "taosdata", "127.0.0.1", 6041, "log", true)
+	assert.NoError(t, err)
+	defer ws.Close()
+	assert.IsType(t, &taosWS.TDengineDriver{}, ws.getDB().Driver())
+
+	assert.Error(t, SetProtocol("native"))
+	assert.Equal(t, ProtocolWS, currentProtocol())
+}
+
+func TestClassifyErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+		auth        bool
+	}{
+		{name: "rest 503", err: errors.New("server response: 503 Service Unavailable - "), unavailable: true},
+		{name: "rest 401", err: errors.New("server response: 401 Unauthorized - {}"), auth: true},
+		{name: "rest bad request", err: errors.New("server response: 400 Bad Request - Authentication failure")},
+		{name: "auth failure", err: taosError.NewError(0x0357, "Authentication failure"), auth: true},
+		{name: "network unavailable", err: taosError.NewError(0x000B, "Unable to establish connection"),
+			unavailable: true},
+		{name: "table not exist", err: taosError.NewError(0x2603, "Table does not exist")},
+		{name: "ws connection lost", err: taosWS.NewBadConnError(io.EOF), unavailable: true},
+		{name: "ws closed", err: driver.ErrBadConn, unavailable: true},
+		{name: "ws auth failure", err: fmt.Errorf("exec: %w", taosError.NewError(0x0357, "Authentication failure")),
+			auth: true},
+		{name: "ws timeout", err: taosError.NewError(0x0019, "Conn read timeout"), unavailable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.unavailable, isServerUnavailable(tt.err))
+			assert.Equal(t, tt.auth, isAuthFailure(tt.err))
+		})
+	}
+}
+
+func TestWSSkipVerify(t *testing.T) {
+	config.Conf = &config.Config{}
+	defer func() { _ = SetProtocol(ProtocolREST) }()
+	defer SetWSSkipVerify(false)
+
+	// certificates are verified unless skipped explicitly
+	assert.NoError(t, SetProtocol(ProtocolWS))
+	verified, err := NewConnector("root", "taosdata", "verified.local", 6041, true)
+	assert.NoError(t, err)
+	defer verified.Close()
+	assert.False(t, verified.skipVerify)
+
+	SetWSSkipVerify(true)
+	skipped, err := NewConnector("root", "taosdata", "skipped.local", 6041, true)
+	assert.NoError(t, err)
+	defer skipped.Close()
+	assert.True(t, skipped.skipVerify)
+
+	cert := &x509.Certificate{}
+	assert.NoError(t, verifyWSConnection(tls.ConnectionState{ServerName: "skipped.local",
+		PeerCertificates: []*x509.Certificate{cert}}))
+	assert.Error(t, verifyWSConnection(tls.ConnectionState{ServerName: "verified.local",
+		PeerCertificates: []*x509.Certificate{cert}}))
+}
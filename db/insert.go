@@ -0,0 +1,854 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/driver-go/v3/common"
+	"github.com/taosdata/driver-go/v3/common/param"
+	taosError "github.com/taosdata/driver-go/v3/errors"
+	"github.com/taosdata/driver-go/v3/types"
+	"github.com/taosdata/driver-go/v3/ws/stmt"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util/retry"
+)
+
+// Row is a row of child table Table of super table STable at Ts, which is a string in RFC3339, time.Time or epoch in
+// precision of the database. If Tags is set, Table is created with the tags if not exists.
+//
+// Tags and Columns are structs or pointers to structs, a field tagged `taos:"name"` is written to the tag or
+// column of the name, fields without the tag are ignored and embedded structs are flattened. If Prefix is set,
+// only fields whose names start with it are written, to the column named without it, so one struct can hold
+// columns of several rows.
+type Row struct {
+	STable  string
+	Table   string
+	Tags    interface{}
+	Ts      interface{}
+	Columns interface{}
+	Prefix  string
+}
+
+type field struct {
+	name  string
+	index []int
+}
+
+var fieldsCache sync.Map
+
+// fieldsOf returns tagged fields of struct type t in declaration order.
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := f.Tag.Lookup("taos")
+		if !ok && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range fieldsOf(f.Type) {
+				fields = append(fields, field{name: embedded.name, index: append([]int{i}, embedded.index...)})
+			}
+			continue
+		}
+		if !ok || name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, field{name: name, index: []int{i}})
+	}
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// structValues returns names without prefix and values of fields of struct v whose names start with prefix.
+func structValues(v interface{}, prefix string) ([]string, []reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil, fmt.Errorf("nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("%s is not a struct", rv.Type())
+	}
+	var names []string
+	var values []reflect.Value
+	for _, f := range fieldsOf(rv.Type()) {
+		if !strings.HasPrefix(f.name, prefix) {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(f.name, prefix))
+		values = append(values, rv.FieldByIndex(f.index))
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("no field of %s tagged with prefix %q", rv.Type(), prefix)
+	}
+	return names, values, nil
+}
+
+// column is a column or tag of a super table described by TDengine.
+type column struct {
+	// typ is the type name of describe, such as INT UNSIGNED or NCHAR
+	typ    string
+	length int
+}
+
+var bindTypes = map[string]reflect.Type{
+	"TIMESTAMP":         types.TaosTimestampType,
+	"BOOL":              types.TaosBoolType,
+	"TINYINT":           types.TaosTinyintType,
+	"SMALLINT":          types.TaosSmallintType,
+	"INT":               types.TaosIntType,
+	"BIGINT":            types.TaosBigintType,
+	"TINYINT UNSIGNED":  types.TaosUTinyintType,
+	"SMALLINT UNSIGNED": types.TaosUSmallintType,
+	"INT UNSIGNED":      types.TaosUIntType,
+	"BIGINT UNSIGNED":   types.TaosUBigintType,
+	"FLOAT":             types.TaosFloatType,
+	"DOUBLE":            types.TaosDoubleType,
+	"BINARY":            types.TaosBinaryType,
+	"VARCHAR":           types.TaosBinaryType,
+	"NCHAR":             types.TaosNcharType,
+}
+
+// bindType returns the type of values bound to the column.
+func (c column) bindType() (*types.ColumnType, error) {
+	t, ok := bindTypes[c.typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported column type %s", c.typ)
+	}
+	return &types.ColumnType{Type: t, MaxLen: c.length}, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// value converts v to the value bound to the column, nil pointers, NaN and infinite floats are bound as NULL.
+func (c column) value(v reflect.Value, precision int) (driver.Value, error) {
+	if !v.IsValid() {
+		return nil, fmt.Errorf("nil value")
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, nil
+		}
+	}
+	switch c.typ {
+	case "TIMESTAMP":
+		t, err := timeValue(v, precision)
+		if err != nil {
+			return nil, err
+		}
+		return types.TaosTimestamp{T: t, Precision: precision}, nil
+	case "BOOL":
+		if v.Kind() != reflect.Bool {
+			break
+		}
+		return types.TaosBool(v.Bool()), nil
+	case "TINYINT", "SMALLINT", "INT", "BIGINT":
+		n, err := intValue(v, c.typ)
+		if err != nil {
+			return nil, err
+		}
+		switch c.typ {
+		case "TINYINT":
+			return types.TaosTinyint(n), nil
+		case "SMALLINT":
+			return types.TaosSmallint(n), nil
+		case "INT":
+			return types.TaosInt(n), nil
+		}
+		return types.TaosBigint(n), nil
+	case "TINYINT UNSIGNED", "SMALLINT UNSIGNED", "INT UNSIGNED", "BIGINT UNSIGNED":
+		n, err := uintValue(v, c.typ)
+		if err != nil {
+			return nil, err
+		}
+		switch c.typ {
+		case "TINYINT UNSIGNED":
+			return types.TaosUTinyint(n), nil
+		case "SMALLINT UNSIGNED":
+			return types.TaosUSmallint(n), nil
+		case "INT UNSIGNED":
+			return types.TaosUInt(n), nil
+		}
+		return types.TaosUBigint(n), nil
+	case "FLOAT", "DOUBLE":
+		var f float64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f = v.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(v.Uint())
+		default:
+			return nil, fmt.Errorf("cannot bind %s to %s", v.Type(), c.typ)
+		}
+		if c.typ == "FLOAT" {
+			return types.TaosFloat(f), nil
+		}
+		return types.TaosDouble(f), nil
+	case "BINARY", "VARCHAR":
+		if v.Kind() != reflect.String {
+			break
+		}
+		return types.TaosBinary(v.String()), nil
+	case "NCHAR":
+		if v.Kind() != reflect.String {
+			break
+		}
+		return types.TaosNchar(v.String()), nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", c.typ)
+	}
+	return nil, fmt.Errorf("cannot bind %s to %s", v.Type(), c.typ)
+}
+
+// intBits are sizes of signed integer types, unsigned ones have the same sizes
+var intBits = map[string]uint{"TINYINT": 8, "SMALLINT": 16, "INT": 32, "BIGINT": 64}
+
+func intValue(v reflect.Value, typ string) (int64, error) {
+	var n int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows %s", v.Uint(), typ)
+		}
+		n = int64(v.Uint())
+	default:
+		return 0, fmt.Errorf("cannot bind %s to %s", v.Type(), typ)
+	}
+	if bits := intBits[typ]; bits < 64 && (n < -1<<(bits-1) || n >= 1<<(bits-1)) {
+		return 0, fmt.Errorf("%d overflows %s", n, typ)
+	}
+	return n, nil
+}
+
+func uintValue(v reflect.Value, typ string) (uint64, error) {
+	var n uint64
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = v.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, fmt.Errorf("%d overflows %s", v.Int(), typ)
+		}
+		n = uint64(v.Int())
+	default:
+		return 0, fmt.Errorf("cannot bind %s to %s", v.Type(), typ)
+	}
+	if bits := intBits[strings.TrimSuffix(typ, " UNSIGNED")]; bits < 64 && n >= 1<<bits {
+		return 0, fmt.Errorf("%d overflows %s", n, typ)
+	}
+	return n, nil
+}
+
+// timeValue converts a string in RFC3339, time.Time or epoch in precision to time.
+func timeValue(v reflect.Value, precision int) (time.Time, error) {
+	if v.Type() == timeType {
+		if !v.CanInterface() {
+			return time.Time{}, fmt.Errorf("unexported time field")
+		}
+		return v.Interface().(time.Time), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return time.Parse(time.RFC3339Nano, v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return common.TimestampConvertToTime(v.Int(), precision), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot bind %s to TIMESTAMP", v.Type())
+}
+
+// tableSchema is columns and tags of a super table by name.
+type tableSchema struct {
+	columns map[string]column
+	tags    map[string]column
+}
+
+// parseSchema reads result of `describe`, whose columns are field, type, length and note.
+func parseSchema(data *Data) (*tableSchema, error) {
+	schema := &tableSchema{columns: map[string]column{}, tags: map[string]column{}}
+	for _, row := range data.Data {
+		if len(row) < 4 {
+			return nil, fmt.Errorf("unexpected describe result %v", row)
+		}
+		name, _ := row[0].(string)
+		typ, _ := row[1].(string)
+		length, err := intOf(row[2])
+		if err != nil {
+			return nil, fmt.Errorf("length of %s: %w", name, err)
+		}
+		c := column{typ: strings.ToUpper(typ), length: length}
+		if note, _ := row[3].(string); note == "TAG" {
+			schema.tags[name] = c
+		} else {
+			schema.columns[name] = c
+		}
+	}
+	if len(schema.columns) == 0 {
+		return nil, fmt.Errorf("no column described")
+	}
+	return schema, nil
+}
+
+func intOf(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int32:
+		return int(n), nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	}
+	return 0, fmt.Errorf("unexpected %T", v)
+}
+
+// tableBatch is rows of a child table bound to a statement.
+type tableBatch struct {
+	sql         string
+	stable      string
+	table       string
+	tagNames    []string
+	tags        *param.Param
+	tagTypes    *param.ColumnType
+	columnNames []string
+	rows        [][]driver.Value
+	columnTypes *param.ColumnType
+}
+
+// params returns rows of the batch by column.
+func (b *tableBatch) params() []*param.Param {
+	params := make([]*param.Param, len(b.rows[0]))
+	for i := range params {
+		params[i] = param.NewParam(len(b.rows))
+		for _, row := range b.rows {
+			params[i].AddValue(row[i])
+		}
+	}
+	return params
+}
+
+// bindValues returns the bound values and their types of names, which are columns or tags of stable in schema.
+func bindValues(schema map[string]column, names []string, values []reflect.Value, precision int) ([]driver.Value,
+	[]*types.ColumnType, error) {
+	bound := make([]driver.Value, len(names))
+	boundTypes := make([]*types.ColumnType, len(names))
+	for i, name := range names {
+		c, ok := schema[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("no column or tag %s", name)
+		}
+		var err error
+		if boundTypes[i], err = c.bindType(); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if bound[i], err = c.value(values[i], precision); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return bound, boundTypes, nil
+}
+
+// quoteNames returns names quoted by backquotes and separated by commas.
+func quoteNames(names []string) string {
+	return "`" + strings.Join(names, "`, `") + "`"
+}
+
+// placeholders returns n placeholders separated by commas.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// bindRow binds row to a statement of the super table described by schema.
+func bindRow(row Row, schema *tableSchema, precision int) (*tableBatch, error) {
+	b := &tableBatch{stable: row.STable, table: row.Table}
+	var sql strings.Builder
+	sql.WriteString("insert into ? using ")
+	sql.WriteString(row.STable)
+	if strings.ContainsRune(row.Table, '`') {
+		return nil, fmt.Errorf("invalid table name %s", row.Table)
+	}
+	if row.Tags != nil {
+		names, values, err := structValues(row.Tags, "")
+		if err != nil {
+			return nil, fmt.Errorf("tags: %w", err)
+		}
+		tags, tagTypes, err := bindValues(schema.tags, names, values, precision)
+		if err != nil {
+			return nil, fmt.Errorf("tags: %w", err)
+		}
+		b.tags = param.NewParam(len(tags))
+		for _, tag := range tags {
+			b.tags.AddValue(tag)
+		}
+		b.tagTypes = param.NewColumnTypeWithValue(tagTypes)
+		b.tagNames = names
+		fmt.Fprintf(&sql, " (%s) tags (%s)", quoteNames(names), placeholders(len(names)))
+	}
+	names, values, err := structValues(row.Columns, row.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("columns: %w", err)
+	}
+	names = append([]string{"ts"}, names...)
+	values = append([]reflect.Value{reflect.ValueOf(row.Ts)}, values...)
+	columns, columnTypes, err := bindValues(schema.columns, names, values, precision)
+	if err != nil {
+		return nil, fmt.Errorf("columns: %w", err)
+	}
+	b.rows = [][]driver.Value{columns}
+	b.columnNames = names
+	b.columnTypes = param.NewColumnTypeWithValue(columnTypes)
+	fmt.Fprintf(&sql, " (%s) values (%s)", quoteNames(names), placeholders(len(names)))
+	b.sql = sql.String()
+	return b, nil
+}
+
+// bindRows binds rows by child table, rows of a table with the same columns are written together. Rows failing to
+// bind are left out and their errors are returned by table.
+func bindRows(rows []Row, schemaOf func(stable string) (*tableSchema, error), precision int) ([]*tableBatch,
+	map[string]error) {
+	var batches []*tableBatch
+	byTable := map[string]*tableBatch{}
+	failed := map[string]error{}
+	for _, row := range rows {
+		if len(row.Table) == 0 || len(row.STable) == 0 {
+			failed[row.Table] = fmt.Errorf("table or super table of row is empty")
+			continue
+		}
+		if _, ok := failed[row.Table]; ok {
+			continue
+		}
+		schema, err := schemaOf(row.STable)
+		if err != nil {
+			failed[row.Table] = fmt.Errorf("describe %s: %w", row.STable, err)
+			continue
+		}
+		b, err := bindRow(row, schema, precision)
+		if err != nil {
+			failed[row.Table] = err
+			continue
+		}
+		key := b.table + "\x00" + b.sql
+		if batch, ok := byTable[key]; ok {
+			batch.rows = append(batch.rows, b.rows...)
+			continue
+		}
+		byTable[key] = b
+		batches = append(batches, b)
+	}
+	return batches, failed
+}
+
+// restSQL returns the insert of b for protocol rest, which has no statements. Values bound to b are written as
+// literals, strings are quoted and escaped.
+func (b *tableBatch) restSQL() string {
+	var sql strings.Builder
+	fmt.Fprintf(&sql, "insert into `%s` using %s", b.table, b.stable)
+	if b.tags != nil {
+		fmt.Fprintf(&sql, " (%s) tags ", quoteNames(b.tagNames))
+		writeLiterals(&sql, b.tags.GetValues())
+	}
+	fmt.Fprintf(&sql, " (%s) values", quoteNames(b.columnNames))
+	for _, row := range b.rows {
+		sql.WriteByte(' ')
+		writeLiterals(&sql, row)
+	}
+	return sql.String()
+}
+
+// writeLiterals writes values bound by bindValues as a parenthesized list of SQL literals.
+func writeLiterals(sql *strings.Builder, values []driver.Value) {
+	sql.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(literal(v))
+	}
+	sql.WriteByte(')')
+}
+
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// literal returns v bound by bindValues as a SQL literal.
+func literal(v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case types.TaosTimestamp:
+		return strconv.FormatInt(common.TimeToTimestamp(v.T, v.Precision), 10)
+	case types.TaosBool:
+		return strconv.FormatBool(bool(v))
+	case types.TaosTinyint:
+		return strconv.FormatInt(int64(v), 10)
+	case types.TaosSmallint:
+		return strconv.FormatInt(int64(v), 10)
+	case types.TaosInt:
+		return strconv.FormatInt(int64(v), 10)
+	case types.TaosBigint:
+		return strconv.FormatInt(int64(v), 10)
+	case types.TaosUTinyint:
+		return strconv.FormatUint(uint64(v), 10)
+	case types.TaosUSmallint:
+		return strconv.FormatUint(uint64(v), 10)
+	case types.TaosUInt:
+		return strconv.FormatUint(uint64(v), 10)
+	case types.TaosUBigint:
+		return strconv.FormatUint(uint64(v), 10)
+	case types.TaosFloat:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case types.TaosDouble:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case types.TaosBinary:
+		return "'" + literalEscaper.Replace(string(v)) + "'"
+	case types.TaosNchar:
+		return "'" + literalEscaper.Replace(string(v)) + "'"
+	}
+	panic(fmt.Sprintf("unexpected bound value %T", v))
+}
+
+// inserter writes rows of a connector with protocol ws with statements prepared on a websocket connection to
+// taosAdapter, values are bound to statements and never written into them.
+type inserter struct {
+	lock     sync.Mutex
+	conn     *stmt.Connector
+	username string
+	password string
+	// precision of the database, loaded by the first write
+	precision       int
+	precisionLoaded bool
+	// schemas of super tables by name
+	schemas sync.Map
+}
+
+// stmtConnector returns the websocket connection with current credentials, it is opened if not yet or lost.
+func (c *Connector) stmtConnector() (*stmt.Connector, error) {
+	// getDB reloads shared credentials
+	c.getDB()
+	c.lock.RLock()
+	username, password := c.username, c.password
+	c.lock.RUnlock()
+
+	in := &c.inserter
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	if in.conn != nil && in.username == username && in.password == password {
+		return in.conn, nil
+	}
+	if in.conn != nil {
+		_ = in.conn.Close()
+		in.conn = nil
+	}
+	scheme := "ws"
+	if c.usessl {
+		scheme = "wss"
+		if c.skipVerify {
+			skipWSVerify(c.host)
+		}
+	}
+	conf := stmt.NewConfig(fmt.Sprintf("%s://%s:%d", scheme, c.host, c.port), 0)
+	_ = conf.SetConnectUser(username)
+	_ = conf.SetConnectPass(password)
+	_ = conf.SetConnectDB(c.dbname)
+	if timeout := time.Duration(atomic.LoadInt64(&execTimeout)); timeout >= time.Second {
+		_ = conf.SetMessageTimeout(timeout)
+	}
+	conf.SetErrorHandler(func(conn *stmt.Connector, err error) {
+		dbLogger.Errorf("websocket connection of statements lost, host:%s, port:%d, error:%s", c.host, c.port, err)
+		c.dropStmtConnector(conn)
+	})
+	conn, err := stmt.NewConnector(conf)
+	if err != nil {
+		return nil, err
+	}
+	in.conn, in.username, in.password = conn, username, password
+	return conn, nil
+}
+
+// dropStmtConnector closes conn, the next write opens a new connection if conn is the current one.
+func (c *Connector) dropStmtConnector(conn *stmt.Connector) {
+	in := &c.inserter
+	in.lock.Lock()
+	if in.conn == conn {
+		in.conn = nil
+	}
+	in.lock.Unlock()
+	_ = conn.Close()
+}
+
+func (c *Connector) closeStmtConnector() {
+	in := &c.inserter
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	if in.conn != nil {
+		_ = in.conn.Close()
+		in.conn = nil
+	}
+}
+
+var precisions = map[string]int{
+	"ms": common.PrecisionMilliSecond,
+	"us": common.PrecisionMicroSecond,
+	"ns": common.PrecisionNanoSecond,
+}
+
+// precision returns the precision of the database, it is loaded once.
+func (c *Connector) precision(ctx context.Context, qid uint64) (int, error) {
+	in := &c.inserter
+	in.lock.Lock()
+	p, loaded := in.precision, in.precisionLoaded
+	in.lock.Unlock()
+	if loaded {
+		return p, nil
+	}
+	if len(c.dbname) == 0 {
+		return 0, fmt.Errorf("no database to insert into")
+	}
+	data, err := c.Query(ctx, fmt.Sprintf("select `precision` from information_schema.ins_databases where name = '%s'",
+		c.dbname), qid)
+	if err != nil {
+		return 0, err
+	}
+	if len(data.Data) == 0 || len(data.Data[0]) == 0 {
+		return 0, fmt.Errorf("database %s not found", c.dbname)
+	}
+	name, _ := data.Data[0][0].(string)
+	p, ok := precisions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown precision %q of database %s", name, c.dbname)
+	}
+	in.lock.Lock()
+	in.precision, in.precisionLoaded = p, true
+	in.lock.Unlock()
+	return p, nil
+}
+
+// schema returns columns and tags of super table stable, they are described once until a write to it fails.
+func (c *Connector) schema(ctx context.Context, stable string, qid uint64) (*tableSchema, error) {
+	if schema, ok := c.inserter.schemas.Load(stable); ok {
+		return schema.(*tableSchema), nil
+	}
+	data, err := c.Query(ctx, "describe "+stable, qid)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := parseSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	c.inserter.schemas.Store(stable, schema)
+	return schema, nil
+}
+
+// preparedStmt is a statement prepared on conn.
+type preparedStmt struct {
+	conn *stmt.Connector
+	stmt *stmt.Stmt
+}
+
+// InsertError is returned by Insert when some tables failed, the others are written.
+type InsertError struct {
+	// Failed are errors of failed tables by name
+	Failed map[string]error
+	// Tables is the count of all tables written
+	Tables int
+	first  error
+}
+
+func (e *InsertError) Error() string {
+	return fmt.Sprintf("insert %d of %d tables failed: %s", len(e.Failed), e.Tables, e.first)
+}
+
+func (e *InsertError) Unwrap() error {
+	return e.first
+}
+
+// Partial reports whether some tables are written.
+func (e *InsertError) Partial() bool {
+	return len(e.Failed) < e.Tables
+}
+
+// Insert writes rows with statements prepared for each super table and columns, values are bound to them. With
+// protocol rest, which has no statements, the bound values are written as escaped literals through the REST
+// connection, so no websocket is opened. Each child table is written on its own, a failed one does not stop the
+// others. If any table fails, InsertError with the error of the first one is returned after all tables are written.
+func (c *Connector) Insert(ctx context.Context, rows []Row, qid uint64) (int64, error) {
+	dbLogger := dbLogger.WithFields(logrus.Fields{config.ReqIDKey: qid})
+	precision, err := c.precision(ctx, qid)
+	if err != nil {
+		return 0, err
+	}
+	batches, failed := bindRows(rows, func(stable string) (*tableSchema, error) {
+		return c.schema(ctx, stable, qid)
+	}, precision)
+	for table, err := range failed {
+		dbLogger.Errorf("bind rows of table %s error, msg:%s", table, err)
+	}
+
+	stmts := map[string]*preparedStmt{}
+	defer func() {
+		for _, s := range stmts {
+			_ = s.stmt.Close()
+		}
+	}()
+	var affected int64
+	for _, b := range batches {
+		var n int64
+		var err error
+		if c.protocol == ProtocolWS {
+			n, err = c.writeBatch(ctx, stmts, b, qid)
+		} else {
+			n, err = c.writeRESTBatch(ctx, b, qid)
+		}
+		affected += n
+		if err != nil {
+			dbLogger.Errorf("insert into table %s error, msg:%s", b.table, err)
+			failed[b.table] = err
+		}
+	}
+	if len(failed) == 0 {
+		return affected, nil
+	}
+	tables := map[string]bool{}
+	var firstErr error
+	for _, row := range rows {
+		tables[row.Table] = true
+		if err, ok := failed[row.Table]; ok && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return affected, &InsertError{Failed: failed, Tables: len(tables), first: firstErr}
+}
+
+// writeBatch writes b with retry policy and circuit breaker, it returns AuthError if TDengine rejects credentials.
+func (c *Connector) writeBatch(ctx context.Context, stmts map[string]*preparedStmt, b *tableBatch, qid uint64) (
+	int64, error) {
+	ctx, cancel := withTimeout(ctx, &execTimeout)
+	defer cancel()
+	var affected int64
+	err := retry.Default().Do(ctx, retry.Idempotent, func(ctx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := DefaultBreaker.Allow(); err != nil {
+			return err
+		}
+		startTime := time.Now()
+		n, err := c.execBatch(stmts, b)
+		if err != nil && (isServerUnavailable(err) || !isTaosError(err)) {
+			// errors other than ones returned by TDengine are of the websocket connection
+			err = retry.Temporary(err)
+		}
+		DefaultBreaker.Done(err)
+		if err != nil {
+			return err
+		}
+		dbLogger.WithFields(logrus.Fields{config.ReqIDKey: qid}).Tracef("insert into table %s ok, rows:%d, latency:%v",
+			b.table, len(b.rows), time.Since(startTime))
+		affected = n
+		return nil
+	})
+	if err != nil {
+		if isAuthFailure(err) {
+			return 0, NewAuthError(err)
+		}
+		if isTaosError(err) {
+			// the super table may be altered, describe it again for the next write
+			c.inserter.schemas.Delete(b.stable)
+		}
+		return 0, err
+	}
+	markAuthOK()
+	return affected, nil
+}
+
+// writeRESTBatch writes b through the REST connection, Exec applies retry policy and circuit breaker.
+func (c *Connector) writeRESTBatch(ctx context.Context, b *tableBatch, qid uint64) (int64, error) {
+	affected, err := c.Exec(ctx, b.restSQL(), qid)
+	if err != nil && isTaosError(err) {
+		// the super table may be altered, describe it again for the next write
+		c.inserter.schemas.Delete(b.stable)
+	}
+	return affected, err
+}
+
+// execBatch binds b to the statement prepared for its sql and executes it, the statement is closed if any step
+// fails because its state is unknown then.
+func (c *Connector) execBatch(stmts map[string]*preparedStmt, b *tableBatch) (int64, error) {
+	s, ok := stmts[b.sql]
+	if !ok {
+		conn, err := c.stmtConnector()
+		if err != nil {
+			return 0, err
+		}
+		st, err := conn.Init()
+		if err != nil {
+			if !isTaosError(err) {
+				c.dropStmtConnector(conn)
+			}
+			return 0, err
+		}
+		s = &preparedStmt{conn: conn, stmt: st}
+		if err = st.Prepare(b.sql); err != nil {
+			c.closeStmt(s, err)
+			return 0, err
+		}
+		stmts[b.sql] = s
+	}
+	err := s.stmt.SetTableName(b.table)
+	if err == nil && b.tags != nil {
+		err = s.stmt.SetTags(b.tags, b.tagTypes)
+	}
+	if err == nil {
+		err = s.stmt.BindParam(b.params(), b.columnTypes)
+	}
+	if err == nil {
+		err = s.stmt.AddBatch()
+	}
+	if err == nil {
+		err = s.stmt.Exec()
+	}
+	if err != nil {
+		delete(stmts, b.sql)
+		c.closeStmt(s, err)
+		return 0, err
+	}
+	return int64(s.stmt.GetAffectedRows()), nil
+}
+
+// closeStmt closes s failed with err, its connection is dropped too unless err is returned by TDengine.
+func (c *Connector) closeStmt(s *preparedStmt, err error) {
+	if isTaosError(err) {
+		_ = s.stmt.Close()
+		return
+	}
+	c.dropStmtConnector(s.conn)
+}
+
+// isTaosError returns true if err is returned by TDengine, other errors of statements are of the connection.
+func isTaosError(err error) bool {
+	var taosErr *taosError.TaosError
+	return errors.As(err, &taosErr)
+}
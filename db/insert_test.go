@@ -0,0 +1,211 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/driver-go/v3/common"
+	"github.com/taosdata/driver-go/v3/types"
+)
+
+type insertTags struct {
+	ID   int    `taos:"id"`
+	Name string `taos:"name"`
+}
+
+type insertBase struct {
+	Level int `taos:"level"`
+}
+
+type insertColumns struct {
+	insertBase
+	Status  string   `taos:"status"`
+	Rate    float32  `taos:"rate"`
+	Ratio   float64  `taos:"ratio"`
+	Count   uint64   `taos:"count"`
+	Ready   bool     `taos:"ready"`
+	Missing *int64   `taos:"missing"`
+	Nodes   []string `json:"nodes"`
+}
+
+func TestParseSchema(t *testing.T) {
+	schema, err := parseSchema(&Data{
+		Head: []string{"field", "type", "length", "note"},
+		Data: [][]interface{}{
+			{"ts", "TIMESTAMP", int32(8), ""},
+			{"status", "VARCHAR", int32(16), ""},
+			{"name", "NCHAR", int32(32), "TAG"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]column{"ts": {typ: "TIMESTAMP", length: 8}, "status": {typ: "VARCHAR", length: 16}},
+		schema.columns)
+	assert.Equal(t, map[string]column{"name": {typ: "NCHAR", length: 32}}, schema.tags)
+
+	_, err = parseSchema(&Data{})
+	assert.Error(t, err)
+}
+
+func TestBindRows(t *testing.T) {
+	schemas := map[string]*tableSchema{
+		"stb": {
+			columns: map[string]column{
+				"ts":      {typ: "TIMESTAMP", length: 8},
+				"level":   {typ: "TINYINT", length: 1},
+				"status":  {typ: "BINARY", length: 16},
+				"rate":    {typ: "FLOAT", length: 4},
+				"ratio":   {typ: "DOUBLE", length: 8},
+				"count":   {typ: "BIGINT UNSIGNED", length: 8},
+				"ready":   {typ: "BOOL", length: 1},
+				"missing": {typ: "BIGINT", length: 8},
+				"total":   {typ: "INT", length: 4},
+			},
+			tags: map[string]column{
+				"id":   {typ: "INT", length: 4},
+				"name": {typ: "NCHAR", length: 16},
+			},
+		},
+	}
+	schemaOf := func(stable string) (*tableSchema, error) {
+		if schema, ok := schemas[stable]; ok {
+			return schema, nil
+		}
+		return nil, fmt.Errorf("table %s does not exist", stable)
+	}
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []Row{{
+		STable:  "stb",
+		Table:   "t_1",
+		Tags:    insertTags{ID: 1, Name: "it's'); drop database log; --"},
+		Ts:      "2024-01-01T00:00:00Z",
+		Columns: &insertColumns{insertBase: insertBase{Level: 2}, Status: `a\b`, Rate: 0.5, Ratio: math.NaN(), Count: 3, Ready: true},
+	}, {
+		STable:  "stb",
+		Table:   "t_1",
+		Tags:    insertTags{ID: 1, Name: "it's'); drop database log; --"},
+		Ts:      ts.Add(time.Second),
+		Columns: &insertColumns{insertBase: insertBase{Level: 3}},
+	}, {
+		STable: "stb",
+		Table:  "t_2",
+		Ts:     ts.UnixMicro(),
+		Columns: struct {
+			RestTotal int `taos:"rest_total"`
+			WSTotal   int `taos:"ws_total"`
+		}{1, 2},
+		Prefix: "ws_",
+	}, {
+		STable:  "stb",
+		Table:   "t_overflow",
+		Ts:      ts,
+		Columns: insertBase{Level: 128},
+	}, {
+		STable: "stb",
+		Table:  "t_unknown",
+		Ts:     ts,
+		Columns: struct {
+			Unknown int `taos:"unknown"`
+		}{1},
+	}, {
+		STable:  "missing",
+		Table:   "t_missing",
+		Ts:      ts,
+		Columns: insertBase{},
+	}, {
+		STable:  "stb",
+		Table:   "t_no_ts",
+		Columns: insertBase{},
+	}}
+	batches, failed := bindRows(rows, schemaOf, common.PrecisionMicroSecond)
+	assert.Len(t, failed, 4)
+	for _, table := range []string{"t_overflow", "t_unknown", "t_missing", "t_no_ts"} {
+		assert.Error(t, failed[table], table)
+	}
+	if !assert.Len(t, batches, 2) {
+		return
+	}
+
+	// values are bound to placeholders, statements hold only names of super tables, tags and columns
+	b := batches[0]
+	assert.Equal(t, "stb", b.stable)
+	assert.Equal(t, "t_1", b.table)
+	assert.Equal(t, "insert into ? using stb (`id`, `name`) tags (?, ?) "+
+		"(`ts`, `level`, `status`, `rate`, `ratio`, `count`, `ready`, `missing`) values (?, ?, ?, ?, ?, ?, ?, ?)", b.sql)
+	assert.Equal(t, []driver.Value{types.TaosInt(1), types.TaosNchar("it's'); drop database log; --")},
+		b.tags.GetValues())
+	assert.Equal(t, [][]driver.Value{
+		{types.TaosTimestamp{T: ts, Precision: common.PrecisionMicroSecond}, types.TaosTinyint(2), types.TaosBinary(`a\b`),
+			types.TaosFloat(0.5), nil, types.TaosUBigint(3), types.TaosBool(true), nil},
+		{types.TaosTimestamp{T: ts.Add(time.Second), Precision: common.PrecisionMicroSecond}, types.TaosTinyint(3),
+			types.TaosBinary(""), types.TaosFloat(0), types.TaosDouble(0), types.TaosUBigint(0), types.TaosBool(false), nil},
+	}, b.rows)
+	// protocol rest writes bound values as escaped literals
+	assert.Equal(t, "insert into `t_1` using stb (`id`, `name`) tags (1, 'it\\'s\\'); drop database log; --') "+
+		"(`ts`, `level`, `status`, `rate`, `ratio`, `count`, `ready`, `missing`) values "+
+		"(1704067200000000, 2, 'a\\\\b', 0.5, NULL, 3, true, NULL) "+
+		"(1704067201000000, 3, '', 0, 0, 0, false, NULL)", b.restSQL())
+	params := b.params()
+	assert.Len(t, params, 8)
+	assert.Equal(t, []driver.Value{types.TaosTinyint(2), types.TaosTinyint(3)}, params[1].GetValues())
+	columnTypes, err := b.columnTypes.GetValue()
+	assert.NoError(t, err)
+	assert.Equal(t, &types.ColumnType{Type: types.TaosBinaryType, MaxLen: 16}, columnTypes[2])
+
+	b = batches[1]
+	assert.Equal(t, "insert into ? using stb (`ts`, `total`) values (?, ?)", b.sql)
+	assert.Equal(t, "insert into `t_2` using stb (`ts`, `total`) values (1704067200000000, 2)", b.restSQL())
+	assert.Nil(t, b.tags)
+	if assert.Len(t, b.rows, 1) {
+		// epoch is in precision of the database
+		assert.True(t, ts.Equal(b.rows[0][0].(types.TaosTimestamp).T))
+		assert.Equal(t, types.TaosInt(2), b.rows[0][1])
+	}
+}
+
+func TestColumnValue(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+		want  driver.Value
+		err   bool
+	}{
+		{typ: "SMALLINT", value: int64(-32768), want: types.TaosSmallint(-32768)},
+		{typ: "SMALLINT", value: 32768, err: true},
+		{typ: "INT UNSIGNED", value: 7, want: types.TaosUInt(7)},
+		{typ: "INT UNSIGNED", value: -1, err: true},
+		{typ: "TINYINT UNSIGNED", value: uint(256), err: true},
+		{typ: "BIGINT", value: uint64(math.MaxUint64), err: true},
+		{typ: "DOUBLE", value: math.Inf(1), want: nil},
+		{typ: "DOUBLE", value: uint32(5), want: types.TaosDouble(5)},
+		{typ: "NCHAR", value: 1, err: true},
+		{typ: "BOOL", value: "true", err: true},
+		{typ: "TIMESTAMP", value: "now", err: true},
+		{typ: "JSON", value: "{}", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.typ, tt.value), func(t *testing.T) {
+			v, err := column{typ: tt.typ}.value(reflect.ValueOf(tt.value), common.PrecisionMilliSecond)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func TestInsertError(t *testing.T) {
+	first := fmt.Errorf("invalid value")
+	err := &InsertError{Failed: map[string]error{"t1": first}, Tables: 2, first: first}
+	assert.EqualError(t, err, "insert 1 of 2 tables failed: invalid value")
+	assert.ErrorIs(t, err, first)
+	assert.True(t, err.Partial())
+	err.Failed["t2"] = first
+	assert.False(t, err.Partial())
+}
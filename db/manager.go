@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PoolConfig tunes the connection pool of sql.DB of each connector, zero value keeps database/sql default.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (p PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+type connectorKey struct {
+	username   string
+	password   string
+	host       string
+	port       int
+	dbname     string
+	usessl     bool
+	protocol   string
+	skipVerify bool
+}
+
+// Manager hands out connectors shared by the whole process, one for each database. Close of a shared connector
+// does nothing, they are closed by Manager.Close.
+type Manager struct {
+	lock       sync.Mutex
+	pool       PoolConfig
+	connectors map[connectorKey]*Connector
+	closed     bool
+}
+
+type ConnectorStats struct {
+	Database string
+	sql.DBStats
+}
+
+// DefaultManager is the connection manager of keeper.
+var DefaultManager = NewManager(PoolConfig{})
+
+func NewManager(pool PoolConfig) *Manager {
+	return &Manager{pool: pool, connectors: map[connectorKey]*Connector{}}
+}
+
+// Configure sets pool config of all connectors, including ones already handed out.
+func (m *Manager) Configure(pool PoolConfig) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.pool = pool
+	for _, c := range m.connectors {
+		c.lock.RLock()
+		pool.apply(c.db)
+		c.lock.RUnlock()
+	}
+}
+
+func (m *Manager) poolConfig() PoolConfig {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.pool
+}
+
+// Get returns the shared connector of database, dbname can be empty for statements not bound to a database.
+func (m *Manager) Get(username, password, host string, port int, dbname string, usessl bool) (*Connector, error) {
+	key := connectorKey{username: username, password: password, host: host, port: port, dbname: dbname, usessl: usessl,
+		protocol: currentProtocol()}
+	key.skipVerify = currentWSSkipVerify()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil, fmt.Errorf("connection manager is closed")
+	}
+	if c, ok := m.connectors[key]; ok {
+		return c, nil
+	}
+	c, err := newConnector(username, password, host, port, dbname, usessl, true)
+	if err != nil {
+		return nil, err
+	}
+	c.shared = true
+	c.manager = m
+	m.pool.apply(c.db)
+	m.connectors[key] = c
+	return c, nil
+}
+
+// Stats returns pool stats of each database, ordered by database name.
+func (m *Manager) Stats() []ConnectorStats {
+	m.lock.Lock()
+	connectors := make([]*Connector, 0, len(m.connectors))
+	for _, c := range m.connectors {
+		connectors = append(connectors, c)
+	}
+	m.lock.Unlock()
+
+	stats := map[string]sql.DBStats{}
+	for _, c := range connectors {
+		c.lock.RLock()
+		s := c.db.Stats()
+		c.lock.RUnlock()
+		// connectors of the same database with different credentials are summed up
+		sum := stats[c.dbname]
+		sum.MaxOpenConnections = s.MaxOpenConnections
+		sum.OpenConnections += s.OpenConnections
+		sum.InUse += s.InUse
+		sum.Idle += s.Idle
+		sum.WaitCount += s.WaitCount
+		sum.WaitDuration += s.WaitDuration
+		sum.MaxIdleClosed += s.MaxIdleClosed
+		sum.MaxIdleTimeClosed += s.MaxIdleTimeClosed
+		sum.MaxLifetimeClosed += s.MaxLifetimeClosed
+		stats[c.dbname] = sum
+	}
+	result := make([]ConnectorStats, 0, len(stats))
+	for database, s := range stats {
+		result = append(result, ConnectorStats{Database: database, DBStats: s})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Database < result[j].Database })
+	return result
+}
+
+// Close closes all shared connectors, Get fails after Close.
+func (m *Manager) Close() error {
+	m.lock.Lock()
+	connectors := m.connectors
+	m.connectors = map[connectorKey]*Connector{}
+	m.closed = true
+	m.lock.Unlock()
+
+	var lastErr error
+	for _, c := range connectors {
+		if err := c.closeDB(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
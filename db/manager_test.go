@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func closed(c *Connector) bool {
+	err := c.getDB().Ping()
+	return err != nil && err.Error() == "sql: database is closed"
+}
+
+func TestManager(t *testing.T) {
+	config.Conf = &config.Config{}
+	m := NewManager(PoolConfig{MaxOpenConns: 4, MaxIdleConns: 2})
+
+	c1, err := m.Get("root", "taosdata", "127.0.0.1", 6041, "log", false)
+	assert.NoError(t, err)
+	c2, err := m.Get("root", "taosdata", "127.0.0.1", 6041, "log", false)
+	assert.NoError(t, err)
+	assert.Same(t, c1, c2)
+	other, err := m.Get("root", "taosdata", "127.0.0.1", 6041, "", false)
+	assert.NoError(t, err)
+	assert.NotSame(t, c1, other)
+
+	// Close of a shared connector keeps it usable for others
+	assert.NoError(t, c1.Close())
+	assert.False(t, closed(c2))
+
+	m.Configure(PoolConfig{MaxOpenConns: 8})
+	stats := m.Stats()
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, "", stats[0].Database)
+		assert.Equal(t, "log", stats[1].Database)
+		assert.Equal(t, 8, stats[1].MaxOpenConnections)
+	}
+
+	assert.NoError(t, m.Close())
+	assert.True(t, closed(c2))
+	_, err = m.Get("root", "taosdata", "127.0.0.1", 6041, "log", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/taosdata/driver-go/v3/common"
+)
+
+// skip certificate verification of websocket connectors created afterwards
+var wsSkipVerify int32
+
+// SetWSSkipVerify sets whether websocket connectors created afterwards skip certificate verification of taosAdapter.
+func SetWSSkipVerify(skip bool) {
+	var v int32
+	if skip {
+		v = 1
+	}
+	atomic.StoreInt32(&wsSkipVerify, v)
+}
+
+func currentWSSkipVerify() bool {
+	return atomic.LoadInt32(&wsSkipVerify) == 1
+}
+
+// wsTLS keeps hosts whose certificates are not verified. The websocket driver dials with a copy of
+// common.DefaultDialer and takes no TLS option of its own, so the decision of each connector is made by the
+// verification callback installed on it, certificates of other hosts are verified as the dialer does by default.
+var wsTLS struct {
+	sync.RWMutex
+	install    sync.Once
+	skipVerify map[string]bool
+}
+
+// skipWSVerify skips certificate verification of websocket connections to host. The TLS config of
+// common.DefaultDialer is replaced for the whole process and never restored, since the driver copies the dialer
+// when connecting and a clone can not be passed to it.
+func skipWSVerify(host string) {
+	wsTLS.install.Do(func() {
+		// verification is done by verifyWSConnection, InsecureSkipVerify only turns off the built-in one
+		common.DefaultDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true, VerifyConnection: verifyWSConnection}
+	})
+	wsTLS.Lock()
+	defer wsTLS.Unlock()
+	if wsTLS.skipVerify == nil {
+		wsTLS.skipVerify = map[string]bool{}
+	}
+	wsTLS.skipVerify[host] = true
+}
+
+// verifyWSConnection verifies the certificate chain and host name of cs as crypto/tls does, unless the host is
+// added by skipWSVerify.
+func verifyWSConnection(cs tls.ConnectionState) error {
+	wsTLS.RLock()
+	skip := wsTLS.skipVerify[cs.ServerName]
+	wsTLS.RUnlock()
+	if skip {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: no certificate from taosAdapter")
+	}
+	opts := x509.VerifyOptions{DNSName: cs.ServerName, Intermediates: x509.NewCertPool()}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -20,15 +20,26 @@ const ModelKey = "model"
 
 type Config struct {
 	InstanceID       uint8
-	Cors             web.CorsConfig  `toml:"cors"`
-	Port             int             `toml:"port"`
-	LogLevel         string          `toml:"loglevel"`
-	GoPoolSize       int             `toml:"gopoolsize"`
-	RotationInterval string          `toml:"RotationInterval"`
-	TDengine         TDengineRestful `toml:"tdengine"`
-	Metrics          MetricsConfig   `toml:"metrics"`
-	Env              Environment     `toml:"environment"`
-	Log              Log             `mapstructure:"-"`
+	Cors             web.CorsConfig   `toml:"cors"`
+	Port             int              `toml:"port"`
+	LogLevel         string           `toml:"loglevel"`
+	GoPoolSize       int              `toml:"gopoolsize"`
+	RotationInterval string           `toml:"RotationInterval"`
+	TDengine         TDengineRestful  `toml:"tdengine"`
+	Metrics          MetricsConfig    `toml:"metrics"`
+	Env              Environment      `toml:"environment"`
+	Monitor          MonitorConfig    `toml:"monitor"`
+	Shutdown         ShutdownConfig   `toml:"shutdown"`
+	Timeout          TimeoutConfig    `toml:"timeout"`
+	Retry            RetryConfig      `toml:"retry"`
+	Breaker          BreakerConfig    `toml:"breaker"`
+	WriteBatch       WriteBatchConfig `toml:"writeBatch"`
+	Limit            LimitConfig      `toml:"limit"`
+	Validation       ValidationConfig `toml:"validation"`
+	Timestamp        TimestampConfig  `toml:"timestamp"`
+	SlowSql          SlowSqlConfig    `toml:"slowSql"`
+	DebugAPI         DebugAPIConfig   `toml:"debugApi"`
+	Log              Log              `mapstructure:"-"`
 
 	Transfer string
 	FromTime string
@@ -36,11 +47,16 @@ type Config struct {
 }
 
 type TDengineRestful struct {
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	Username string `toml:"username"`
-	Password string `toml:"password"`
-	Usessl   bool   `toml:"usessl"`
+	Host           string         `toml:"host"`
+	Port           int            `toml:"port"`
+	Username       string         `toml:"username"`
+	Password       string         `toml:"password"`
+	PasswordFile   string         `toml:"passwordFile"`
+	Usessl         bool           `toml:"usessl"`
+	Protocol       string         `toml:"protocol"`
+	WSSkipVerify   bool           `toml:"wsSkipVerify"`
+	ReauthInterval time.Duration  `toml:"reauthInterval"`
+	Pool           ConnPoolConfig `toml:"pool"`
 }
 
 var (
@@ -126,6 +142,20 @@ ReadConfig:
 		panic(err)
 	}
 
+	if conf.SlowSql.Query.Enable && len(conf.SlowSql.Query.Token) == 0 {
+		panic("slowSql.query.token is required if slowSql.query.enable is true")
+	}
+	if conf.DebugAPI.Enable && len(conf.DebugAPI.Token) == 0 {
+		panic("debugApi.token is required if debugApi.enable is true")
+	}
+
+	if len(conf.TDengine.PasswordFile) > 0 {
+		if conf.TDengine.Password, err = readPasswordFile(conf.TDengine.PasswordFile); err != nil {
+			panic(err)
+		}
+	}
+	setCredentials(conf.TDengine.Username, conf.TDengine.Password)
+
 	conf.Transfer = *transfer
 	conf.FromTime = *fromTime
 	conf.Drop = *drop
@@ -188,10 +218,42 @@ func init() {
 	_ = viper.BindEnv("tdengine.password", "TAOS_KEEPER_TDENGINE_PASSWORD")
 	pflag.String("tdengine.password", "taosdata", `TDengine server's password. Env "TAOS_KEEPER_TDENGINE_PASSWORD"`)
 
+	viper.SetDefault("tdengine.passwordFile", "")
+	_ = viper.BindEnv("tdengine.passwordFile", "TAOS_KEEPER_TDENGINE_PASSWORD_FILE")
+	pflag.String("tdengine.passwordFile", "", `file containing TDengine server's password, read again when it changes or on re-authentication. Env "TAOS_KEEPER_TDENGINE_PASSWORD_FILE"`)
+
+	viper.SetDefault("tdengine.reauthInterval", 30*time.Second)
+	_ = viper.BindEnv("tdengine.reauthInterval", "TAOS_KEEPER_TDENGINE_REAUTH_INTERVAL")
+	pflag.Duration("tdengine.reauthInterval", 30*time.Second, `interval of re-authentication attempts after TDengine rejected credentials. Env "TAOS_KEEPER_TDENGINE_REAUTH_INTERVAL"`)
+
+	viper.SetDefault("tdengine.pool.maxOpenConns", 0)
+	_ = viper.BindEnv("tdengine.pool.maxOpenConns", "TAOS_KEEPER_TDENGINE_POOL_MAX_OPEN_CONNS")
+	pflag.Int("tdengine.pool.maxOpenConns", 0, `max open connections to TDengine of each database, 0 means unlimited. Env "TAOS_KEEPER_TDENGINE_POOL_MAX_OPEN_CONNS"`)
+
+	viper.SetDefault("tdengine.pool.maxIdleConns", 10)
+	_ = viper.BindEnv("tdengine.pool.maxIdleConns", "TAOS_KEEPER_TDENGINE_POOL_MAX_IDLE_CONNS")
+	pflag.Int("tdengine.pool.maxIdleConns", 10, `max idle connections to TDengine of each database. Env "TAOS_KEEPER_TDENGINE_POOL_MAX_IDLE_CONNS"`)
+
+	viper.SetDefault("tdengine.pool.connMaxLifetime", time.Duration(0))
+	_ = viper.BindEnv("tdengine.pool.connMaxLifetime", "TAOS_KEEPER_TDENGINE_POOL_CONN_MAX_LIFETIME")
+	pflag.Duration("tdengine.pool.connMaxLifetime", 0, `max time a connection to TDengine may be reused, 0 means forever. Env "TAOS_KEEPER_TDENGINE_POOL_CONN_MAX_LIFETIME"`)
+
+	viper.SetDefault("tdengine.pool.connMaxIdleTime", 90*time.Second)
+	_ = viper.BindEnv("tdengine.pool.connMaxIdleTime", "TAOS_KEEPER_TDENGINE_POOL_CONN_MAX_IDLE_TIME")
+	pflag.Duration("tdengine.pool.connMaxIdleTime", 90*time.Second, `max time a connection to TDengine may be idle, 0 means forever. Env "TAOS_KEEPER_TDENGINE_POOL_CONN_MAX_IDLE_TIME"`)
+
 	viper.SetDefault("tdengine.usessl", false)
 	_ = viper.BindEnv("tdengine.usessl", "TAOS_KEEPER_TDENGINE_USESSL")
 	pflag.Bool("tdengine.usessl", false, `TDengine server use ssl or not. Env "TAOS_KEEPER_TDENGINE_USESSL"`)
 
+	viper.SetDefault("tdengine.protocol", "rest")
+	_ = viper.BindEnv("tdengine.protocol", "TAOS_KEEPER_TDENGINE_PROTOCOL")
+	pflag.String("tdengine.protocol", "rest", `protocol to connect taosAdapter, rest or ws. Env "TAOS_KEEPER_TDENGINE_PROTOCOL"`)
+
+	viper.SetDefault("tdengine.wsSkipVerify", false)
+	_ = viper.BindEnv("tdengine.wsSkipVerify", "TAOS_KEEPER_TDENGINE_WS_SKIP_VERIFY")
+	pflag.Bool("tdengine.wsSkipVerify", false, `skip certificate verification of websocket connections to taosAdapter when usessl is true, sets TLS config of the process-wide websocket dialer. Env "TAOS_KEEPER_TDENGINE_WS_SKIP_VERIFY"`)
+
 	viper.SetDefault("metrics.prefix", "")
 	_ = viper.BindEnv("metrics.prefix", "TAOS_KEEPER_METRICS_PREFIX")
 	pflag.String("metrics.prefix", "", `prefix in metrics names. Env "TAOS_KEEPER_METRICS_PREFIX"`)
@@ -220,9 +282,185 @@ func init() {
 	_ = viper.BindEnv("metrics.tables", "TAOS_KEEPER_METRICS_TABLES")
 	pflag.StringArray("metrics.tables", []string{}, `export some tables that are not super table, multiple values split with white space. Env "TAOS_KEEPER_METRICS_TABLES"`)
 
+	viper.SetDefault("metrics.host.enable", false)
+	_ = viper.BindEnv("metrics.host.enable", "TAOS_KEEPER_METRICS_HOST_ENABLE")
+	pflag.Bool("metrics.host.enable", false, `collect metrics of the host keeper running on into keeper_host. Env "TAOS_KEEPER_METRICS_HOST_ENABLE"`)
+
+	viper.SetDefault("monitor.batchSize", 1)
+	_ = viper.BindEnv("monitor.batchSize", "TAOS_KEEPER_MONITOR_BATCH_SIZE")
+	pflag.Int("monitor.batchSize", 1, `number of keeper status samples written to keeper_monitor in one insert. Env "TAOS_KEEPER_MONITOR_BATCH_SIZE"`)
+
+	viper.SetDefault("monitor.historySize", 240)
+	_ = viper.BindEnv("monitor.historySize", "TAOS_KEEPER_MONITOR_HISTORY_SIZE")
+	pflag.Int("monitor.historySize", 240, `number of keeper status samples kept in memory and served at /keeper/status. Env "TAOS_KEEPER_MONITOR_HISTORY_SIZE"`)
+
+	viper.SetDefault("timeout.query", 30*time.Second)
+	_ = viper.BindEnv("timeout.query", "TAOS_KEEPER_TIMEOUT_QUERY")
+	pflag.Duration("timeout.query", 30*time.Second, `deadline of each query to TDengine, including retries. Env "TAOS_KEEPER_TIMEOUT_QUERY"`)
+
+	viper.SetDefault("timeout.exec", 30*time.Second)
+	_ = viper.BindEnv("timeout.exec", "TAOS_KEEPER_TIMEOUT_EXEC")
+	pflag.Duration("timeout.exec", 30*time.Second, `deadline of each insert or ddl to TDengine, including retries. Env "TAOS_KEEPER_TIMEOUT_EXEC"`)
+
+	viper.SetDefault("timeout.write", 30*time.Second)
+	_ = viper.BindEnv("timeout.write", "TAOS_KEEPER_TIMEOUT_WRITE")
+	pflag.Duration("timeout.write", 30*time.Second, `deadline of each line protocol write to taosAdapter, including retries. Env "TAOS_KEEPER_TIMEOUT_WRITE"`)
+
+	viper.SetDefault("retry.maxAttempts", 3)
+	_ = viper.BindEnv("retry.maxAttempts", "TAOS_KEEPER_RETRY_MAX_ATTEMPTS")
+	pflag.Int("retry.maxAttempts", 3, `max attempts of a retryable TDengine call, 1 disables retry. Env "TAOS_KEEPER_RETRY_MAX_ATTEMPTS"`)
+
+	viper.SetDefault("retry.initialBackoff", 500*time.Millisecond)
+	_ = viper.BindEnv("retry.initialBackoff", "TAOS_KEEPER_RETRY_INITIAL_BACKOFF")
+	pflag.Duration("retry.initialBackoff", 500*time.Millisecond, `backoff before the first retry, doubled for each retry. Env "TAOS_KEEPER_RETRY_INITIAL_BACKOFF"`)
+
+	viper.SetDefault("retry.maxBackoff", 5*time.Second)
+	_ = viper.BindEnv("retry.maxBackoff", "TAOS_KEEPER_RETRY_MAX_BACKOFF")
+	pflag.Duration("retry.maxBackoff", 5*time.Second, `max backoff between retries. Env "TAOS_KEEPER_RETRY_MAX_BACKOFF"`)
+
+	viper.SetDefault("retry.jitter", 0.2)
+	_ = viper.BindEnv("retry.jitter", "TAOS_KEEPER_RETRY_JITTER")
+	pflag.Float64("retry.jitter", 0.2, `fraction of backoff randomized. Env "TAOS_KEEPER_RETRY_JITTER"`)
+
+	viper.SetDefault("breaker.failureThreshold", 5)
+	_ = viper.BindEnv("breaker.failureThreshold", "TAOS_KEEPER_BREAKER_FAILURE_THRESHOLD")
+	pflag.Int("breaker.failureThreshold", 5, `consecutive TDengine backend failures to open circuit breaker, 0 disables it. Env "TAOS_KEEPER_BREAKER_FAILURE_THRESHOLD"`)
+
+	viper.SetDefault("breaker.openTimeout", 30*time.Second)
+	_ = viper.BindEnv("breaker.openTimeout", "TAOS_KEEPER_BREAKER_OPEN_TIMEOUT")
+	pflag.Duration("breaker.openTimeout", 30*time.Second, `time circuit breaker stays open before probing TDengine backend. Env "TAOS_KEEPER_BREAKER_OPEN_TIMEOUT"`)
+
+	viper.SetDefault("breaker.halfOpenRequests", 1)
+	_ = viper.BindEnv("breaker.halfOpenRequests", "TAOS_KEEPER_BREAKER_HALF_OPEN_REQUESTS")
+	pflag.Int("breaker.halfOpenRequests", 1, `calls allowed to probe TDengine backend when circuit breaker is half-open. Env "TAOS_KEEPER_BREAKER_HALF_OPEN_REQUESTS"`)
+
+	viper.SetDefault("limit.maxBodySize", 64<<20)
+	_ = viper.BindEnv("limit.maxBodySize", "TAOS_KEEPER_LIMIT_MAX_BODY_SIZE")
+	pflag.Int64("limit.maxBodySize", 64<<20, `max bytes of ingestion request body, 0 means unlimited. Env "TAOS_KEEPER_LIMIT_MAX_BODY_SIZE"`)
+
+	viper.SetDefault("limit.maxInFlight", 512)
+	_ = viper.BindEnv("limit.maxInFlight", "TAOS_KEEPER_LIMIT_MAX_IN_FLIGHT")
+	pflag.Int("limit.maxInFlight", 512, `max concurrent ingestion requests, 0 means unlimited. Env "TAOS_KEEPER_LIMIT_MAX_IN_FLIGHT"`)
+
+	viper.SetDefault("limit.clientRate", 0)
+	_ = viper.BindEnv("limit.clientRate", "TAOS_KEEPER_LIMIT_CLIENT_RATE")
+	pflag.Float64("limit.clientRate", 0, `ingestion requests per second allowed for each client IP, 0 means unlimited. Env "TAOS_KEEPER_LIMIT_CLIENT_RATE"`)
+
+	viper.SetDefault("limit.clientBurst", 10)
+	_ = viper.BindEnv("limit.clientBurst", "TAOS_KEEPER_LIMIT_CLIENT_BURST")
+	pflag.Int("limit.clientBurst", 10, `ingestion requests allowed in a burst for each client IP. Env "TAOS_KEEPER_LIMIT_CLIENT_BURST"`)
+
+	viper.SetDefault("limit.clusterRate", 0)
+	_ = viper.BindEnv("limit.clusterRate", "TAOS_KEEPER_LIMIT_CLUSTER_RATE")
+	pflag.Float64("limit.clusterRate", 0, `ingestion requests per second allowed for each cluster id, 0 means unlimited. Env "TAOS_KEEPER_LIMIT_CLUSTER_RATE"`)
+
+	viper.SetDefault("limit.clusterBurst", 50)
+	_ = viper.BindEnv("limit.clusterBurst", "TAOS_KEEPER_LIMIT_CLUSTER_BURST")
+	pflag.Int("limit.clusterBurst", 50, `ingestion requests allowed in a burst for each cluster id. Env "TAOS_KEEPER_LIMIT_CLUSTER_BURST"`)
+
+	viper.SetDefault("limit.maxDecompressedSize", 256<<20)
+	_ = viper.BindEnv("limit.maxDecompressedSize", "TAOS_KEEPER_LIMIT_MAX_DECOMPRESSED_SIZE")
+	pflag.Int64("limit.maxDecompressedSize", 256<<20, `max bytes of compressed request body after decompression, 0 means unlimited. Env "TAOS_KEEPER_LIMIT_MAX_DECOMPRESSED_SIZE"`)
+
+	viper.SetDefault("writeBatch.enable", false)
+	_ = viper.BindEnv("writeBatch.enable", "TAOS_KEEPER_WRITE_BATCH_ENABLE")
+	pflag.Bool("writeBatch.enable", false, `coalesce line protocol of concurrent general metric requests into one write. Env "TAOS_KEEPER_WRITE_BATCH_ENABLE"`)
+
+	viper.SetDefault("writeBatch.maxSize", 1000000)
+	_ = viper.BindEnv("writeBatch.maxSize", "TAOS_KEEPER_WRITE_BATCH_MAX_SIZE")
+	pflag.Int("writeBatch.maxSize", 1000000, `bytes of a batch to write it at once. Env "TAOS_KEEPER_WRITE_BATCH_MAX_SIZE"`)
+
+	viper.SetDefault("writeBatch.window", 200*time.Millisecond)
+	_ = viper.BindEnv("writeBatch.window", "TAOS_KEEPER_WRITE_BATCH_WINDOW")
+	pflag.Duration("writeBatch.window", 200*time.Millisecond, `longest time a batch waits for more requests before written. Env "TAOS_KEEPER_WRITE_BATCH_WINDOW"`)
+
+	viper.SetDefault("writeBatch.asyncAck", false)
+	_ = viper.BindEnv("writeBatch.asyncAck", "TAOS_KEEPER_WRITE_BATCH_ASYNC_ACK")
+	pflag.Bool("writeBatch.asyncAck", false, `ack requests once buffered instead of after written, write errors are only logged. Env "TAOS_KEEPER_WRITE_BATCH_ASYNC_ACK"`)
+
+	viper.SetDefault("validation.mode", "lenient")
+	_ = viper.BindEnv("validation.mode", "TAOS_KEEPER_VALIDATION_MODE")
+	pflag.String("validation.mode", "lenient", `lenient logs invalid payloads of ingestion endpoints, strict rejects them. Env "TAOS_KEEPER_VALIDATION_MODE"`)
+
+	viper.SetDefault("validation.deadLetter.dir", "")
+	_ = viper.BindEnv("validation.deadLetter.dir", "TAOS_KEEPER_VALIDATION_DEAD_LETTER_DIR")
+	pflag.String("validation.deadLetter.dir", "", `directory to store rejected payloads, empty means not stored. Env "TAOS_KEEPER_VALIDATION_DEAD_LETTER_DIR"`)
+
+	viper.SetDefault("validation.deadLetter.maxFiles", 1000)
+	_ = viper.BindEnv("validation.deadLetter.maxFiles", "TAOS_KEEPER_VALIDATION_DEAD_LETTER_MAX_FILES")
+	pflag.Int("validation.deadLetter.maxFiles", 1000, `max rejected payloads stored, the oldest ones are removed. Env "TAOS_KEEPER_VALIDATION_DEAD_LETTER_MAX_FILES"`)
+
+	viper.SetDefault("timestamp.maxFuture", time.Hour)
+	_ = viper.BindEnv("timestamp.maxFuture", "TAOS_KEEPER_TIMESTAMP_MAX_FUTURE")
+	pflag.Duration("timestamp.maxFuture", time.Hour, `reject timestamps later than keeper's clock by more than it, 0 means unlimited. Env "TAOS_KEEPER_TIMESTAMP_MAX_FUTURE"`)
+
+	viper.SetDefault("timestamp.maxPast", time.Duration(0))
+	_ = viper.BindEnv("timestamp.maxPast", "TAOS_KEEPER_TIMESTAMP_MAX_PAST")
+	pflag.Duration("timestamp.maxPast", 0, `reject timestamps earlier than keeper's clock by more than it, 0 means unlimited. Env "TAOS_KEEPER_TIMESTAMP_MAX_PAST"`)
+
+	viper.SetDefault("slowSql.aggregateWindow", time.Minute)
+	_ = viper.BindEnv("slowSql.aggregateWindow", "TAOS_KEEPER_SLOW_SQL_AGGREGATE_WINDOW")
+	pflag.Duration("slowSql.aggregateWindow", time.Minute, `window slow queries are aggregated by fingerprint in, 0 disables aggregation. Env "TAOS_KEEPER_SLOW_SQL_AGGREGATE_WINDOW"`)
+
+	viper.SetDefault("slowSql.maxSamples", 1000)
+	_ = viper.BindEnv("slowSql.maxSamples", "TAOS_KEEPER_SLOW_SQL_MAX_SAMPLES")
+	pflag.Int("slowSql.maxSamples", 1000, `max samples of a fingerprint in a window kept for percentiles. Env "TAOS_KEEPER_SLOW_SQL_MAX_SAMPLES"`)
+
+	viper.SetDefault("slowSql.redaction.maskLiterals", false)
+	_ = viper.BindEnv("slowSql.redaction.maskLiterals", "TAOS_KEEPER_SLOW_SQL_REDACTION_MASK_LITERALS")
+	pflag.Bool("slowSql.redaction.maskLiterals", false, `replace string and numeric literals of slow queries with ? before stored. Env "TAOS_KEEPER_SLOW_SQL_REDACTION_MASK_LITERALS"`)
+
+	viper.SetDefault("slowSql.redaction.dropUsers", []string{})
+	_ = viper.BindEnv("slowSql.redaction.dropUsers", "TAOS_KEEPER_SLOW_SQL_REDACTION_DROP_USERS")
+	pflag.StringArray("slowSql.redaction.dropUsers", []string{}, `users whose slow queries are not stored, multiple values split with white space. Env "TAOS_KEEPER_SLOW_SQL_REDACTION_DROP_USERS"`)
+
+	viper.SetDefault("slowSql.redaction.dropDbs", []string{})
+	_ = viper.BindEnv("slowSql.redaction.dropDbs", "TAOS_KEEPER_SLOW_SQL_REDACTION_DROP_DBS")
+	pflag.StringArray("slowSql.redaction.dropDbs", []string{}, `dbs whose slow queries are not stored, multiple values split with white space. Env "TAOS_KEEPER_SLOW_SQL_REDACTION_DROP_DBS"`)
+
+	viper.SetDefault("slowSql.query.enable", false)
+	_ = viper.BindEnv("slowSql.query.enable", "TAOS_KEEPER_SLOW_SQL_QUERY_ENABLE")
+	pflag.Bool("slowSql.query.enable", false, `enable GET /api/v1/slow-sql. Env "TAOS_KEEPER_SLOW_SQL_QUERY_ENABLE"`)
+
+	viper.SetDefault("slowSql.query.token", "")
+	_ = viper.BindEnv("slowSql.query.token", "TAOS_KEEPER_SLOW_SQL_QUERY_TOKEN")
+	pflag.String("slowSql.query.token", "", `bearer token required by GET /api/v1/slow-sql, required if slowSql.query.enable. Env "TAOS_KEEPER_SLOW_SQL_QUERY_TOKEN"`)
+
+	viper.SetDefault("debugApi.enable", false)
+	_ = viper.BindEnv("debugApi.enable", "TAOS_KEEPER_DEBUG_API_ENABLE")
+	pflag.Bool("debugApi.enable", false, `enable debug routes such as GET /debug/schemas. Env "TAOS_KEEPER_DEBUG_API_ENABLE"`)
+
+	viper.SetDefault("debugApi.token", "")
+	_ = viper.BindEnv("debugApi.token", "TAOS_KEEPER_DEBUG_API_TOKEN")
+	pflag.String("debugApi.token", "", `bearer token required by debug routes, required if debugApi.enable. Env "TAOS_KEEPER_DEBUG_API_TOKEN"`)
+
+	viper.SetDefault("shutdown.serverTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.serverTimeout", "TAOS_KEEPER_SHUTDOWN_SERVER_TIMEOUT")
+	pflag.Duration("shutdown.serverTimeout", 5*time.Second, `deadline for http server to stop accepting and close idle connections on shutdown. Env "TAOS_KEEPER_SHUTDOWN_SERVER_TIMEOUT"`)
+
+	viper.SetDefault("shutdown.drainTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.drainTimeout", "TAOS_KEEPER_SHUTDOWN_DRAIN_TIMEOUT")
+	pflag.Duration("shutdown.drainTimeout", 5*time.Second, `deadline for in-flight requests to finish on shutdown. Env "TAOS_KEEPER_SHUTDOWN_DRAIN_TIMEOUT"`)
+
+	viper.SetDefault("shutdown.flushTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.flushTimeout", "TAOS_KEEPER_SHUTDOWN_FLUSH_TIMEOUT")
+	pflag.Duration("shutdown.flushTimeout", 5*time.Second, `deadline for writing pending batches on shutdown. Env "TAOS_KEEPER_SHUTDOWN_FLUSH_TIMEOUT"`)
+
+	viper.SetDefault("shutdown.closeTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.closeTimeout", "TAOS_KEEPER_SHUTDOWN_CLOSE_TIMEOUT")
+	pflag.Duration("shutdown.closeTimeout", 5*time.Second, `deadline for closing database connections on shutdown. Env "TAOS_KEEPER_SHUTDOWN_CLOSE_TIMEOUT"`)
+
+	viper.SetDefault("shutdown.poolTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.poolTimeout", "TAOS_KEEPER_SHUTDOWN_POOL_TIMEOUT")
+	pflag.Duration("shutdown.poolTimeout", 5*time.Second, `deadline for goroutine pool tasks to finish on shutdown. Env "TAOS_KEEPER_SHUTDOWN_POOL_TIMEOUT"`)
+
+	viper.SetDefault("shutdown.logTimeout", 5*time.Second)
+	_ = viper.BindEnv("shutdown.logTimeout", "TAOS_KEEPER_SHUTDOWN_LOG_TIMEOUT")
+	pflag.Duration("shutdown.logTimeout", 5*time.Second, `deadline for flushing logs on shutdown. Env "TAOS_KEEPER_SHUTDOWN_LOG_TIMEOUT"`)
+
 	viper.SetDefault("environment.incgroup", false)
 	_ = viper.BindEnv("environment.incgroup", "TAOS_KEEPER_ENVIRONMENT_INCGROUP")
-	pflag.Bool("environment.incgroup", false, `whether running in cgroup. Env "TAOS_KEEPER_ENVIRONMENT_INCGROUP"`)
+	pflag.Bool("environment.incgroup", false, `whether running in cgroup, detected automatically from cgroup v1 or v2 limits when false. Env "TAOS_KEEPER_ENVIRONMENT_INCGROUP"`)
 
 	initLog()
 }
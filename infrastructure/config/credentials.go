@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// credentials of TDengine, updated when config file changed
+var credentials struct {
+	sync.RWMutex
+	username     string
+	password     string
+	passwordFile string
+}
+
+func setCredentials(username, password string) {
+	credentials.Lock()
+	defer credentials.Unlock()
+	credentials.username = username
+	credentials.password = password
+	credentials.passwordFile = viper.GetString("tdengine.passwordFile")
+}
+
+// LoadCredentials returns the latest TDengine credentials, password file is read again if configured.
+func LoadCredentials() (username, password string, err error) {
+	credentials.RLock()
+	username, password, passwordFile := credentials.username, credentials.password, credentials.passwordFile
+	credentials.RUnlock()
+	if len(passwordFile) > 0 {
+		if password, err = readPasswordFile(passwordFile); err != nil {
+			return "", "", err
+		}
+	}
+	return username, password, nil
+}
+
+// WatchCredentials watches config file and password file, and calls onChange with credentials after either
+// changed, so a password rotated on disk takes effect without waiting for an authentication failure.
+func WatchCredentials(onChange func(username, password string, err error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	pw := &passwordWatcher{watcher: watcher}
+	if err = pw.watch(currentPasswordFile()); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		setCredentials(viper.GetString("tdengine.username"), viper.GetString("tdengine.password"))
+		if err := pw.watch(currentPasswordFile()); err != nil {
+			onChange("", "", err)
+		}
+		onChange(LoadCredentials())
+	})
+	viper.WatchConfig()
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if pw.changed(event) {
+					onChange(LoadCredentials())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				onChange("", "", fmt.Errorf("watch password file error, msg:%s", err))
+			}
+		}
+	}()
+	return nil
+}
+
+func currentPasswordFile() string {
+	credentials.RLock()
+	defer credentials.RUnlock()
+	return credentials.passwordFile
+}
+
+// passwordWatcher watches the directory of the password file, as the file is often replaced rather than written,
+// such as secrets mounted by kubernetes.
+type passwordWatcher struct {
+	lock    sync.Mutex
+	watcher *fsnotify.Watcher
+	file    string
+}
+
+// watch switches to watch file, empty file stops watching.
+func (p *passwordWatcher) watch(file string) error {
+	if len(file) > 0 {
+		file = filepath.Clean(file)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if file == p.file {
+		return nil
+	}
+	if len(p.file) > 0 {
+		_ = p.watcher.Remove(filepath.Dir(p.file))
+	}
+	p.file = file
+	if len(file) == 0 {
+		return nil
+	}
+	if err := p.watcher.Add(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("watch password file %s error, msg:%s", file, err)
+	}
+	return nil
+}
+
+// changed reports whether event may change content of the password file.
+func (p *passwordWatcher) changed(event fsnotify.Event) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.file) == 0 || filepath.Dir(filepath.Clean(event.Name)) != filepath.Dir(p.file) {
+		return false
+	}
+	if filepath.Clean(event.Name) == p.file {
+		return event.Op&(fsnotify.Write|fsnotify.Create) != 0
+	}
+	// kubernetes swaps the symlink of the directory holding the file
+	return event.Op&fsnotify.Create != 0 && strings.HasPrefix(filepath.Base(event.Name), "..")
+}
+
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read password file %s error, msg:%s", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
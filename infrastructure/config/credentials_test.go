@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0600))
+	viper.Set("tdengine.passwordFile", path)
+	defer viper.Set("tdengine.passwordFile", "")
+	setCredentials("root", "")
+
+	passwords := make(chan string, 10)
+	assert.NoError(t, WatchCredentials(func(username, password string, err error) {
+		assert.NoError(t, err)
+		assert.Equal(t, "root", username)
+		passwords <- password
+	}))
+	assert.NoError(t, os.WriteFile(path, []byte("new\n"), 0600))
+	for {
+		select {
+		case password := <-passwords:
+			if password == "new" {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("password file change not noticed")
+		}
+	}
+}
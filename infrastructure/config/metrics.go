@@ -1,9 +1,26 @@
 package config
 
+import "time"
+
 type MetricsConfig struct {
-	Prefix   string   `toml:"prefix"`
-	Database Database `toml:"database"`
-	Tables   []string `toml:"tables"`
+	Prefix   string         `toml:"prefix"`
+	Database Database       `toml:"database"`
+	Tables   []string       `toml:"tables"`
+	Host     HostMetrics    `toml:"host"`
+	SubTable []SubTableRule `toml:"subtable"`
+}
+
+// SubTableRule names child tables of stables matching Stable, which may contain one *. Template refers tags as
+// {tag} and the part matched by * as {*}, tags in Md5 are replaced by their md5 if the name is too long, a
+// name still too long is replaced by md5 of it.
+type SubTableRule struct {
+	Stable   string   `toml:"stable"`
+	Template string   `toml:"template"`
+	Md5      []string `toml:"md5"`
+}
+
+type HostMetrics struct {
+	Enable bool `toml:"enable"`
 }
 
 type TaosAdapter struct {
@@ -18,6 +35,132 @@ type Metric struct {
 	Labels map[string]string `toml:"labels"`
 }
 
+type MonitorConfig struct {
+	BatchSize   int `toml:"batchSize"`
+	HistorySize int `toml:"historySize"`
+}
+
+type TimeoutConfig struct {
+	Query time.Duration `toml:"query"`
+	Exec  time.Duration `toml:"exec"`
+	Write time.Duration `toml:"write"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `toml:"maxAttempts"`
+	InitialBackoff time.Duration `toml:"initialBackoff"`
+	MaxBackoff     time.Duration `toml:"maxBackoff"`
+	Jitter         float64       `toml:"jitter"`
+}
+
+type BreakerConfig struct {
+	FailureThreshold int           `toml:"failureThreshold"`
+	OpenTimeout      time.Duration `toml:"openTimeout"`
+	HalfOpenRequests int           `toml:"halfOpenRequests"`
+}
+
+type LimitConfig struct {
+	MaxBodySize  int64   `toml:"maxBodySize"`
+	MaxInFlight  int     `toml:"maxInFlight"`
+	ClientRate   float64 `toml:"clientRate"`
+	ClientBurst  int     `toml:"clientBurst"`
+	ClusterRate  float64 `toml:"clusterRate"`
+	ClusterBurst int     `toml:"clusterBurst"`
+
+	MaxDecompressedSize int64 `toml:"maxDecompressedSize"`
+}
+
+type WriteBatchConfig struct {
+	Enable   bool          `toml:"enable"`
+	MaxSize  int           `toml:"maxSize"`
+	Window   time.Duration `toml:"window"`
+	AsyncAck bool          `toml:"asyncAck"`
+}
+
+type ConnPoolConfig struct {
+	MaxOpenConns    int           `toml:"maxOpenConns"`
+	MaxIdleConns    int           `toml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `toml:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `toml:"connMaxIdleTime"`
+}
+
+type ValidationConfig struct {
+	// Mode is lenient or strict, lenient logs invalid payloads and writes what it can, strict rejects them
+	Mode       string           `toml:"mode"`
+	DeadLetter DeadLetterConfig `toml:"deadLetter"`
+	Rule       []ValidationRule `toml:"rule"`
+}
+
+type DeadLetterConfig struct {
+	Dir      string `toml:"dir"`
+	MaxFiles int    `toml:"maxFiles"`
+}
+
+// ValidationRule checks records of Endpoint written to stables matching Stable, both match all if empty. Mode
+// overrides the global mode for violations of the rule.
+type ValidationRule struct {
+	Endpoint      string        `toml:"endpoint"`
+	Stable        string        `toml:"stable"`
+	Mode          string        `toml:"mode"`
+	RequiredTags  []string      `toml:"requiredTags"`
+	MetricPattern string        `toml:"metricPattern"`
+	MaxSkew       time.Duration `toml:"maxSkew"`
+}
+
+// TimestampConfig bounds timestamps of reports relative to keeper's clock, 0 means unlimited.
+type TimestampConfig struct {
+	MaxFuture time.Duration `toml:"maxFuture"`
+	MaxPast   time.Duration `toml:"maxPast"`
+}
+
+type SlowSqlConfig struct {
+	// AggregateWindow is the window slow queries are aggregated by fingerprint in, 0 disables aggregation
+	AggregateWindow time.Duration `toml:"aggregateWindow"`
+	// MaxSamples bounds query times and rows kept for percentiles of a fingerprint in a window
+	MaxSamples int                `toml:"maxSamples"`
+	Redaction  RedactionConfig    `toml:"redaction"`
+	Query      SlowSqlQueryConfig `toml:"query"`
+}
+
+// SlowSqlQueryConfig enables GET /api/v1/slow-sql, requests must carry Token as bearer token, which is required if
+// enabled.
+type SlowSqlQueryConfig struct {
+	Enable bool   `toml:"enable"`
+	Token  string `toml:"token"`
+}
+
+// RedactionConfig redacts slow queries before stored. Queries of DropUsers or DropDbs are not stored, literals are
+// masked if MaskLiterals and then rules are applied in order.
+type RedactionConfig struct {
+	MaskLiterals bool            `toml:"maskLiterals"`
+	DropUsers    []string        `toml:"dropUsers"`
+	DropDbs      []string        `toml:"dropDbs"`
+	Rule         []RedactionRule `toml:"rule"`
+}
+
+// RedactionRule replaces matches of regular expression Pattern with Replacement, which may refer to submatches as
+// $1 or ${name}.
+type RedactionRule struct {
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+}
+
+// DebugAPIConfig enables routes under /debug, requests must carry Token as bearer token, which is required if
+// enabled.
+type DebugAPIConfig struct {
+	Enable bool   `toml:"enable"`
+	Token  string `toml:"token"`
+}
+
+type ShutdownConfig struct {
+	ServerTimeout time.Duration `toml:"serverTimeout"`
+	DrainTimeout  time.Duration `toml:"drainTimeout"`
+	FlushTimeout  time.Duration `toml:"flushTimeout"`
+	CloseTimeout  time.Duration `toml:"closeTimeout"`
+	PoolTimeout   time.Duration `toml:"poolTimeout"`
+	LogTimeout    time.Duration `toml:"logTimeout"`
+}
+
 type Environment struct {
 	InCGroup bool `toml:"incgroup"`
 }
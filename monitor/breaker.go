@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/db"
+)
+
+var breakerStates = []db.BreakerState{db.BreakerClosed, db.BreakerOpen, db.BreakerHalfOpen}
+
+// BreakerCollector exports state and transitions of circuit breaker of TDengine backend.
+type BreakerCollector struct {
+	breaker     *db.Breaker
+	state       *prometheus.Desc
+	transitions *prometheus.Desc
+	rejected    *prometheus.Desc
+}
+
+func NewBreakerCollector(prefix string, breaker *db.Breaker) *BreakerCollector {
+	return &BreakerCollector{
+		breaker: breaker,
+		state: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_breaker", "state"),
+			"1 for the current state of circuit breaker of TDengine backend", []string{"state"}, nil),
+		transitions: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_breaker", "transitions_total"),
+			"times circuit breaker of TDengine backend changed to the state", []string{"state"}, nil),
+		rejected: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_breaker", "rejected_total"),
+			"calls rejected by circuit breaker of TDengine backend", nil, nil),
+	}
+}
+
+func (b *BreakerCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- b.state
+	descs <- b.transitions
+	descs <- b.rejected
+}
+
+func (b *BreakerCollector) Collect(metrics chan<- prometheus.Metric) {
+	stats := b.breaker.Stats()
+	for _, state := range breakerStates {
+		var value float64
+		if stats.State == state {
+			value = 1
+		}
+		metrics <- prometheus.MustNewConstMetric(b.state, prometheus.GaugeValue, value, state.String())
+		metrics <- prometheus.MustNewConstMetric(b.transitions, prometheus.CounterValue,
+			float64(stats.Transitions[state]), state.String())
+	}
+	metrics <- prometheus.MustNewConstMetric(b.rejected, prometheus.CounterValue, float64(stats.Rejected))
+}
@@ -0,0 +1,24 @@
+package monitor
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+)
+
+func TestBreakerCollector(t *testing.T) {
+	breaker := db.NewBreaker(1, time.Minute, 1)
+	assert.NoError(t, breaker.Allow())
+	breaker.Done(&net.OpError{Op: "read", Err: errors.New("connection reset")})
+	assert.ErrorIs(t, breaker.Allow(), db.ErrBreakerOpen)
+
+	values := gatherValues(t, NewBreakerCollector("taos", breaker))
+	assert.Equal(t, float64(1), values["taos_keeper_breaker_state_open"])
+	assert.Equal(t, float64(0), values["taos_keeper_breaker_state_closed"])
+	assert.Equal(t, float64(1), values["taos_keeper_breaker_transitions_total_open"])
+	assert.Equal(t, float64(1), values["taos_keeper_breaker_rejected_total"])
+}
@@ -1,9 +1,12 @@
 package monitor
 
 import (
+	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/process"
@@ -13,6 +16,8 @@ import (
 type SysCollector interface {
 	CpuPercent() (float64, error)
 	MemPercent() (float64, error)
+	RSS() (uint64, error)
+	OpenFDs() (int32, error)
 }
 
 type NormalCollector struct {
@@ -43,12 +48,229 @@ func (n *NormalCollector) MemPercent() (float64, error) {
 	return float64(memPercent), nil
 }
 
+func (n *NormalCollector) RSS() (uint64, error) {
+	memInfo, err := n.p.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return memInfo.RSS, nil
+}
+
+func (n *NormalCollector) OpenFDs() (int32, error) {
+	return n.p.NumFDs()
+}
+
 const (
-	CGroupCpuQuotaPath  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
-	CGroupCpuPeriodPath = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
-	CGroupMemLimitPath  = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+	CGroupRoot = "/sys/fs/cgroup"
+	// ProcSelfCGroup lists cgroups of keeper
+	ProcSelfCGroup = "/proc/self/cgroup"
+
+	// cgroup v1
+	CGroupCpuQuotaPath  = "cpu/cpu.cfs_quota_us"
+	CGroupCpuPeriodPath = "cpu/cpu.cfs_period_us"
+	CGroupMemLimitPath  = "memory/memory.limit_in_bytes"
+
+	// cgroup v2, unified hierarchy
+	CGroupV2ControllersPath = "cgroup.controllers"
+	CGroupV2CpuMaxPath      = "cpu.max"
+	CGroupV2MemMaxPath      = "memory.max"
 )
 
+// CGroupVersion returns the cgroup version mounted at root, 0 if no cgroup found.
+func CGroupVersion(root string) int {
+	if _, err := os.Stat(filepath.Join(root, CGroupV2ControllersPath)); err == nil {
+		return 2
+	}
+	if _, err := os.Stat(filepath.Join(root, CGroupCpuPeriodPath)); err == nil {
+		return 1
+	}
+	if _, err := os.Stat(filepath.Join(root, CGroupMemLimitPath)); err == nil {
+		return 1
+	}
+	return 0
+}
+
+// CGroupLimits returns the cpu cores and memory bytes limited by the cgroup of keeper, 0 means unlimited. The
+// cgroup is resolved from procCGroup, the /proc/self/cgroup file, under the hierarchy mounted at root, and its
+// limits are bounded by those of its ancestors.
+func CGroupLimits(root, procCGroup string) (cpuCore float64, memLimit uint64, err error) {
+	version := CGroupVersion(root)
+	if version == 0 {
+		return 0, 0, fmt.Errorf("no cgroup found in %s", root)
+	}
+	// without the file, as in a private cgroup namespace, the cgroup is the root of the hierarchy
+	paths := map[string]string{}
+	if content, err := os.ReadFile(procCGroup); err == nil {
+		paths = ParseProcCGroup(string(content))
+	}
+	if version == 1 {
+		return cgroupV1Limits(root, paths)
+	}
+	return cgroupV2Limits(cgroupDirs(root, paths[""]))
+}
+
+// ParseProcCGroup returns cgroup paths by controller of a /proc/<pid>/cgroup file, the path of the cgroup v2
+// unified hierarchy has the empty controller.
+func ParseProcCGroup(content string) map[string]string {
+	paths := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if len(fields[1]) == 0 {
+			paths[""] = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			paths[controller] = fields[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDirs returns directories of the cgroup at path of the hierarchy mounted at mount, from the cgroup up to the
+// mount. The mount is taken as the cgroup if path is not found in it, as when only the cgroup is mounted.
+func cgroupDirs(mount, path string) []string {
+	dir := filepath.Join(mount, path)
+	if _, err := os.Stat(dir); err != nil || !strings.HasPrefix(dir, mount) {
+		return []string{mount}
+	}
+	dirs := []string{dir}
+	for dir != mount {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func cgroupV1Limits(root string, paths map[string]string) (cpuCore float64, memLimit uint64, err error) {
+	cpuFound, memFound := false, false
+	for _, dir := range cgroupDirs(filepath.Join(root, filepath.Dir(CGroupCpuPeriodPath)), paths["cpu"]) {
+		cpuPeriod, err := util.ReadUint(filepath.Join(dir, filepath.Base(CGroupCpuPeriodPath)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		// quota is -1 when unlimited, it is parsed to 0
+		cpuQuota, err := util.ReadUint(filepath.Join(dir, filepath.Base(CGroupCpuQuotaPath)))
+		if err != nil {
+			return 0, 0, err
+		}
+		cpuFound = true
+		if cpuPeriod > 0 && cpuQuota > 0 {
+			if core := float64(cpuQuota) / float64(cpuPeriod); cpuCore == 0 || core < cpuCore {
+				cpuCore = core
+			}
+		}
+	}
+	for _, dir := range cgroupDirs(filepath.Join(root, filepath.Dir(CGroupMemLimitPath)), paths["memory"]) {
+		limit, err := util.ReadUint(filepath.Join(dir, filepath.Base(CGroupMemLimitPath)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		memFound = true
+		if limit > 0 && (memLimit == 0 || limit < memLimit) {
+			memLimit = limit
+		}
+	}
+	if !cpuFound || !memFound {
+		return 0, 0, fmt.Errorf("no cgroup v1 cpu and memory limits found in %s", root)
+	}
+	return cpuCore, memLimit, nil
+}
+
+func cgroupV2Limits(dirs []string) (cpuCore float64, memLimit uint64, err error) {
+	found := false
+	for _, dir := range dirs {
+		// the root cgroup has no limit files
+		core, err := readCGroupV2CpuMax(filepath.Join(dir, CGroupV2CpuMaxPath))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		limit, err := readCGroupV2MemMax(filepath.Join(dir, CGroupV2MemMaxPath))
+		if err != nil {
+			return 0, 0, err
+		}
+		found = true
+		if core > 0 && (cpuCore == 0 || core < cpuCore) {
+			cpuCore = core
+		}
+		if limit > 0 && (memLimit == 0 || limit < memLimit) {
+			memLimit = limit
+		}
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("no %s found in %s", CGroupV2CpuMaxPath, dirs[0])
+	}
+	return cpuCore, memLimit, nil
+}
+
+// readCGroupV2CpuMax reads cpu cores of cpu.max: "$MAX $PERIOD", $MAX is "max" when unlimited.
+func readCGroupV2CpuMax(path string) (float64, error) {
+	v, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(v))
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid %s: %s", CGroupV2CpuMaxPath, v)
+	}
+	if fields[0] == "max" {
+		return 0, nil
+	}
+	cpuQuota, err := util.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	cpuPeriod, err := util.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if cpuPeriod == 0 {
+		return 0, nil
+	}
+	return float64(cpuQuota) / float64(cpuPeriod), nil
+}
+
+// readCGroupV2MemMax reads bytes of memory.max, "max" when unlimited.
+func readCGroupV2MemMax(path string) (uint64, error) {
+	v, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	limit := strings.TrimSpace(string(v))
+	if limit == "max" {
+		return 0, nil
+	}
+	return util.ParseUint(limit, 10, 64)
+}
+
+// InCGroup reports whether keeper runs in a cgroup which limits cpu or memory.
+func InCGroup() bool {
+	cpuCore, memLimit, err := CGroupLimits(CGroupRoot, ProcSelfCGroup)
+	if err != nil {
+		return false
+	}
+	if cpuCore > 0 {
+		return true
+	}
+	machineMemory, err := mem.VirtualMemory()
+	if err != nil {
+		return false
+	}
+	return memLimit > 0 && memLimit < machineMemory.Total
+}
+
 type CGroupCollector struct {
 	p           *process.Process
 	cpuCore     float64
@@ -60,24 +282,21 @@ func NewCGroupCollector() (*CGroupCollector, error) {
 	if err != nil {
 		return nil, err
 	}
-	cpuPeriod, err := util.ReadUint(CGroupCpuPeriodPath)
+	cpuCore, limitMemory, err := CGroupLimits(CGroupRoot, ProcSelfCGroup)
 	if err != nil {
 		return nil, err
 	}
-	cpuQuota, err := util.ReadUint(CGroupCpuQuotaPath)
-	if err != nil {
-		return nil, err
-	}
-	cpuCore := float64(cpuQuota) / float64(cpuPeriod)
-	limitMemory, err := util.ReadUint(CGroupMemLimitPath)
-	if err != nil {
-		return nil, err
+	if cpuCore <= 0 {
+		cpuCore = float64(runtime.NumCPU())
 	}
 	machineMemory, err := mem.VirtualMemory()
 	if err != nil {
 		return nil, err
 	}
-	totalMemory := uint64(math.Min(float64(limitMemory), float64(machineMemory.Total)))
+	totalMemory := machineMemory.Total
+	if limitMemory > 0 {
+		totalMemory = uint64(math.Min(float64(limitMemory), float64(machineMemory.Total)))
+	}
 	return &CGroupCollector{p: p, cpuCore: cpuCore, totalMemory: totalMemory}, nil
 }
 
@@ -97,3 +316,15 @@ func (c *CGroupCollector) MemPercent() (float64, error) {
 	}
 	return 100 * float64(memInfo.RSS) / float64(c.totalMemory), nil
 }
+
+func (c *CGroupCollector) RSS() (uint64, error) {
+	memInfo, err := c.p.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return memInfo.RSS, nil
+}
+
+func (c *CGroupCollector) OpenFDs() (int32, error) {
+	return c.p.NumFDs()
+}
@@ -0,0 +1,169 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCGroupFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestCGroupLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		proc     string
+		version  int
+		cpuCore  float64
+		memLimit uint64
+		err      bool
+	}{
+		{
+			name:    "none",
+			files:   map[string]string{},
+			version: 0,
+			err:     true,
+		},
+		{
+			name: "v1",
+			files: map[string]string{
+				CGroupCpuPeriodPath: "100000\n",
+				CGroupCpuQuotaPath:  "200000\n",
+				CGroupMemLimitPath:  "1073741824\n",
+			},
+			version:  1,
+			cpuCore:  2,
+			memLimit: 1073741824,
+		},
+		{
+			name: "v1 unlimited",
+			files: map[string]string{
+				CGroupCpuPeriodPath: "100000\n",
+				CGroupCpuQuotaPath:  "-1\n",
+				CGroupMemLimitPath:  "9223372036854771712\n",
+			},
+			version:  1,
+			cpuCore:  0,
+			memLimit: 9223372036854771712,
+		},
+		{
+			name: "v2",
+			files: map[string]string{
+				CGroupV2ControllersPath: "cpuset cpu io memory pids\n",
+				CGroupV2CpuMaxPath:      "150000 100000\n",
+				CGroupV2MemMaxPath:      "536870912\n",
+			},
+			version:  2,
+			cpuCore:  1.5,
+			memLimit: 536870912,
+		},
+		{
+			name: "v2 unlimited",
+			files: map[string]string{
+				CGroupV2ControllersPath: "cpuset cpu io memory pids\n",
+				CGroupV2CpuMaxPath:      "max 100000\n",
+				CGroupV2MemMaxPath:      "max\n",
+			},
+			version: 2,
+		},
+		{
+			name: "v1 own cgroup",
+			files: map[string]string{
+				CGroupCpuPeriodPath:                         "100000\n",
+				CGroupCpuQuotaPath:                          "-1\n",
+				CGroupMemLimitPath:                          "9223372036854771712\n",
+				"cpu/docker/abc/cpu.cfs_period_us":          "100000\n",
+				"cpu/docker/abc/cpu.cfs_quota_us":           "50000\n",
+				"memory/docker/abc/memory.limit_in_bytes":   "268435456\n",
+				"memory/docker/other/memory.limit_in_bytes": "1024\n",
+			},
+			proc:     "12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n",
+			version:  1,
+			cpuCore:  0.5,
+			memLimit: 268435456,
+		},
+		{
+			name: "v1 own cgroup mounted",
+			files: map[string]string{
+				CGroupCpuPeriodPath: "100000\n",
+				CGroupCpuQuotaPath:  "100000\n",
+				CGroupMemLimitPath:  "1073741824\n",
+			},
+			proc:     "12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+			version:  1,
+			cpuCore:  1,
+			memLimit: 1073741824,
+		},
+		{
+			name: "v2 own cgroup",
+			files: map[string]string{
+				CGroupV2ControllersPath:                  "cpuset cpu io memory pids\n",
+				"system.slice/cpu.max":                   "200000 100000\n",
+				"system.slice/memory.max":                "max\n",
+				"system.slice/keeper.service/cpu.max":    "max 100000\n",
+				"system.slice/keeper.service/memory.max": "536870912\n",
+				"user.slice/cpu.max":                     "50000 100000\n",
+				"user.slice/memory.max":                  "1024\n",
+			},
+			proc:     "0::/system.slice/keeper.service\n",
+			version:  2,
+			cpuCore:  2,
+			memLimit: 536870912,
+		},
+		{
+			name: "v2 invalid cpu.max",
+			files: map[string]string{
+				CGroupV2ControllersPath: "cpu memory\n",
+				CGroupV2CpuMaxPath:      "max\n",
+				CGroupV2MemMaxPath:      "max\n",
+			},
+			version: 2,
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeCGroupFiles(t, tt.files)
+			assert.Equal(t, tt.version, CGroupVersion(root))
+			proc := filepath.Join(t.TempDir(), "cgroup")
+			if len(tt.proc) > 0 {
+				assert.NoError(t, os.WriteFile(proc, []byte(tt.proc), 0644))
+			}
+			cpuCore, memLimit, err := CGroupLimits(root, proc)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cpuCore, cpuCore)
+			assert.Equal(t, tt.memLimit, memLimit)
+		})
+	}
+}
+
+func TestParseProcCGroup(t *testing.T) {
+	paths := ParseProcCGroup("12:memory:/docker/abc\n4:cpu,cpuacct:/docker/def\n0::/system.slice\ninvalid\n")
+	assert.Equal(t, map[string]string{
+		"memory":  "/docker/abc",
+		"cpu":     "/docker/def",
+		"cpuacct": "/docker/def",
+		"":        "/system.slice",
+	}, paths)
+}
+
+func TestNewCollector(t *testing.T) {
+	collector := newCollector(false)
+	assert.NotNil(t, collector)
+	_, err := collector.CpuPercent()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/db"
+)
+
+// ConnPoolCollector exports stats of connection pools of db.Manager, labelled by database.
+type ConnPoolCollector struct {
+	manager           *db.Manager
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func NewConnPoolCollector(prefix string, manager *db.Manager) *ConnPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_conn_pool", name), help,
+			[]string{"database"}, nil)
+	}
+	return &ConnPoolCollector{
+		manager:           manager,
+		maxOpen:           desc("max_open", "max open connections to TDengine, 0 means unlimited"),
+		open:              desc("open", "open connections to TDengine, in use and idle"),
+		inUse:             desc("in_use", "connections to TDengine in use"),
+		idle:              desc("idle", "idle connections to TDengine"),
+		waitCount:         desc("wait_total", "times waited for a connection to TDengine"),
+		waitDuration:      desc("wait_seconds_total", "time waited for connections to TDengine"),
+		maxIdleClosed:     desc("max_idle_closed_total", "connections closed due to max idle connections"),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "connections closed due to max idle time"),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "connections closed due to max lifetime"),
+	}
+}
+
+func (c *ConnPoolCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.maxOpen
+	descs <- c.open
+	descs <- c.inUse
+	descs <- c.idle
+	descs <- c.waitCount
+	descs <- c.waitDuration
+	descs <- c.maxIdleClosed
+	descs <- c.maxIdleTimeClosed
+	descs <- c.maxLifetimeClosed
+}
+
+func (c *ConnPoolCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, s := range c.manager.Stats() {
+		metrics <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), s.Database)
+		metrics <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed), s.Database)
+	}
+}
@@ -0,0 +1,22 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestConnPoolCollector(t *testing.T) {
+	config.Conf = &config.Config{}
+	manager := db.NewManager(db.PoolConfig{MaxOpenConns: 4})
+	defer manager.Close()
+	_, err := manager.Get("root", "taosdata", "127.0.0.1", 6041, "log", false)
+	assert.NoError(t, err)
+
+	values := gatherValues(t, NewConnPoolCollector("taos", manager))
+	assert.Equal(t, float64(4), values["taos_keeper_conn_pool_max_open_log"])
+	assert.Equal(t, float64(0), values["taos_keeper_conn_pool_in_use_log"])
+	assert.Equal(t, float64(0), values["taos_keeper_conn_pool_wait_total_log"])
+}
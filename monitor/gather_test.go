@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatherValues gathers metrics of collector by name joined with label values, summaries are gathered as
+// name_count and name_sum.
+func gatherValues(t *testing.T, collector prometheus.Collector) map[string]float64 {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(collector)
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "_" + label.GetValue()
+			}
+			switch {
+			case metric.GetSummary() != nil:
+				values[name+"_count"] = float64(metric.GetSummary().GetSampleCount())
+				values[name+"_sum"] = metric.GetSummary().GetSampleSum()
+			case metric.GetGauge() != nil:
+				values[name] = metric.GetGauge().GetValue()
+			case metric.GetCounter() != nil:
+				values[name] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,502 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/pool"
+)
+
+const MemPressurePath = "/proc/pressure/memory"
+
+// CreateKeeperHostSql creates the stable of host metrics, one sub table for each kind and device.
+// kind `host` holds load and memory, `disk` holds io of a block device, `fs` holds usage of a mounted
+// filesystem, `net` holds throughput of a network interface.
+var CreateKeeperHostSql = "create stable if not exists keeper_host (" +
+	"ts timestamp, " +
+	"load1 double, " +
+	"load5 double, " +
+	"load15 double, " +
+	"mem_total bigint, " +
+	"mem_available bigint, " +
+	"mem_used_percent double, " +
+	"swap_used_percent double, " +
+	"mem_pressure double, " +
+	"read_bytes_rate double, " +
+	"write_bytes_rate double, " +
+	"read_ops_rate double, " +
+	"write_ops_rate double, " +
+	"fs_total bigint, " +
+	"fs_used bigint, " +
+	"fs_used_percent double, " +
+	"recv_bytes_rate double, " +
+	"sent_bytes_rate double" +
+	") tags (identify nchar(50), kind nchar(8), device nchar(128))"
+
+type HostStatus struct {
+	CollectTime     time.Time
+	Load1           float64
+	Load5           float64
+	Load15          float64
+	MemTotal        uint64
+	MemAvailable    uint64
+	MemUsedPercent  float64
+	SwapUsedPercent float64
+	// MemPressure is `some avg10` of linux PSI, negative if not supported
+	MemPressure float64
+	Disks       []DiskStatus
+	FileSystems []FileSystemStatus
+	Nets        []NetStatus
+}
+
+type DiskStatus struct {
+	Name           string
+	ReadBytesRate  float64
+	WriteBytesRate float64
+	ReadOpsRate    float64
+	WriteOpsRate   float64
+}
+
+type FileSystemStatus struct {
+	Path        string
+	Device      string
+	Total       uint64
+	Used        uint64
+	UsedPercent float64
+}
+
+type NetStatus struct {
+	Name          string
+	RecvBytesRate float64
+	SentBytesRate float64
+}
+
+// HostCollector collects load, disk io, filesystem usage, network throughput and memory pressure of the host.
+// It is also a prometheus collector exporting the latest collected status.
+type HostCollector struct {
+	sync.RWMutex
+	status   *HostStatus
+	lastTime time.Time
+	lastDisk map[string]disk.IOCountersStat
+	lastNet  map[string]net.IOCountersStat
+	descs    map[string]*prometheus.Desc
+
+	ticker *time.Ticker
+	done   chan struct{}
+
+	connLock sync.Mutex
+	conn     *db.Connector
+	closed   bool
+}
+
+func NewHostCollector(prefix string) *HostCollector {
+	h := &HostCollector{descs: map[string]*prometheus.Desc{}}
+	newDesc := func(name, help string, labels ...string) {
+		h.descs[name] = prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_host", name), help, labels, nil)
+	}
+	newDesc("load1", "host load average of 1 minute")
+	newDesc("load5", "host load average of 5 minutes")
+	newDesc("load15", "host load average of 15 minutes")
+	newDesc("mem_total", "host total memory in bytes")
+	newDesc("mem_available", "host available memory in bytes")
+	newDesc("mem_used_percent", "host memory used percent")
+	newDesc("swap_used_percent", "host swap used percent")
+	newDesc("mem_pressure", "host memory pressure, some avg10 of PSI")
+	newDesc("disk_read_bytes_rate", "disk read bytes per second", "device")
+	newDesc("disk_write_bytes_rate", "disk write bytes per second", "device")
+	newDesc("disk_read_ops_rate", "disk read operations per second", "device")
+	newDesc("disk_write_ops_rate", "disk write operations per second", "device")
+	newDesc("fs_total", "filesystem total bytes", "path", "device")
+	newDesc("fs_used", "filesystem used bytes", "path", "device")
+	newDesc("fs_used_percent", "filesystem used percent", "path", "device")
+	newDesc("net_recv_bytes_rate", "network received bytes per second", "interface")
+	newDesc("net_sent_bytes_rate", "network sent bytes per second", "interface")
+	return h
+}
+
+// Status returns the latest collected host status, nil if not collected yet.
+func (h *HostCollector) Status() *HostStatus {
+	h.RLock()
+	defer h.RUnlock()
+	return h.status
+}
+
+func (h *HostCollector) collect() *HostStatus {
+	now := time.Now()
+	status := &HostStatus{CollectTime: now, MemPressure: -1}
+
+	if avg, err := load.Avg(); err != nil {
+		logger.Debugf("get host load error, msg:%s", err)
+	} else {
+		status.Load1, status.Load5, status.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	if vm, err := mem.VirtualMemory(); err != nil {
+		logger.Debugf("get host memory error, msg:%s", err)
+	} else {
+		status.MemTotal, status.MemAvailable, status.MemUsedPercent = vm.Total, vm.Available, vm.UsedPercent
+	}
+	if swap, err := mem.SwapMemory(); err != nil {
+		logger.Debugf("get host swap error, msg:%s", err)
+	} else {
+		status.SwapUsedPercent = swap.UsedPercent
+	}
+	if pressure, err := readMemPressure(MemPressurePath); err == nil {
+		status.MemPressure = pressure
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	elapsed := now.Sub(h.lastTime).Seconds()
+
+	diskCounters, err := disk.IOCounters()
+	if err != nil {
+		logger.Debugf("get host disk io error, msg:%s", err)
+	} else {
+		if h.lastDisk != nil && elapsed > 0 {
+			for name, c := range diskCounters {
+				last, ok := h.lastDisk[name]
+				if !ok {
+					continue
+				}
+				status.Disks = append(status.Disks, DiskStatus{
+					Name:           name,
+					ReadBytesRate:  rate(last.ReadBytes, c.ReadBytes, elapsed),
+					WriteBytesRate: rate(last.WriteBytes, c.WriteBytes, elapsed),
+					ReadOpsRate:    rate(last.ReadCount, c.ReadCount, elapsed),
+					WriteOpsRate:   rate(last.WriteCount, c.WriteCount, elapsed),
+				})
+			}
+			sort.Slice(status.Disks, func(i, j int) bool { return status.Disks[i].Name < status.Disks[j].Name })
+		}
+		h.lastDisk = diskCounters
+	}
+
+	netCounters, err := net.IOCounters(true)
+	if err != nil {
+		logger.Debugf("get host network io error, msg:%s", err)
+	} else {
+		current := make(map[string]net.IOCountersStat, len(netCounters))
+		for _, c := range netCounters {
+			if c.Name == "lo" {
+				continue
+			}
+			current[c.Name] = c
+			if last, ok := h.lastNet[c.Name]; ok && elapsed > 0 {
+				status.Nets = append(status.Nets, NetStatus{
+					Name:          c.Name,
+					RecvBytesRate: rate(last.BytesRecv, c.BytesRecv, elapsed),
+					SentBytesRate: rate(last.BytesSent, c.BytesSent, elapsed),
+				})
+			}
+		}
+		h.lastNet = current
+	}
+
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		logger.Debugf("get host partitions error, msg:%s", err)
+	}
+	devices := make(map[string]struct{}, len(partitions))
+	for _, partition := range partitions {
+		if _, ok := devices[partition.Device]; ok {
+			continue
+		}
+		devices[partition.Device] = struct{}{}
+		usage, err := disk.Usage(partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		status.FileSystems = append(status.FileSystems, FileSystemStatus{
+			Path:        partition.Mountpoint,
+			Device:      partition.Device,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+
+	h.lastTime = now
+	h.status = status
+	return status
+}
+
+// rate returns per second increase of a counter, 0 if the counter is reset
+func rate(last, current uint64, seconds float64) float64 {
+	if current < last {
+		return 0
+	}
+	return float64(current-last) / seconds
+}
+
+// readMemPressure reads `some avg10` from linux PSI file, such as
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+func readMemPressure(path string) (float64, error) {
+	v, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(v), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("no avg10 in %s", path)
+}
+
+func (h *HostCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range h.descs {
+		descs <- desc
+	}
+}
+
+func (h *HostCollector) Collect(metrics chan<- prometheus.Metric) {
+	status := h.Status()
+	if status == nil {
+		return
+	}
+	gauge := func(name string, value float64, labels ...string) {
+		metrics <- prometheus.MustNewConstMetric(h.descs[name], prometheus.GaugeValue, value, labels...)
+	}
+	gauge("load1", status.Load1)
+	gauge("load5", status.Load5)
+	gauge("load15", status.Load15)
+	gauge("mem_total", float64(status.MemTotal))
+	gauge("mem_available", float64(status.MemAvailable))
+	gauge("mem_used_percent", status.MemUsedPercent)
+	gauge("swap_used_percent", status.SwapUsedPercent)
+	if status.MemPressure >= 0 {
+		gauge("mem_pressure", status.MemPressure)
+	}
+	for _, d := range status.Disks {
+		gauge("disk_read_bytes_rate", d.ReadBytesRate, d.Name)
+		gauge("disk_write_bytes_rate", d.WriteBytesRate, d.Name)
+		gauge("disk_read_ops_rate", d.ReadOpsRate, d.Name)
+		gauge("disk_write_ops_rate", d.WriteOpsRate, d.Name)
+	}
+	for _, fs := range status.FileSystems {
+		gauge("fs_total", float64(fs.Total), fs.Path, fs.Device)
+		gauge("fs_used", float64(fs.Used), fs.Path, fs.Device)
+		gauge("fs_used_percent", fs.UsedPercent, fs.Path, fs.Device)
+	}
+	for _, n := range status.Nets {
+		gauge("net_recv_bytes_rate", n.RecvBytesRate, n.Name)
+		gauge("net_sent_bytes_rate", n.SentBytesRate, n.Name)
+	}
+}
+
+// StartHostMonitor collects host metrics every rotation interval and writes them to `keeper_host`. The database is
+// connected on the first tick it is reachable, host metrics are still collected and exported until then.
+func StartHostMonitor(identity string, conf *config.Config) *HostCollector {
+	identity = keeperIdentity(identity, conf)
+	interval, err := time.ParseDuration(conf.RotationInterval)
+	if err != nil {
+		panic(err)
+	}
+
+	collector := NewHostCollector(conf.Metrics.Prefix)
+	collector.collect()
+	collector.connect(conf)
+
+	collector.ticker = time.NewTicker(interval)
+	collector.done = make(chan struct{})
+	ticker, done := collector.ticker, collector.done
+	_ = pool.GoroutinePool.Submit(func() {
+		for {
+			select {
+			case <-ticker.C:
+				status := collector.collect()
+				conn := collector.connect(conf)
+				if conn == nil {
+					continue
+				}
+				writeHostStatus(conn, identity, status)
+			case <-done:
+				return
+			}
+		}
+	})
+	return collector
+}
+
+// connect returns the connection writing `keeper_host`, it connects and creates the stable if not connected yet.
+func (h *HostCollector) connect(conf *config.Config) *db.Connector {
+	h.connLock.Lock()
+	defer h.connLock.Unlock()
+	if h.conn != nil || h.closed {
+		return h.conn
+	}
+	conn, err := db.DefaultManager.Get(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host,
+		conf.TDengine.Port, conf.Metrics.Database.Name, conf.TDengine.Usessl)
+	if err != nil {
+		logger.Errorf("connect to database error, retry next interval, msg:%s", err)
+		return nil
+	}
+	if _, err = conn.Exec(context.Background(), CreateKeeperHostSql, util.GetQidOwn()); err != nil {
+		logger.Errorf("execute sql:%s, error:%s", CreateKeeperHostSql, err)
+		_ = conn.Close()
+		return nil
+	}
+	h.conn = conn
+	return conn
+}
+
+// Stop stops writing host metrics, the latest status is still exported.
+func (h *HostCollector) Stop() {
+	if h.ticker == nil {
+		return
+	}
+	h.ticker.Stop()
+	close(h.done)
+	h.ticker = nil
+}
+
+// Close closes the connection used to write `keeper_host`.
+func (h *HostCollector) Close() error {
+	h.connLock.Lock()
+	defer h.connLock.Unlock()
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+func hostTableName(identity, kind, device string) string {
+	name := fmt.Sprintf("kh_%s_%s_%s", identity, kind, device)
+	if len(name) <= util.MAX_TABLE_NAME_LEN {
+		return util.ToValidTableName(name)
+	}
+	return "kh_" + util.GetMd5HexStr(name)
+}
+
+// lengths of tags of keeper_host
+const (
+	hostIdentityLen = 50
+	hostDeviceLen   = 128
+)
+
+// hostTagValue returns value escaped as a string literal, a value longer than size keeps its head followed by md5 of
+// the whole value so that it still tells devices apart.
+func hostTagValue(value string, size int) string {
+	if runes := []rune(value); len(runes) > size {
+		value = string(runes[:size-33]) + "~" + util.GetMd5HexStr(value)
+	}
+	return strings.ReplaceAll(value, "'", "''")
+}
+
+// finite reports whether values can be written, NaN and Inf fail the whole insert.
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostRows returns rows of status for insert, each one names its sub table. Rows with values that can not be written
+// are skipped so that they do not fail the others.
+func hostRows(identity string, status *HostStatus) []string {
+	ts := status.CollectTime.UnixMilli()
+	identityTag := hostTagValue(identity, hostIdentityLen)
+	var rows []string
+	var b strings.Builder
+	using := func(kind, device, columns string) {
+		b.Reset()
+		fmt.Fprintf(&b, "`%s` using keeper_host tags ('%s', '%s', '%s') (ts, %s) values (%d, ",
+			hostTableName(identity, kind, device), identityTag, kind, hostTagValue(device, hostDeviceLen), columns, ts)
+	}
+	skip := func(kind, device string) {
+		logger.Warnf("skip %s row of host metrics with invalid values, device:%s", kind, device)
+	}
+
+	if finite(status.Load1, status.Load5, status.Load15, status.MemUsedPercent, status.SwapUsedPercent,
+		status.MemPressure) {
+		using("host", "", "load1, load5, load15, mem_total, mem_available, mem_used_percent, swap_used_percent, mem_pressure")
+		fmt.Fprintf(&b, "%f, %f, %f, %d, %d, %f, %f, ", status.Load1, status.Load5, status.Load15, status.MemTotal,
+			status.MemAvailable, status.MemUsedPercent, status.SwapUsedPercent)
+		if status.MemPressure >= 0 {
+			fmt.Fprintf(&b, "%f)", status.MemPressure)
+		} else {
+			b.WriteString("null)")
+		}
+		rows = append(rows, b.String())
+	} else {
+		skip("host", "")
+	}
+	for _, d := range status.Disks {
+		if !finite(d.ReadBytesRate, d.WriteBytesRate, d.ReadOpsRate, d.WriteOpsRate) {
+			skip("disk", d.Name)
+			continue
+		}
+		using("disk", d.Name, "read_bytes_rate, write_bytes_rate, read_ops_rate, write_ops_rate")
+		fmt.Fprintf(&b, "%f, %f, %f, %f)", d.ReadBytesRate, d.WriteBytesRate, d.ReadOpsRate, d.WriteOpsRate)
+		rows = append(rows, b.String())
+	}
+	for _, fs := range status.FileSystems {
+		if !finite(fs.UsedPercent) {
+			skip("fs", fs.Path)
+			continue
+		}
+		using("fs", fs.Path, "fs_total, fs_used, fs_used_percent")
+		fmt.Fprintf(&b, "%d, %d, %f)", fs.Total, fs.Used, fs.UsedPercent)
+		rows = append(rows, b.String())
+	}
+	for _, n := range status.Nets {
+		if !finite(n.RecvBytesRate, n.SentBytesRate) {
+			skip("net", n.Name)
+			continue
+		}
+		using("net", n.Name, "recv_bytes_rate, sent_bytes_rate")
+		fmt.Fprintf(&b, "%f, %f)", n.RecvBytesRate, n.SentBytesRate)
+		rows = append(rows, b.String())
+	}
+	return rows
+}
+
+// writeHostStatus inserts all rows of status at once, rows are inserted one by one if that fails so that a bad row
+// only loses itself.
+func writeHostStatus(conn *db.Connector, identity string, status *HostStatus) {
+	rows := hostRows(identity, status)
+	if len(rows) == 0 {
+		return
+	}
+	sql := "insert into " + strings.Join(rows, " ")
+	_, err := conn.Exec(context.Background(), sql, util.GetQidOwn())
+	if err == nil || len(rows) == 1 {
+		if err != nil {
+			logger.Errorf("execute sql:%s, error:%s", sql, err)
+		}
+		return
+	}
+	logger.Warnf("insert host metrics error, insert rows one by one, msg:%s", err)
+	for _, row := range rows {
+		sql := "insert into " + row
+		if _, err := conn.Exec(context.Background(), sql, util.GetQidOwn()); err != nil {
+			logger.Errorf("execute sql:%s, error:%s", sql, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/pool"
+)
+
+func TestReadMemPressure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory")
+	assert.NoError(t, os.WriteFile(path, []byte("some avg10=1.25 avg60=0.50 avg300=0.10 total=123\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"), 0644))
+	pressure, err := readMemPressure(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.25, pressure)
+
+	_, err = readMemPressure(filepath.Join(t.TempDir(), "not_exists"))
+	assert.Error(t, err)
+}
+
+func TestRate(t *testing.T) {
+	assert.Equal(t, float64(50), rate(100, 200, 2))
+	assert.Equal(t, float64(0), rate(200, 100, 2))
+}
+
+func TestHostRows(t *testing.T) {
+	status := &HostStatus{
+		CollectTime: time.UnixMilli(1703226836762),
+		Load1:       1,
+		MemTotal:    1024,
+		MemPressure: -1,
+		Disks:       []DiskStatus{{Name: "sda", ReadBytesRate: 10}},
+		FileSystems: []FileSystemStatus{{Path: "/", Device: "/dev/sda1", Total: 100, Used: 50, UsedPercent: 50}},
+		Nets:        []NetStatus{{Name: "eth0", RecvBytesRate: 1, SentBytesRate: 2}},
+	}
+	rows := hostRows("host:6043", status)
+	assert.Len(t, rows, 4)
+	assert.True(t, strings.HasPrefix(rows[0], "`kh_host_6043_host_` using keeper_host tags ('host:6043', 'host', '') "))
+	sql := strings.Join(rows, " ")
+	assert.Contains(t, sql, "1024, 0, 0.000000, 0.000000, null) ")
+	assert.Contains(t, sql, "`kh_host_6043_disk_sda` using keeper_host tags ('host:6043', 'disk', 'sda') (ts, read_bytes_rate, write_bytes_rate, read_ops_rate, write_ops_rate) values (1703226836762, 10.000000, ")
+	assert.Contains(t, sql, "`kh_host_6043_fs__` using keeper_host tags ('host:6043', 'fs', '/') (ts, fs_total, fs_used, fs_used_percent) values (1703226836762, 100, 50, 50.000000) ")
+	assert.Contains(t, sql, "`kh_host_6043_net_eth0`")
+	assert.True(t, strings.HasPrefix(hostTableName("host", "fs", strings.Repeat("/data", 50)), "kh_"))
+	assert.Equal(t, 35, len(hostTableName("host", "fs", strings.Repeat("/data", 50))))
+}
+
+func TestHostRowsInvalid(t *testing.T) {
+	mount := "/var/lib/kubelet/pods/" + strings.Repeat("a", 36) + "/volumes/kubernetes.io~csi/pvc-" +
+		strings.Repeat("b", 36) + "/mount"
+	status := &HostStatus{
+		CollectTime: time.UnixMilli(1703226836762),
+		MemPressure: -1,
+		Disks:       []DiskStatus{{Name: "sda", ReadBytesRate: math.NaN()}},
+		FileSystems: []FileSystemStatus{{Path: mount, Total: 100, Used: 50, UsedPercent: 50}},
+	}
+	sql := strings.Join(hostRows("it's:6043", status), " ")
+	// quotes in identity are escaped and long devices are cut to the tag length with their md5
+	assert.Contains(t, sql, "tags ('it''s:6043', 'host', '') ")
+	device := mount[:hostDeviceLen-33] + "~" + util.GetMd5HexStr(mount)
+	assert.Equal(t, hostDeviceLen, len(device))
+	assert.Contains(t, sql, "tags ('it''s:6043', 'fs', '"+device+"') ")
+	// rows with values that can not be written are skipped
+	assert.NotContains(t, sql, "'disk'")
+
+	status.Load1 = math.Inf(1)
+	status.FileSystems = nil
+	assert.Empty(t, hostRows("host", status))
+}
+
+func TestHostCollector(t *testing.T) {
+	collector := NewHostCollector("taos")
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(collector)
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	collector.collect()
+	status := collector.collect()
+	assert.Same(t, status, collector.Status())
+	families, err = reg.Gather()
+	assert.NoError(t, err)
+	names := make(map[string]struct{}, len(families))
+	for _, family := range families {
+		names[family.GetName()] = struct{}{}
+	}
+	assert.Contains(t, names, "taos_keeper_host_load1")
+	assert.Contains(t, names, "taos_keeper_host_mem_total")
+}
+
+func TestStartHostMonitorWithoutDatabase(t *testing.T) {
+	if pool.GoroutinePool == nil {
+		pool.Init(1)
+	}
+	manager := db.DefaultManager
+	db.DefaultManager = db.NewManager(db.PoolConfig{})
+	assert.NoError(t, db.DefaultManager.Close())
+	defer func() { db.DefaultManager = manager }()
+
+	collector := StartHostMonitor("test", &config.Config{RotationInterval: "10ms"})
+	defer collector.Stop()
+	first := collector.collect().CollectTime
+	assert.Eventually(t, func() bool {
+		collector.RLock()
+		defer collector.RUnlock()
+		return collector.status.CollectTime.After(first)
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, collector.connect(&config.Config{}))
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+var limitNames = []string{api.LimitBodySize, api.LimitInFlight, api.LimitClientIP, api.LimitCluster, api.LimitDecompressedSize}
+
+// LimitCollector exports requests rejected by limits of ingestion endpoints.
+type LimitCollector struct {
+	limits *api.Limits
+	hits   *prometheus.Desc
+}
+
+func NewLimitCollector(prefix string, limits *api.Limits) *LimitCollector {
+	return &LimitCollector{
+		limits: limits,
+		hits: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_limit", "hits_total"),
+			"requests rejected, by limit", []string{"limit"}, nil),
+	}
+}
+
+func (c *LimitCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.hits
+}
+
+func (c *LimitCollector) Collect(metrics chan<- prometheus.Metric) {
+	hits := c.limits.Hits()
+	for _, limit := range limitNames {
+		metrics <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(hits[limit]), limit)
+	}
+}
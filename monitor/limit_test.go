@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/api"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestLimitCollector(t *testing.T) {
+	limits := api.NewLimits(config.LimitConfig{MaxBodySize: 1})
+	router := gin.New()
+	router.POST("/report", limits.Handler(), func(c *gin.Context) {})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/report", strings.NewReader("12")))
+
+	values := gatherValues(t, NewLimitCollector("taos", limits))
+	assert.Len(t, values, 5)
+	assert.Equal(t, float64(1), values["taos_keeper_limit_hits_total_body_size"])
+	assert.Equal(t, float64(0), values["taos_keeper_limit_hits_total_cluster_id"])
+}
@@ -1,22 +1,20 @@
 package monitor
 
 import (
-	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/taosdata/taoskeeper/api"
-	"github.com/taosdata/taoskeeper/db"
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
-	"github.com/taosdata/taoskeeper/util"
-	"github.com/taosdata/taoskeeper/util/pool"
 )
 
 var logger = log.GetLogger("MON")
 
-func StartMonitor(identity string, conf *config.Config, reporter *api.Reporter) {
+// keeperIdentity returns identity of this keeper, hostname:port if not given
+func keeperIdentity(identity string, conf *config.Config) string {
 	if len(identity) == 0 {
 		hostname, err := os.Hostname()
 		if err != nil {
@@ -27,63 +25,47 @@ func StartMonitor(identity string, conf *config.Config, reporter *api.Reporter)
 		}
 		identity = fmt.Sprintf("%s:%d", hostname, conf.Port)
 	}
+	return identity
+}
 
-	systemStatus := make(chan SysStatus)
-	_ = pool.GoroutinePool.Submit(func() {
-		var (
-			cpuPercent  float64
-			memPercent  float64
-			totalReport int
-		)
-
-		for status := range systemStatus {
-			if status.CpuError == nil {
-				cpuPercent = status.CpuPercent
-			}
-			if status.MemError == nil {
-				memPercent = status.MemPercent
-			}
-
-			totalResp := reporter.GetTotalRep()
-			for i := 0; i < 3; i++ {
-				totalReport = totalResp.Load().(int)
-				if totalResp.CompareAndSwap(totalReport, 0) {
-					break
-				}
-				logger.Warn("Reset keeper_monitor total resp via cas fail! Maybe to many concurrent ")
-				reporter.GetTotalRep().Store(0)
-			}
-
-			var kn string
-			if len(identity) <= util.MAX_TABLE_NAME_LEN {
-				kn = util.ToValidTableName(identity)
-			} else {
-				kn = util.GetMd5HexStr(identity)
-			}
-
-			sql := fmt.Sprintf("insert into `km_%s` using keeper_monitor tags ('%s') values ( now, "+
-				" %f, %f, %d)", kn, identity, cpuPercent, memPercent, totalReport)
-			conn, err := db.NewConnectorWithDb(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host,
-				conf.TDengine.Port, conf.Metrics.Database.Name, conf.TDengine.Usessl)
-			if err != nil {
-				logger.Errorf("connect to database error, msg:%s", err)
-				return
-			}
-
-			ctx := context.Background()
-			if _, err = conn.Exec(ctx, sql, util.GetQidOwn()); err != nil {
-				logger.Errorf("execute sql:%s, error:%s", sql, err)
-			}
+func StartMonitor(identity string, conf *config.Config, reporter *api.Reporter) {
+	identity = keeperIdentity(identity, conf)
 
-			if err := conn.Close(); err != nil {
-				logger.Errorf("close connection error, msg:%s", err)
-			}
-		}
-	})
-	SysMonitor.Register(systemStatus)
+	SysMonitor.reporter = reporter
+	SysMonitor.Subscribe(NewTDengineSubscriber(identity, conf, conf.Monitor.BatchSize))
 	interval, err := time.ParseDuration(conf.RotationInterval)
 	if err != nil {
 		panic(err)
 	}
 	Start(interval, conf.Env.InCGroup)
 }
+
+var keeperMonitorColumns = "ts, cpu, mem, total_reports, goroutines, threads, rss, open_fds, gc_count, gc_pause_total, " +
+	"gc_pause_last, in_flight, " + strings.Join(EndpointColumns, ", ") + ", last_write"
+
+// telemetryValues formats the self telemetry of keeper in the column order of keeperMonitorColumns
+func telemetryValues(status SysStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d, %d, ", status.GoroutineCounts, status.ThreadCounts)
+	if status.RSSError == nil {
+		fmt.Fprintf(&b, "%d, ", status.RSS)
+	} else {
+		b.WriteString("null, ")
+	}
+	if status.OpenFDsError == nil {
+		fmt.Fprintf(&b, "%d, ", status.OpenFDs)
+	} else {
+		b.WriteString("null, ")
+	}
+	fmt.Fprintf(&b, "%d, %f, %f, %d", status.GCCount, float64(status.GCPauseTotal)/float64(time.Millisecond),
+		float64(status.GCPauseLast)/float64(time.Millisecond), status.InFlight)
+	for _, column := range EndpointColumns {
+		fmt.Fprintf(&b, ", %d", status.EndpointCounts[column])
+	}
+	if status.LastWrite.IsZero() {
+		b.WriteString(", null")
+	} else {
+		fmt.Fprintf(&b, ", %d", status.LastWrite.UnixMilli())
+	}
+	return b.String()
+}
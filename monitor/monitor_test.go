@@ -2,11 +2,17 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/taosdata/go-utils/web"
 	"github.com/taosdata/taoskeeper/api"
@@ -56,3 +62,101 @@ func TestParseUint(t *testing.T) {
 	assert.Equal(t, "strconv.ParseUint: parsing \"257\": value out of range", err.Error())
 	assert.Equal(t, uint64(0), num)
 }
+
+func TestTelemetryValues(t *testing.T) {
+	status := SysStatus{
+		GoroutineCounts: 10,
+		ThreadCounts:    5,
+		RSS:             1024,
+		OpenFDsError:    errors.New("not supported"),
+		GCCount:         2,
+		GCPauseTotal:    3 * time.Millisecond,
+		GCPauseLast:     time.Millisecond,
+		InFlight:        1,
+		EndpointCounts:  map[string]int{"req_report": 3, "req_other": 1},
+	}
+	assert.Equal(t, "10, 5, 1024, null, 2, 3.000000, 1.000000, 1, 3, 0, 0, 0, 0, 0, 1, null", telemetryValues(status))
+
+	status.LastWrite = time.UnixMilli(1703226836762)
+	assert.True(t, strings.HasSuffix(telemetryValues(status), ", 1703226836762"))
+	assert.Equal(t, len(strings.Split(keeperMonitorColumns, ",")), len(strings.Split(telemetryValues(status), ","))+4)
+}
+
+func TestGinStats(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(GinStats())
+	router.POST("report", func(c *gin.Context) {
+		assert.Equal(t, 1, reqStats.loadInFlight())
+		c.Status(http.StatusOK)
+	})
+	reqStats.take()
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/report", nil)
+		router.ServeHTTP(w, req)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/not_exists", nil)
+	router.ServeHTTP(w, req)
+
+	counts := reqStats.take()
+	assert.Equal(t, 2, counts["req_report"])
+	assert.Equal(t, 1, counts["req_other"])
+	assert.Equal(t, 0, reqStats.loadInFlight())
+	assert.Empty(t, reqStats.take())
+}
+
+type stubCollector struct {
+	cpu float64
+}
+
+func (c *stubCollector) CpuPercent() (float64, error) { return c.cpu, nil }
+func (c *stubCollector) MemPercent() (float64, error) { return 1, nil }
+func (c *stubCollector) RSS() (uint64, error)         { return 1, nil }
+func (c *stubCollector) OpenFDs() (int32, error)      { return 1, nil }
+
+func TestCollectKeepsCountersOfDroppedSamples(t *testing.T) {
+	collector := &stubCollector{cpu: math.NaN()}
+	s := &sysMonitor{collector: collector, status: &SysStatus{}}
+	reqStats.take()
+	reqStats.add(map[string]int{"req_report": 2})
+
+	// nan sample is skipped
+	s.collect()
+	// no subscriber takes the sample
+	collector.cpu = 1
+	full := make(chan SysStatus)
+	s.Register(full)
+	s.collect()
+
+	output := make(chan SysStatus, 1)
+	s.Register(output)
+	s.collect()
+	status := <-output
+	assert.Equal(t, 2, status.EndpointCounts["req_report"])
+	assert.Empty(t, reqStats.take())
+}
+
+func TestCollectKeepsCountersOfBusyOutputs(t *testing.T) {
+	s := &sysMonitor{collector: &stubCollector{cpu: 1}, status: &SysStatus{}}
+	reqStats.take()
+	fast := make(chan SysStatus, 1)
+	busy := make(chan SysStatus, 1)
+	s.Register(fast)
+	s.Register(busy)
+	// busy is still holding the previous sample
+	busy <- SysStatus{}
+
+	reqStats.add(map[string]int{"req_report": 2})
+	s.collect()
+	assert.Equal(t, 2, (<-fast).EndpointCounts["req_report"])
+
+	<-busy
+	reqStats.add(map[string]int{"req_report": 1})
+	s.collect()
+	assert.Equal(t, 1, (<-fast).EndpointCounts["req_report"])
+	// counters of the sample busy missed are added to its next one
+	assert.Equal(t, 3, (<-busy).EndpointCounts["req_report"])
+}
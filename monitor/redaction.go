@@ -0,0 +1,31 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+// RedactionCollector exports slow queries redacted before stored.
+type RedactionCollector struct {
+	redactor   *api.Redactor
+	redactions *prometheus.Desc
+}
+
+func NewRedactionCollector(prefix string, redactor *api.Redactor) *RedactionCollector {
+	return &RedactionCollector{
+		redactor: redactor,
+		redactions: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_slow_sql", "redactions_total"),
+			"slow queries redacted, by action", []string{"action"}, nil),
+	}
+}
+
+func (c *RedactionCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.redactions
+}
+
+func (c *RedactionCollector) Collect(metrics chan<- prometheus.Metric) {
+	counts := c.redactor.Counts()
+	for _, action := range api.RedactionActions {
+		metrics <- prometheus.MustNewConstMetric(c.redactions, prometheus.CounterValue, float64(counts[action]), action)
+	}
+}
@@ -0,0 +1,24 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/api"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestRedactionCollector(t *testing.T) {
+	redactor, err := api.NewRedactor(config.RedactionConfig{MaskLiterals: true, DropUsers: []string{"audit"}})
+	assert.NoError(t, err)
+	redactor.Redact(api.SlowSqlDetailInfo{User: "root", Sql: "select * from t where id = 1"})
+	redactor.Redact(api.SlowSqlDetailInfo{User: "audit", Sql: "select 1"})
+	redactor.Redact(api.SlowSqlDetailInfo{User: "audit", Sql: "select 1"})
+
+	values := gatherValues(t, NewRedactionCollector("taos", redactor))
+	assert.Equal(t, map[string]float64{
+		"taos_keeper_slow_sql_redactions_total_masked":  1,
+		"taos_keeper_slow_sql_redactions_total_rule":    0,
+		"taos_keeper_slow_sql_redactions_total_dropped": 2,
+	}, values)
+}
@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// endpoint route to keeper_monitor column
+var endpointColumns = map[string]string{
+	"/report":                "req_report",
+	"/adapter_report":        "req_adapter_report",
+	"/general-metric":        "req_general_metric",
+	"/taosd-cluster-basic":   "req_taosd_cluster_basic",
+	"/slow-sql-detail-batch": "req_slow_sql_detail_batch",
+	"/metrics":               "req_metrics",
+}
+
+const otherEndpointColumn = "req_other"
+
+// EndpointColumns is the column order of per-endpoint request counts in keeper_monitor
+var EndpointColumns = []string{
+	"req_report",
+	"req_adapter_report",
+	"req_general_metric",
+	"req_taosd_cluster_basic",
+	"req_slow_sql_detail_batch",
+	"req_metrics",
+	otherEndpointColumn,
+}
+
+type requestStats struct {
+	inFlight int64
+	sync.Mutex
+	counts map[string]int
+}
+
+var reqStats = &requestStats{counts: map[string]int{}}
+
+// GinStats counts in-flight and finished requests of each endpoint for keeper_monitor.
+func GinStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		atomic.AddInt64(&reqStats.inFlight, 1)
+		defer atomic.AddInt64(&reqStats.inFlight, -1)
+
+		c.Next()
+
+		column, ok := endpointColumns[c.FullPath()]
+		if !ok {
+			column = otherEndpointColumn
+		}
+		reqStats.Lock()
+		reqStats.counts[column]++
+		reqStats.Unlock()
+	}
+}
+
+func (r *requestStats) loadInFlight() int {
+	return int(atomic.LoadInt64(&r.inFlight))
+}
+
+// take returns request counts since last call and resets them
+func (r *requestStats) take() map[string]int {
+	r.Lock()
+	defer r.Unlock()
+	counts := r.counts
+	r.counts = make(map[string]int, len(counts))
+	return counts
+}
+
+// add adds counts back, used when a sample taking them is dropped
+func (r *requestStats) add(counts map[string]int) {
+	r.Lock()
+	defer r.Unlock()
+	for column, n := range counts {
+		r.counts[column] += n
+	}
+}
+
+// InFlight returns the number of requests being handled.
+func InFlight() int {
+	return reqStats.loadInFlight()
+}
@@ -0,0 +1,309 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/db"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+	"github.com/taosdata/taoskeeper/util"
+	"github.com/taosdata/taoskeeper/util/pool"
+)
+
+// Subscriber consumes every SysStatus collected by SysMonitor.
+type Subscriber interface {
+	Consume(status SysStatus)
+}
+
+// Subscribe registers a channel for subscriber and consumes it in a goroutine. Status is dropped if the
+// subscriber is still busy with the previous one, its counters are added to the next status the subscriber takes.
+func (s *sysMonitor) Subscribe(subscriber Subscriber) {
+	c := make(chan SysStatus, 1)
+	s.Register(c)
+	s.Lock()
+	s.subscribers = append(s.subscribers, subscriber)
+	s.Unlock()
+	_ = pool.GoroutinePool.Submit(func() {
+		for status := range c {
+			subscriber.Consume(status)
+		}
+	})
+}
+
+// TDengineSubscriber writes SysStatus into keeper_monitor in batches through a long-lived connection.
+type TDengineSubscriber struct {
+	sync.Mutex
+	identity  string
+	tableName string
+	batchSize int
+	conf      *config.Config
+	conn      *db.Connector
+
+	cpuPercent float64
+	memPercent float64
+	rows       []string
+}
+
+func NewTDengineSubscriber(identity string, conf *config.Config, batchSize int) *TDengineSubscriber {
+	var kn string
+	if len(identity) <= util.MAX_TABLE_NAME_LEN {
+		kn = util.ToValidTableName(identity)
+	} else {
+		kn = util.GetMd5HexStr(identity)
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &TDengineSubscriber{
+		identity:  identity,
+		tableName: "km_" + kn,
+		batchSize: batchSize,
+		conf:      conf,
+	}
+}
+
+func (t *TDengineSubscriber) Consume(status SysStatus) {
+	t.Lock()
+	defer t.Unlock()
+	// keep the last value when failed to collect
+	if status.CpuError == nil {
+		t.cpuPercent = status.CpuPercent
+	}
+	if status.MemError == nil {
+		t.memPercent = status.MemPercent
+	}
+	t.rows = append(t.rows, fmt.Sprintf("(%d, %f, %f, %d, %s)", status.CollectTime.UnixMilli(), t.cpuPercent,
+		t.memPercent, status.TotalReports, telemetryValues(status)))
+	if len(t.rows) < t.batchSize {
+		return
+	}
+	_ = t.flush(context.Background())
+}
+
+// Flush writes buffered rows regardless of batch size.
+func (t *TDengineSubscriber) Flush(ctx context.Context) error {
+	t.Lock()
+	defer t.Unlock()
+	return t.flush(ctx)
+}
+
+// Close closes the connection, rows not flushed are dropped.
+func (t *TDengineSubscriber) Close() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *TDengineSubscriber) flush(ctx context.Context) error {
+	if len(t.rows) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "insert into `%s` using keeper_monitor tags ('%s') (%s) values ", t.tableName, t.identity,
+		keeperMonitorColumns)
+	for _, row := range t.rows {
+		b.WriteString(row)
+		b.WriteByte(' ')
+	}
+	sql := b.String()
+
+	if t.conn == nil {
+		conn, err := db.DefaultManager.Get(t.conf.TDengine.Username, t.conf.TDengine.Password, t.conf.TDengine.Host,
+			t.conf.TDengine.Port, t.conf.Metrics.Database.Name, t.conf.TDengine.Usessl)
+		if err != nil {
+			logger.Errorf("connect to database error, msg:%s", err)
+			return err
+		}
+		t.conn = conn
+	}
+	if _, err := t.conn.Exec(ctx, sql, util.GetQidOwn()); err != nil {
+		logger.Errorf("execute sql:%s, error:%s", sql, err)
+		// keep at most one batch of rows to retry with next batch
+		if len(t.rows) >= 2*t.batchSize {
+			t.rows = t.rows[len(t.rows)-t.batchSize:]
+		}
+		return err
+	}
+	t.rows = t.rows[:0]
+	return nil
+}
+
+// PrometheusSubscriber exports the latest SysStatus as gauges.
+type PrometheusSubscriber struct {
+	sync.RWMutex
+	status *SysStatus
+	descs  map[string]*prometheus.Desc
+}
+
+func NewPrometheusSubscriber(prefix string) *PrometheusSubscriber {
+	p := &PrometheusSubscriber{descs: map[string]*prometheus.Desc{}}
+	newDesc := func(name, help string, labels ...string) {
+		p.descs[name] = prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper", name), help, labels, nil)
+	}
+	newDesc("cpu_percent", "cpu percent of keeper")
+	newDesc("mem_percent", "memory percent of keeper")
+	newDesc("total_reports", "reports received in last interval")
+	newDesc("goroutines", "goroutines of keeper")
+	newDesc("threads", "threads created by keeper")
+	newDesc("rss", "resident set size of keeper in bytes")
+	newDesc("open_fds", "open file descriptors of keeper")
+	newDesc("gc_count", "completed gc cycles of keeper")
+	newDesc("gc_pause_total", "total gc pause of keeper in milliseconds")
+	newDesc("gc_pause_last", "latest gc pause of keeper in milliseconds")
+	newDesc("in_flight", "requests being handled by keeper")
+	newDesc("requests", "requests finished in last interval", "endpoint")
+	newDesc("last_write", "unix milliseconds of the latest successful write of reported data")
+	return p
+}
+
+func (p *PrometheusSubscriber) Consume(status SysStatus) {
+	p.Lock()
+	p.status = &status
+	p.Unlock()
+}
+
+func (p *PrometheusSubscriber) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range p.descs {
+		descs <- desc
+	}
+}
+
+func (p *PrometheusSubscriber) Collect(metrics chan<- prometheus.Metric) {
+	p.RLock()
+	status := p.status
+	p.RUnlock()
+	if status == nil {
+		return
+	}
+	gauge := func(name string, value float64, labels ...string) {
+		metrics <- prometheus.MustNewConstMetric(p.descs[name], prometheus.GaugeValue, value, labels...)
+	}
+	if status.CpuError == nil {
+		gauge("cpu_percent", status.CpuPercent)
+	}
+	if status.MemError == nil {
+		gauge("mem_percent", status.MemPercent)
+	}
+	gauge("total_reports", float64(status.TotalReports))
+	gauge("goroutines", float64(status.GoroutineCounts))
+	gauge("threads", float64(status.ThreadCounts))
+	if status.RSSError == nil {
+		gauge("rss", float64(status.RSS))
+	}
+	if status.OpenFDsError == nil {
+		gauge("open_fds", float64(status.OpenFDs))
+	}
+	gauge("gc_count", float64(status.GCCount))
+	gauge("gc_pause_total", float64(status.GCPauseTotal)/float64(time.Millisecond))
+	gauge("gc_pause_last", float64(status.GCPauseLast)/float64(time.Millisecond))
+	gauge("in_flight", float64(status.InFlight))
+	for _, column := range EndpointColumns {
+		gauge("requests", float64(status.EndpointCounts[column]), column)
+	}
+	if !status.LastWrite.IsZero() {
+		gauge("last_write", float64(status.LastWrite.UnixMilli()))
+	}
+}
+
+// HistorySubscriber keeps the last N SysStatus in memory and serves them at /keeper/status.
+type HistorySubscriber struct {
+	sync.RWMutex
+	samples []StatusSample
+	next    int
+	full    bool
+}
+
+// StatusSample is the json view of SysStatus
+type StatusSample struct {
+	CollectTime    time.Time      `json:"collect_time"`
+	CpuPercent     *float64       `json:"cpu_percent"`
+	MemPercent     *float64       `json:"mem_percent"`
+	TotalReports   int            `json:"total_reports"`
+	Goroutines     int            `json:"goroutines"`
+	Threads        int            `json:"threads"`
+	RSS            *uint64        `json:"rss"`
+	OpenFDs        *int32         `json:"open_fds"`
+	GCCount        uint32         `json:"gc_count"`
+	GCPauseTotal   float64        `json:"gc_pause_total_ms"`
+	GCPauseLast    float64        `json:"gc_pause_last_ms"`
+	InFlight       int            `json:"in_flight"`
+	EndpointCounts map[string]int `json:"requests"`
+	LastWrite      *time.Time     `json:"last_write"`
+}
+
+func NewStatusSample(status SysStatus) StatusSample {
+	sample := StatusSample{
+		CollectTime:    status.CollectTime,
+		TotalReports:   status.TotalReports,
+		Goroutines:     status.GoroutineCounts,
+		Threads:        status.ThreadCounts,
+		GCCount:        status.GCCount,
+		GCPauseTotal:   float64(status.GCPauseTotal) / float64(time.Millisecond),
+		GCPauseLast:    float64(status.GCPauseLast) / float64(time.Millisecond),
+		InFlight:       status.InFlight,
+		EndpointCounts: status.EndpointCounts,
+	}
+	if status.CpuError == nil {
+		sample.CpuPercent = &status.CpuPercent
+	}
+	if status.MemError == nil {
+		sample.MemPercent = &status.MemPercent
+	}
+	if status.RSSError == nil {
+		sample.RSS = &status.RSS
+	}
+	if status.OpenFDsError == nil {
+		sample.OpenFDs = &status.OpenFDs
+	}
+	if !status.LastWrite.IsZero() {
+		sample.LastWrite = &status.LastWrite
+	}
+	return sample
+}
+
+func NewHistorySubscriber(size int) *HistorySubscriber {
+	if size < 1 {
+		size = 1
+	}
+	return &HistorySubscriber{samples: make([]StatusSample, size)}
+}
+
+func (h *HistorySubscriber) Consume(status SysStatus) {
+	h.Lock()
+	defer h.Unlock()
+	h.samples[h.next] = NewStatusSample(status)
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// Samples returns samples kept in memory, the oldest first.
+func (h *HistorySubscriber) Samples() []StatusSample {
+	h.RLock()
+	defer h.RUnlock()
+	if !h.full {
+		return append([]StatusSample{}, h.samples[:h.next]...)
+	}
+	samples := make([]StatusSample, 0, len(h.samples))
+	samples = append(samples, h.samples[h.next:]...)
+	return append(samples, h.samples[:h.next]...)
+}
+
+func (h *HistorySubscriber) Init(c gin.IRouter) {
+	c.GET("keeper/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.Samples())
+	})
+}
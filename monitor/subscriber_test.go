@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/util"
+)
+
+func TestHistorySubscriber(t *testing.T) {
+	history := NewHistorySubscriber(3)
+	assert.Empty(t, history.Samples())
+
+	base := time.UnixMilli(1703226836762)
+	for i := 0; i < 5; i++ {
+		history.Consume(SysStatus{CollectTime: base.Add(time.Duration(i) * time.Second), GoroutineCounts: i})
+	}
+	samples := history.Samples()
+	assert.Equal(t, 3, len(samples))
+	for i, sample := range samples {
+		assert.Equal(t, i+2, sample.Goroutines)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	history.Init(router)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/keeper/status", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result []StatusSample
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 3, len(result))
+	assert.Equal(t, 4, result[2].Goroutines)
+}
+
+func TestStatusSample(t *testing.T) {
+	sample := NewStatusSample(SysStatus{CpuPercent: 1, CpuError: errors.New("cpu error"), MemPercent: 2, RSS: 3})
+	assert.Nil(t, sample.CpuPercent)
+	assert.Equal(t, float64(2), *sample.MemPercent)
+	assert.Equal(t, uint64(3), *sample.RSS)
+	assert.Nil(t, sample.LastWrite)
+}
+
+func TestPrometheusSubscriber(t *testing.T) {
+	p := NewPrometheusSubscriber("taos")
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(p)
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	p.Consume(SysStatus{
+		CpuPercent:      1,
+		GoroutineCounts: 10,
+		OpenFDsError:    errors.New("not supported"),
+		EndpointCounts:  map[string]int{"req_report": 2},
+	})
+	families, err = reg.Gather()
+	assert.NoError(t, err)
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "_" + label.GetValue()
+			}
+			values[name] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, float64(1), values["taos_keeper_cpu_percent"])
+	assert.Equal(t, float64(10), values["taos_keeper_goroutines"])
+	assert.Equal(t, float64(2), values["taos_keeper_requests_req_report"])
+	assert.NotContains(t, values, "taos_keeper_open_fds")
+	assert.NotContains(t, values, "taos_keeper_last_write")
+}
+
+func TestTDengineSubscriberBatch(t *testing.T) {
+	s := NewTDengineSubscriber("host:6043", util.GetCfg(), 3)
+	assert.Equal(t, "km_host_6043", s.tableName)
+	s.Consume(SysStatus{CollectTime: time.UnixMilli(1703226836762), CpuPercent: 1, MemPercent: 2, TotalReports: 3})
+	s.Consume(SysStatus{CollectTime: time.UnixMilli(1703226837762), CpuError: errors.New("cpu error"), MemPercent: 4})
+	assert.Equal(t, 2, len(s.rows))
+	assert.Equal(t, "(1703226836762, 1.000000, 2.000000, 3, 0, 0, 0, 0, 0, 0.000000, 0.000000, 0, 0, 0, 0, 0, 0, 0, 0, null)", s.rows[0])
+	assert.Equal(t, "(1703226837762, 1.000000, 4.000000, 0, 0, 0, 0, 0, 0, 0.000000, 0.000000, 0, 0, 0, 0, 0, 0, 0, 0, null)", s.rows[1])
+}
@@ -1,11 +1,14 @@
 package monitor
 
 import (
+	"context"
+	"io"
 	"math"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/taosdata/taoskeeper/api"
 	"github.com/taosdata/taoskeeper/util/pool"
 )
 
@@ -17,6 +20,50 @@ type SysStatus struct {
 	MemError        error
 	GoroutineCounts int
 	ThreadCounts    int
+	RSS             uint64
+	RSSError        error
+	OpenFDs         int32
+	OpenFDsError    error
+	GCCount         uint32
+	GCPauseTotal    time.Duration
+	GCPauseLast     time.Duration
+	InFlight        int
+	EndpointCounts  map[string]int
+	LastWrite       time.Time
+	TotalReports    int
+}
+
+// pendingCounts are counters of samples an output missed, they are added to the next sample it takes.
+type pendingCounts struct {
+	endpoints map[string]int
+	reports   int
+}
+
+func (p *pendingCounts) add(endpoints map[string]int, reports int) {
+	if p.endpoints == nil {
+		p.endpoints = map[string]int{}
+	}
+	for column, n := range endpoints {
+		p.endpoints[column] += n
+	}
+	p.reports += reports
+}
+
+// sample returns status with counters pending for the output added.
+func (p *pendingCounts) sample(status SysStatus) SysStatus {
+	if len(p.endpoints) == 0 && p.reports == 0 {
+		return status
+	}
+	counts := make(map[string]int, len(status.EndpointCounts)+len(p.endpoints))
+	for column, n := range status.EndpointCounts {
+		counts[column] = n
+	}
+	for column, n := range p.endpoints {
+		counts[column] += n
+	}
+	status.EndpointCounts = counts
+	status.TotalReports += p.reports
+	return status
 }
 
 type sysMonitor struct {
@@ -24,8 +71,11 @@ type sysMonitor struct {
 	collectDuration time.Duration
 	collector       SysCollector
 	status          *SysStatus
-	outputs         map[chan<- SysStatus]struct{}
+	outputs         map[chan<- SysStatus]*pendingCounts
 	ticker          *time.Ticker
+	done            chan struct{}
+	reporter        *api.Reporter
+	subscribers     []Subscriber
 }
 
 func (s *sysMonitor) collect() {
@@ -34,30 +84,64 @@ func (s *sysMonitor) collect() {
 	s.status.MemPercent, s.status.MemError = s.collector.MemPercent()
 	s.status.GoroutineCounts = runtime.NumGoroutine()
 	s.status.ThreadCounts, _ = runtime.ThreadCreateProfile(nil)
-	// skip when inf or nan
+	s.status.RSS, s.status.RSSError = s.collector.RSS()
+	s.status.OpenFDs, s.status.OpenFDsError = s.collector.OpenFDs()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	s.status.GCCount = memStats.NumGC
+	s.status.GCPauseTotal = time.Duration(memStats.PauseTotalNs)
+	if memStats.NumGC > 0 {
+		s.status.GCPauseLast = time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256])
+	}
+	s.status.InFlight = reqStats.loadInFlight()
+	s.status.LastWrite = api.LastWriteTime()
+	// skip when inf or nan, counters are kept for the next sample
 	if math.IsInf(s.status.CpuPercent, 0) || math.IsNaN(s.status.CpuPercent) ||
 		math.IsInf(s.status.MemPercent, 0) || math.IsNaN(s.status.MemPercent) {
 		return
 	}
+	s.status.EndpointCounts = reqStats.take()
+	s.status.TotalReports = 0
+	if s.reporter != nil {
+		s.status.TotalReports = takeTotalReports(s.reporter)
+	}
 
 	s.Lock()
-	for output := range s.outputs {
+	delivered := false
+	var missed []*pendingCounts
+	for output, pending := range s.outputs {
 		select {
-		case output <- *s.status:
+		case output <- pending.sample(*s.status):
+			*pending = pendingCounts{}
+			delivered = true
 		default:
+			missed = append(missed, pending)
+		}
+	}
+	// outputs busy with the previous sample keep its counters for their next one
+	if delivered {
+		for _, pending := range missed {
+			pending.add(s.status.EndpointCounts, s.status.TotalReports)
 		}
 	}
 	s.Unlock()
+	// nobody took the sample, give its counters back to the next one
+	if !delivered {
+		reqStats.add(s.status.EndpointCounts)
+		if s.reporter != nil {
+			addTotalReports(s.reporter, s.status.TotalReports)
+		}
+	}
 }
 
 func (s *sysMonitor) Register(c chan<- SysStatus) {
 	s.Lock()
 	if s.outputs == nil {
-		s.outputs = map[chan<- SysStatus]struct{}{
+		s.outputs = map[chan<- SysStatus]*pendingCounts{
 			c: {},
 		}
 	} else {
-		s.outputs[c] = struct{}{}
+		s.outputs[c] = &pendingCounts{}
 	}
 	s.Unlock()
 }
@@ -72,26 +156,122 @@ func (s *sysMonitor) Deregister(c chan<- SysStatus) {
 
 var SysMonitor = &sysMonitor{status: &SysStatus{}}
 
-func Start(collectDuration time.Duration, inCGroup bool) {
-	SysMonitor.collectDuration = collectDuration
-	if inCGroup {
-		collector, err := NewCGroupCollector()
-		if err != nil {
-			logger.Errorf("new normal group controller error, msg:%s", err)
+// takeTotalReports returns reports received since last call and resets the counter
+func takeTotalReports(reporter *api.Reporter) int {
+	var totalReport int
+	totalResp := reporter.GetTotalRep()
+	for i := 0; i < 3; i++ {
+		totalReport = totalResp.Load().(int)
+		if totalResp.CompareAndSwap(totalReport, 0) {
+			break
 		}
-		SysMonitor.collector = collector
-	} else {
-		collector, err := NewNormalCollector()
-		if err != nil {
-			logger.Errorf("new normal controller error, msg:%s", err)
+		logger.Warn("Reset keeper_monitor total resp via cas fail! Maybe to many concurrent ")
+		totalResp.Store(0)
+	}
+	return totalReport
+}
+
+// addTotalReports adds n reports back to the counter of reporter
+func addTotalReports(reporter *api.Reporter, n int) {
+	if n == 0 {
+		return
+	}
+	totalResp := reporter.GetTotalRep()
+	for {
+		old := totalResp.Load().(int)
+		if totalResp.CompareAndSwap(old, old+n) {
+			return
 		}
-		SysMonitor.collector = collector
+	}
+}
+
+func Start(collectDuration time.Duration, inCGroup bool) {
+	SysMonitor.collectDuration = collectDuration
+	SysMonitor.collector = newCollector(inCGroup)
+	if SysMonitor.collector == nil {
+		logger.Error("no system collector available, keeper monitor is disabled")
+		return
 	}
 	SysMonitor.collect()
 	SysMonitor.ticker = time.NewTicker(SysMonitor.collectDuration)
+	SysMonitor.done = make(chan struct{})
+	ticker, done := SysMonitor.ticker, SysMonitor.done
 	pool.GoroutinePool.Submit(func() {
-		for range SysMonitor.ticker.C {
-			SysMonitor.collect()
+		for {
+			select {
+			case <-ticker.C:
+				SysMonitor.collect()
+			case <-done:
+				return
+			}
 		}
 	})
 }
+
+// Stop stops collecting and closes subscriber channels, subscribers still consume the pending status.
+func (s *sysMonitor) Stop() {
+	s.Lock()
+	defer s.Unlock()
+	if s.ticker != nil {
+		s.ticker.Stop()
+		close(s.done)
+		s.ticker = nil
+	}
+	for output := range s.outputs {
+		close(output)
+	}
+	s.outputs = nil
+}
+
+// Flush writes rows still buffered by subscribers.
+func (s *sysMonitor) Flush(ctx context.Context) error {
+	s.Lock()
+	subscribers := append([]Subscriber{}, s.subscribers...)
+	s.Unlock()
+	for _, subscriber := range subscribers {
+		if f, ok := subscriber.(interface{ Flush(context.Context) error }); ok {
+			if err := f.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes connections held by subscribers.
+func (s *sysMonitor) Close() error {
+	s.Lock()
+	subscribers := s.subscribers
+	s.subscribers = nil
+	s.Unlock()
+	var lastErr error
+	for _, subscriber := range subscribers {
+		if c, ok := subscriber.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+// newCollector returns a cgroup collector if configured or detected, falls back to normal collector.
+func newCollector(inCGroup bool) SysCollector {
+	if !inCGroup && InCGroup() {
+		logger.Infof("cgroup v%d limits detected, use cgroup collector", CGroupVersion(CGroupRoot))
+		inCGroup = true
+	}
+	if inCGroup {
+		collector, err := NewCGroupCollector()
+		if err == nil {
+			return collector
+		}
+		logger.Errorf("new cgroup collector error, fallback to normal collector, msg:%s", err)
+	}
+	collector, err := NewNormalCollector()
+	if err != nil {
+		logger.Errorf("new normal controller error, msg:%s", err)
+		return nil
+	}
+	return collector
+}
@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+// TimestampCollector exports clock skew of report sources and timestamps rejected.
+type TimestampCollector struct {
+	timestamps *api.Timestamps
+	skew       *prometheus.Desc
+	rejected   *prometheus.Desc
+}
+
+func NewTimestampCollector(prefix string, timestamps *api.Timestamps) *TimestampCollector {
+	return &TimestampCollector{
+		timestamps: timestamps,
+		skew: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper", "clock_skew_seconds"),
+			"keeper's clock minus timestamp of the latest report, by source", []string{"source"}, nil),
+		rejected: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_timestamp", "rejected_total"),
+			"timestamps invalid or out of bounds, by endpoint", []string{"endpoint"}, nil),
+	}
+}
+
+func (c *TimestampCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.skew
+	descs <- c.rejected
+}
+
+func (c *TimestampCollector) Collect(metrics chan<- prometheus.Metric) {
+	for source, skew := range c.timestamps.Skews() {
+		metrics <- prometheus.MustNewConstMetric(c.skew, prometheus.GaugeValue, skew.Seconds(), source)
+	}
+	for endpoint, n := range c.timestamps.Rejected() {
+		metrics <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(n), endpoint)
+	}
+}
@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/api"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestTimestampCollector(t *testing.T) {
+	timestamps := api.NewTimestamps(config.TimestampConfig{MaxFuture: time.Hour})
+	_, err := timestamps.Check("/report", "dnode1:6030", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	assert.NoError(t, err)
+	_, err = timestamps.Check("/report", "dnode2:6030", strconv.FormatInt(time.Now().Add(2*time.Hour).Unix(), 10))
+	assert.Error(t, err)
+
+	values := gatherValues(t, NewTimestampCollector("taos", timestamps))
+	assert.Len(t, values, 3)
+	assert.InDelta(t, 60, values["taos_keeper_clock_skew_seconds_dnode1:6030"], 2)
+	assert.InDelta(t, -7200, values["taos_keeper_clock_skew_seconds_dnode2:6030"], 2)
+	assert.Equal(t, float64(1), values["taos_keeper_timestamp_rejected_total_/report"])
+}
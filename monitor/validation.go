@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+// ValidationCollector exports invalid and rejected payloads of ingestion endpoints.
+type ValidationCollector struct {
+	validator  *api.Validator
+	violations *prometheus.Desc
+	rejected   *prometheus.Desc
+}
+
+func NewValidationCollector(prefix string, validator *api.Validator) *ValidationCollector {
+	return &ValidationCollector{
+		validator: validator,
+		violations: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_validation", "violations_total"),
+			"payloads with violations, by endpoint", []string{"endpoint"}, nil),
+		rejected: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_validation", "rejected_total"),
+			"payloads rejected, by endpoint", []string{"endpoint"}, nil),
+	}
+}
+
+func (c *ValidationCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.violations
+	descs <- c.rejected
+}
+
+func (c *ValidationCollector) Collect(metrics chan<- prometheus.Metric) {
+	for endpoint, stats := range c.validator.Stats() {
+		metrics <- prometheus.MustNewConstMetric(c.violations, prometheus.CounterValue, float64(stats.Invalid), endpoint)
+		metrics <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(stats.Rejected), endpoint)
+	}
+}
@@ -0,0 +1,29 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/api"
+	"github.com/taosdata/taoskeeper/infrastructure/config"
+)
+
+func TestValidationCollector(t *testing.T) {
+	validator, err := api.NewValidator(config.ValidationConfig{Mode: api.ValidationStrict})
+	assert.NoError(t, err)
+	router := gin.New()
+	api.NewReporter(&config.Config{}).Register(router.Group("", validator.Handler()))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(`{"ts":"","cluster_id":"1"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	values := gatherValues(t, NewValidationCollector("taos", validator))
+	assert.Equal(t, map[string]float64{
+		"taos_keeper_validation_violations_total_/report": 1,
+		"taos_keeper_validation_rejected_total_/report":   1,
+	}, values)
+}
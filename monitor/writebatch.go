@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+var flushReasons = []string{api.FlushBySize, api.FlushByWindow, api.FlushByClose}
+
+// WriteBatchCollector exports flushes of write batcher of general metric.
+type WriteBatchCollector struct {
+	batcher  *api.WriteBatcher
+	flushes  *prometheus.Desc
+	requests *prometheus.Desc
+	failures *prometheus.Desc
+	size     *prometheus.Desc
+	latency  *prometheus.Desc
+}
+
+func NewWriteBatchCollector(prefix string, batcher *api.WriteBatcher) *WriteBatchCollector {
+	return &WriteBatchCollector{
+		batcher: batcher,
+		flushes: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_write_batch", "flushes_total"),
+			"batches written, by flush reason", []string{"reason"}, nil),
+		requests: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_write_batch", "requests_total"),
+			"requests coalesced into batches", nil, nil),
+		failures: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_write_batch", "failures_total"),
+			"batches failed to write", nil, nil),
+		size: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_write_batch", "size_bytes"),
+			"bytes of written batches", nil, nil),
+		latency: prometheus.NewDesc(prometheus.BuildFQName(prefix, "keeper_write_batch", "latency_seconds"),
+			"time spent writing batches", nil, nil),
+	}
+}
+
+func (c *WriteBatchCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.flushes
+	descs <- c.requests
+	descs <- c.failures
+	descs <- c.size
+	descs <- c.latency
+}
+
+func (c *WriteBatchCollector) Collect(metrics chan<- prometheus.Metric) {
+	stats := c.batcher.Stats()
+	var flushes uint64
+	for _, reason := range flushReasons {
+		flushes += stats.Flushes[reason]
+		metrics <- prometheus.MustNewConstMetric(c.flushes, prometheus.CounterValue, float64(stats.Flushes[reason]), reason)
+	}
+	metrics <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.Requests))
+	metrics <- prometheus.MustNewConstMetric(c.failures, prometheus.CounterValue, float64(stats.Failures))
+	metrics <- prometheus.MustNewConstSummary(c.size, flushes, float64(stats.Bytes), nil)
+	metrics <- prometheus.MustNewConstSummary(c.latency, flushes, stats.Latency.Seconds(), nil)
+}
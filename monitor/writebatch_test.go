@@ -0,0 +1,26 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taosdata/taoskeeper/api"
+)
+
+func TestWriteBatchCollector(t *testing.T) {
+	batcher, err := api.NewWriteBatcher(4, time.Hour, false, func(ctx context.Context, buf *bytes.Buffer, qids []uint64) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, batcher.Add(context.Background(), []byte("a 1\n"), 1))
+
+	values := gatherValues(t, NewWriteBatchCollector("taos", batcher))
+	assert.Equal(t, float64(1), values["taos_keeper_write_batch_flushes_total_size"])
+	assert.Equal(t, float64(0), values["taos_keeper_write_batch_flushes_total_window"])
+	assert.Equal(t, float64(1), values["taos_keeper_write_batch_requests_total"])
+	assert.Equal(t, float64(1), values["taos_keeper_write_batch_size_bytes_count"])
+	assert.Equal(t, float64(4), values["taos_keeper_write_batch_size_bytes_sum"])
+}
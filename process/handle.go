@@ -271,7 +271,7 @@ type Value struct {
 
 func NewProcessor(conf *config.Config) *Processor {
 
-	conn, err := db.NewConnector(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host, conf.TDengine.Port, conf.TDengine.Usessl)
+	conn, err := db.DefaultManager.Get(conf.TDengine.Username, conf.TDengine.Password, conf.TDengine.Host, conf.TDengine.Port, "", conf.TDengine.Usessl)
 	if err != nil {
 		panic(err)
 	}
@@ -3,29 +3,68 @@ package system
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/taosdata/go-utils/web"
 	"github.com/taosdata/taoskeeper/api"
 	"github.com/taosdata/taoskeeper/cmd"
+	"github.com/taosdata/taoskeeper/db"
 	"github.com/taosdata/taoskeeper/infrastructure/config"
 	"github.com/taosdata/taoskeeper/infrastructure/log"
 	"github.com/taosdata/taoskeeper/monitor"
 	"github.com/taosdata/taoskeeper/process"
+	"github.com/taosdata/taoskeeper/util/pool"
+	"github.com/taosdata/taoskeeper/util/retry"
 	"github.com/taosdata/taoskeeper/version"
 
+	"github.com/gin-gonic/gin"
 	"github.com/kardianos/service"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var logger = log.GetLogger("PRG")
 
-func Init() *http.Server {
+// bootstrap steps, each one gates handlers depending on it
+const (
+	stepDatabase      = "database"
+	stepHost          = "host"
+	stepAdapter       = "adapter"
+	stepGeneralMetric = "general_metric"
+	stepProcessor     = "processor"
+)
+
+// processorWaitTimeout is the longest time to wait for the first report before creating processor
+const processorWaitTimeout = 35 * time.Second
+
+func Init() *program {
 	conf := config.InitConfig()
 	log.ConfigLog()
 
+	if err := db.SetProtocol(conf.TDengine.Protocol); err != nil {
+		panic(err)
+	}
+	db.SetWSSkipVerify(conf.TDengine.WSSkipVerify)
+	db.SetTimeouts(conf.Timeout.Query, conf.Timeout.Exec)
+	retry.SetDefault(retry.Policy{
+		MaxAttempts:    conf.Retry.MaxAttempts,
+		InitialBackoff: conf.Retry.InitialBackoff,
+		MaxBackoff:     conf.Retry.MaxBackoff,
+		Multiplier:     2,
+		Jitter:         conf.Retry.Jitter,
+	})
+	db.DefaultBreaker.Configure(conf.Breaker.FailureThreshold, conf.Breaker.OpenTimeout, conf.Breaker.HalfOpenRequests)
+	db.DefaultManager.Configure(db.PoolConfig{
+		MaxOpenConns:    conf.TDengine.Pool.MaxOpenConns,
+		MaxIdleConns:    conf.TDengine.Pool.MaxIdleConns,
+		ConnMaxLifetime: conf.TDengine.Pool.ConnMaxLifetime,
+		ConnMaxIdleTime: conf.TDengine.Pool.ConnMaxIdleTime,
+	})
+
 	if len(conf.Transfer) > 0 || len(conf.Drop) > 0 {
 		cmd := cmd.NewCommand(conf)
 		cmd.Process(conf)
@@ -33,46 +72,124 @@ func Init() *http.Server {
 		return nil
 	}
 
+	db.SetCredentials(conf.TDengine.Username, conf.TDengine.Password)
+	if err := config.WatchCredentials(func(username, password string, err error) {
+		if err != nil {
+			logger.Errorf("load credentials after they changed error, msg:%s", err)
+			return
+		}
+		db.SetCredentials(username, password)
+	}); err != nil {
+		logger.Errorf("watch credentials error, msg:%s", err)
+	}
+
 	router := web.CreateRouter(false, &conf.Cors, false)
 	router.Use(log.GinLog())
 	router.Use(log.GinRecoverLog())
+	router.Use(monitor.GinStats())
+
+	prg := &program{conf: conf, bootstrap: api.NewBootstrap()}
+	prg.ctx, prg.cancel = context.WithCancel(context.Background())
 
+	checkHealth := api.NewCheckHealth(version.Version, prg.bootstrap)
+	checkHealth.Init(router)
+	prg.readiness = api.NewReadiness(conf, prg.processorReady)
+	prg.readiness.Init(router)
+
+	limits := api.NewLimits(conf.Limit)
+	validator, err := api.NewValidator(conf.Validation)
+	if err != nil {
+		panic(fmt.Errorf("invalid validation config: %s", err))
+	}
+	timestamps := api.NewTimestamps(conf.Timestamp)
+	// ingestion endpoints are gated by their bootstrap step, breaker and limits, and validate payloads
+	ingest := func(step string) gin.IRouter {
+		return router.Group("", prg.bootstrap.Gate(step), api.BreakerGate(), limits.Handler(), limits.Decompress(),
+			validator.Handler(), timestamps.Handler())
+	}
 	reporter := api.NewReporter(conf)
-	reporter.Init(router)
+	prg.bootstrap.Add(stepDatabase, func(ctx context.Context) error {
+		reporter.Prepare()
+		return nil
+	})
+	reporter.Register(ingest(stepDatabase))
 	monitor.StartMonitor("", conf, reporter)
-	go func() {
-		// wait for monitor to all metric received
-		time.Sleep(time.Second * 35)
-
-		processor := process.NewProcessor(conf)
-		node := api.NewNodeExporter(processor)
-		node.Init(router)
-	}()
+	history := monitor.NewHistorySubscriber(conf.Monitor.HistorySize)
+	history.Init(router)
+	monitor.SysMonitor.Subscribe(history)
+	gauges := monitor.NewPrometheusSubscriber(conf.Metrics.Prefix)
+	monitor.SysMonitor.Subscribe(gauges)
+	collectors := []prometheus.Collector{gauges, monitor.NewBreakerCollector(conf.Metrics.Prefix, db.DefaultBreaker),
+		monitor.NewConnPoolCollector(conf.Metrics.Prefix, db.DefaultManager),
+		monitor.NewLimitCollector(conf.Metrics.Prefix, limits),
+		monitor.NewValidationCollector(conf.Metrics.Prefix, validator),
+		monitor.NewTimestampCollector(conf.Metrics.Prefix, timestamps)}
+	if conf.Metrics.Host.Enable {
+		prg.bootstrap.Add(stepHost, func(ctx context.Context) error {
+			host := monitor.StartHostMonitor("", conf)
+			prg.Lock()
+			prg.host = host
+			prg.Unlock()
+			collectors = append(collectors, host)
+			return nil
+		})
+	}
 
 	//api.NewAdapterImporter(conf)
 
-	checkHealth := api.NewCheckHealth(version.Version)
-	checkHealth.Init(router)
+	prg.adapter = api.NewAdapter(conf)
+	prg.bootstrap.Add(stepAdapter, func(ctx context.Context) error {
+		return prg.adapter.Prepare()
+	})
+	prg.adapter.Register(ingest(stepAdapter))
 
-	adapter := api.NewAdapter(conf)
-	if err := adapter.Init(router); err != nil {
-		panic(err)
+	prg.genMetric = api.NewGeneralMetric(conf)
+	prg.bootstrap.Add(stepGeneralMetric, func(ctx context.Context) error {
+		return prg.genMetric.Prepare()
+	})
+	prg.genMetric.Register(ingest(stepGeneralMetric))
+	if conf.SlowSql.Query.Enable {
+		prg.genMetric.RegisterQuery(router.Group("", api.BearerAuth(conf.SlowSql.Query.Token),
+			prg.bootstrap.Gate(stepGeneralMetric), api.BreakerGate(), limits.Handler()))
 	}
-
-	gen_metric := api.NewGeneralMetric(conf)
-	if err := gen_metric.Init(router); err != nil {
-		panic(err)
+	if conf.DebugAPI.Enable {
+		prg.genMetric.Schemas().Init(router.Group("", api.BearerAuth(conf.DebugAPI.Token),
+			prg.bootstrap.Gate(stepGeneralMetric)))
 	}
+	if batcher := prg.genMetric.Batcher(); batcher != nil {
+		collectors = append(collectors, monitor.NewWriteBatchCollector(conf.Metrics.Prefix, batcher))
+	}
+	collectors = append(collectors, monitor.NewRedactionCollector(conf.Metrics.Prefix, prg.genMetric.Redactor()))
+
+	prg.bootstrap.Add(stepProcessor, func(ctx context.Context) error {
+		// processor loads tables created by reports, wait for the first report written for a while
+		waitCtx, cancel := context.WithTimeout(ctx, processorWaitTimeout)
+		defer cancel()
+		_ = waitUntil(waitCtx, func() bool { return !api.LastWriteTime().IsZero() })
+
+		processor := process.NewProcessor(conf)
+		prg.Lock()
+		defer prg.Unlock()
+		if prg.stopped {
+			_ = processor.Close()
+			return ctx.Err()
+		}
+		prg.processor = processor
+		prg.metrics = api.NewNodeExporter(processor, collectors...).Handler()
+		return nil
+	})
+	router.GET("metrics", prg.bootstrap.Gate(stepProcessor), func(c *gin.Context) {
+		prg.metrics(c)
+	})
 
-	server := &http.Server{
+	prg.server = &http.Server{
 		Addr:    ":" + strconv.Itoa(conf.Port),
 		Handler: router,
 	}
-	return server
+	return prg
 }
 
-func Start(server *http.Server) {
-	prg := newProgram(server)
+func Start(prg *program) {
 	svcConfig := &service.Config{
 		Name:        "taoskeeper",
 		DisplayName: "taoskeeper",
@@ -89,11 +206,25 @@ func Start(server *http.Server) {
 }
 
 type program struct {
-	server *http.Server
+	sync.Mutex
+	server    *http.Server
+	conf      *config.Config
+	adapter   *api.Adapter
+	genMetric *api.GeneralMetric
+	processor *process.Processor
+	host      *monitor.HostCollector
+	readiness *api.Readiness
+	bootstrap *api.Bootstrap
+	metrics   gin.HandlerFunc
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopped   bool
 }
 
-func newProgram(server *http.Server) *program {
-	return &program{server: server}
+func (p *program) processorReady() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.processor != nil
 }
 
 func (p *program) Start(s service.Service) error {
@@ -109,24 +240,78 @@ func (p *program) Start(s service.Service) error {
 			panic(fmt.Errorf("taoskeeper start up fail! msg:%s", err))
 		}
 	}()
+	go p.bootstrap.Run(p.ctx)
+	if p.conf.TDengine.ReauthInterval > 0 {
+		go db.StartReauth(p.ctx, p.conf.TDengine.ReauthInterval, p.conf.TDengine.Host, p.conf.TDengine.Port,
+			p.conf.TDengine.Usessl, config.LoadCredentials)
+	}
 	return nil
 }
 
+// Stop shuts down in order: stop accepting, drain in-flight requests, stop monitors, flush pending batches,
+// close connections, drain goroutine pool and flush logs. Monitors are stopped before flushing so that no
+// status is produced after the last flush.
 func (p *program) Stop(s service.Service) error {
-	logger.Println("Shutdown WebServer ...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	p.cancel()
+	p.Lock()
+	p.stopped = true
+	processor := p.processor
+	host := p.host
+	p.Unlock()
 
-	if err := p.server.Shutdown(ctx); err != nil {
-		logger.Println("WebServer Shutdown error:", err)
-	}
+	conf := p.conf.Shutdown
+	runStages([]stage{
+		{name: "server", timeout: conf.ServerTimeout, run: p.server.Shutdown},
+		{name: "drain", timeout: conf.DrainTimeout, run: func(ctx context.Context) error {
+			return waitUntil(ctx, func() bool { return monitor.InFlight() == 0 })
+		}},
+		{name: "monitor", timeout: conf.FlushTimeout, run: func(ctx context.Context) error {
+			monitor.SysMonitor.Stop()
+			if host != nil {
+				host.Stop()
+			}
+			return nil
+		}},
+		{name: "flush", timeout: conf.FlushTimeout, run: func(ctx context.Context) error {
+			if err := p.genMetric.Flush(ctx); err != nil {
+				return err
+			}
+			return monitor.SysMonitor.Flush(ctx)
+		}},
+		{name: "close", timeout: conf.CloseTimeout, run: func(ctx context.Context) error {
+			return p.closeConnections(processor, host)
+		}},
+		{name: "pool", timeout: conf.PoolTimeout, run: func(ctx context.Context) error {
+			defer pool.GoroutinePool.Release()
+			return waitUntil(ctx, func() bool { return pool.GoroutinePool.Running() == 0 })
+		}},
+	})
 
-	logger.Println("Server exiting")
-
-	ctxLog, cancelLog := context.WithTimeout(context.Background(), 5*time.Second)
+	ctxLog, cancelLog := context.WithTimeout(context.Background(), conf.LogTimeout)
 	defer cancelLog()
-	logger.Println("Flushing Log")
+	logger.Info("Flushing Log")
 	log.Close(ctxLog)
 
 	return nil
 }
+
+// closeConnections closes all connectors and returns the last error.
+func (p *program) closeConnections(processor *process.Processor, host *monitor.HostCollector) error {
+	closers := []io.Closer{p.adapter, p.genMetric, p.readiness, monitor.SysMonitor}
+	if host != nil {
+		closers = append(closers, host)
+	}
+	if processor != nil {
+		closers = append(closers, processor)
+	}
+	// connectors handed out by the manager are closed last
+	closers = append(closers, db.DefaultManager)
+	var lastErr error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			logger.Errorf("close %T error, msg:%s", closer, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,60 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// stage is one step of shutdown, run is canceled when timeout exceeded.
+type stage struct {
+	name    string
+	timeout time.Duration
+	run     func(ctx context.Context) error
+}
+
+// runStages runs stages in order, a failed or timed out stage does not stop the following ones.
+func runStages(stages []stage) {
+	for _, s := range stages {
+		start := time.Now()
+		logger.Infof("shutdown stage %s start, timeout:%s", s.name, s.timeout)
+		err := runStage(s)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			logger.Warnf("shutdown stage %s timeout after %s", s.name, time.Since(start))
+		case err != nil:
+			logger.Errorf("shutdown stage %s error, msg:%s", s.name, err)
+		default:
+			logger.Infof("shutdown stage %s finished in %s", s.name, time.Since(start))
+		}
+	}
+}
+
+func runStage(s stage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitUntil polls cond until it returns true or ctx is done.
+func waitUntil(ctx context.Context, cond func() bool) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
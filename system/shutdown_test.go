@@ -0,0 +1,41 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStages(t *testing.T) {
+	var order []string
+	runStages([]stage{
+		{name: "first", timeout: time.Second, run: func(ctx context.Context) error {
+			order = append(order, "first")
+			return errors.New("failed")
+		}},
+		{name: "slow", timeout: 10 * time.Millisecond, run: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+		{name: "last", timeout: time.Second, run: func(ctx context.Context) error {
+			order = append(order, "last")
+			return nil
+		}},
+	})
+	assert.Equal(t, []string{"first", "last"}, order)
+}
+
+func TestWaitUntil(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, waitUntil(ctx, func() bool { return false }), context.DeadlineExceeded)
+
+	n := 0
+	assert.NoError(t, waitUntil(context.Background(), func() bool {
+		n++
+		return n > 2
+	}))
+}
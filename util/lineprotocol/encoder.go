@@ -0,0 +1,311 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Precision is the unit of timestamps, its String is the precision parameter of the write API.
+type Precision int
+
+const (
+	Nanosecond Precision = iota
+	Microsecond
+	Millisecond
+	Second
+)
+
+func (p Precision) String() string {
+	switch p {
+	case Nanosecond:
+		return "ns"
+	case Microsecond:
+		return "u"
+	case Millisecond:
+		return "ms"
+	case Second:
+		return "s"
+	}
+	return fmt.Sprintf("Precision(%d)", int(p))
+}
+
+// ParsePrecision parses the precision of a database or write API, empty means milliseconds.
+func ParsePrecision(s string) (Precision, error) {
+	switch strings.ToLower(s) {
+	case "ns":
+		return Nanosecond, nil
+	case "us", "u":
+		return Microsecond, nil
+	case "ms", "":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	}
+	return Millisecond, fmt.Errorf("unknown precision %q", s)
+}
+
+// Timestamp returns t in units of p.
+func (p Precision) Timestamp(t time.Time) int64 {
+	switch p {
+	case Microsecond:
+		return t.UnixMicro()
+	case Millisecond:
+		return t.UnixMilli()
+	case Second:
+		return t.Unix()
+	}
+	return t.UnixNano()
+}
+
+// characters escaped with backslash in each part of a line
+const (
+	measurementSpecials = ", \\"
+	keySpecials         = ",= \"\\"
+	stringSpecials      = "\"\\"
+)
+
+var errNoFields = errors.New("no fields")
+
+type section int
+
+const (
+	sectionNone section = iota
+	sectionTags
+	sectionFields
+)
+
+// Encoder writes lines of InfluxDB line protocol to a buffer:
+//
+//	measurement,tag=value field=1f64,count=2i64 1703226836762
+//
+// Tags and fields are written in the order added. A line is written by StartLine, AddTag, Add* of fields and
+// EndLine. Invalid input fails the line, EndLine returns the error and removes the line from the buffer, so the
+// buffer only holds valid lines.
+type Encoder struct {
+	buf       *bytes.Buffer
+	precision Precision
+	section   section
+	lineStart int
+	err       error
+}
+
+func NewEncoder(buf *bytes.Buffer, precision Precision) *Encoder {
+	return &Encoder{buf: buf, precision: precision}
+}
+
+// StartLine starts a line of measurement, a line not ended is discarded.
+func (e *Encoder) StartLine(measurement string) {
+	if e.section != sectionNone {
+		e.buf.Truncate(e.lineStart)
+	}
+	e.lineStart = e.buf.Len()
+	e.section = sectionTags
+	e.err = nil
+	if len(measurement) == 0 {
+		e.fail(errors.New("empty measurement"))
+		return
+	}
+	e.writeEscaped(measurement, measurementSpecials)
+}
+
+// AddTag adds a tag, tags must be added before fields. Line protocol does not allow empty tag values.
+func (e *Encoder) AddTag(key, value string) {
+	if !e.ok() {
+		return
+	}
+	if e.section != sectionTags {
+		e.fail(fmt.Errorf("tag %s added after fields", key))
+		return
+	}
+	if len(key) == 0 {
+		e.fail(errors.New("empty tag key"))
+		return
+	}
+	if len(value) == 0 {
+		e.fail(fmt.Errorf("empty value of tag %s", key))
+		return
+	}
+	e.buf.WriteByte(',')
+	e.writeEscaped(key, keySpecials)
+	e.buf.WriteByte('=')
+	e.writeEscaped(value, keySpecials)
+}
+
+// AddFloat adds a double field, NaN and infinities can not be written and are skipped.
+func (e *Encoder) AddFloat(key string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		e.buf.WriteString("f64")
+	}
+}
+
+// AddFloat32 adds a float field, values out of range of float32 fail the line.
+func (e *Encoder) AddFloat32(key string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if math.Abs(value) > math.MaxFloat32 {
+		e.fail(fmt.Errorf("%v of %s overflows float", value, key))
+		return
+	}
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatFloat(value, 'f', -1, 32))
+		e.buf.WriteString("f32")
+	}
+}
+
+// AddIntN adds a signed field of bits, 8, 16, 32 or 64 for tinyint, smallint, int or bigint. Values out of range
+// fail the line.
+func (e *Encoder) AddIntN(key string, value int64, bits int) {
+	switch {
+	case bits != 8 && bits != 16 && bits != 32 && bits != 64:
+		e.fail(fmt.Errorf("invalid bits %d of %s", bits, key))
+		return
+	case bits < 64 && (value < -1<<(bits-1) || value >= 1<<(bits-1)):
+		e.fail(fmt.Errorf("%d of %s overflows i%d", value, key, bits))
+		return
+	}
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatInt(value, 10))
+		e.buf.WriteString("i" + strconv.Itoa(bits))
+	}
+}
+
+// AddUintN adds an unsigned field of bits, 8, 16, 32 or 64. Values out of range fail the line.
+func (e *Encoder) AddUintN(key string, value uint64, bits int) {
+	switch {
+	case bits != 8 && bits != 16 && bits != 32 && bits != 64:
+		e.fail(fmt.Errorf("invalid bits %d of %s", bits, key))
+		return
+	case bits < 64 && value >= 1<<bits:
+		e.fail(fmt.Errorf("%d of %s overflows u%d", value, key, bits))
+		return
+	}
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatUint(value, 10))
+		e.buf.WriteString("u" + strconv.Itoa(bits))
+	}
+}
+
+// AddInt adds a bigint field.
+func (e *Encoder) AddInt(key string, value int64) {
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatInt(value, 10))
+		e.buf.WriteString("i64")
+	}
+}
+
+// AddUint adds a bigint unsigned field.
+func (e *Encoder) AddUint(key string, value uint64) {
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatUint(value, 10))
+		e.buf.WriteString("u64")
+	}
+}
+
+// AddBool adds a bool field.
+func (e *Encoder) AddBool(key string, value bool) {
+	if e.startField(key) {
+		e.buf.WriteString(strconv.FormatBool(value))
+	}
+}
+
+// AddString adds a varchar field.
+func (e *Encoder) AddString(key string, value string) {
+	if e.startField(key) {
+		e.writeString(value)
+	}
+}
+
+// AddNchar adds an nchar field.
+func (e *Encoder) AddNchar(key string, value string) {
+	if e.startField(key) {
+		e.buf.WriteByte('L')
+		e.writeString(value)
+	}
+}
+
+func (e *Encoder) writeString(value string) {
+	e.buf.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(stringSpecials, value[i]) >= 0 {
+			e.buf.WriteByte('\\')
+		}
+		e.buf.WriteByte(value[i])
+	}
+	e.buf.WriteByte('"')
+}
+
+func (e *Encoder) startField(key string) bool {
+	if !e.ok() {
+		return false
+	}
+	if len(key) == 0 {
+		e.fail(errors.New("empty field key"))
+		return false
+	}
+	if e.section == sectionTags {
+		e.buf.WriteByte(' ')
+		e.section = sectionFields
+	} else {
+		e.buf.WriteByte(',')
+	}
+	e.writeEscaped(key, keySpecials)
+	e.buf.WriteByte('=')
+	return e.ok()
+}
+
+// EndLine ends the line with timestamp t, t is omitted if zero. If the line is invalid or has no fields, it is
+// removed and the error is returned.
+func (e *Encoder) EndLine(t time.Time) error {
+	if e.section == sectionNone {
+		return errors.New("line not started")
+	}
+	if e.ok() && e.section != sectionFields {
+		e.fail(errNoFields)
+	}
+	e.section = sectionNone
+	if err := e.err; err != nil {
+		e.buf.Truncate(e.lineStart)
+		e.err = nil
+		return err
+	}
+	if !t.IsZero() {
+		e.buf.WriteByte(' ')
+		e.buf.WriteString(strconv.FormatInt(e.precision.Timestamp(t), 10))
+	}
+	e.buf.WriteByte('\n')
+	return nil
+}
+
+func (e *Encoder) ok() bool {
+	return e.section != sectionNone && e.err == nil
+}
+
+func (e *Encoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// writeEscaped writes s with specials escaped, newlines can not be escaped and fail the line.
+func (e *Encoder) writeEscaped(s string, specials string) {
+	if strings.ContainsAny(s, "\r\n") {
+		e.fail(fmt.Errorf("newline in %q", s))
+		return
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(specials, s[i]) >= 0 {
+			e.buf.WriteByte('\\')
+		}
+		e.buf.WriteByte(s[i])
+	}
+}
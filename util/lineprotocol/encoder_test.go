@@ -0,0 +1,225 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, Millisecond)
+	ts := time.UnixMilli(1703226836762)
+
+	e.StartLine("taosd_dnodes_info")
+	e.AddTag("cluster_id", "123")
+	e.AddTag("dnode ep", `host,1=a"b\`)
+	e.AddFloat("uptime", 1.5)
+	e.AddFloat("nan", math.NaN())
+	e.AddInt("vnodes", -3)
+	e.AddUint("mem", 4)
+	e.AddBool("ok", true)
+	e.AddString("note", `say "hi"\`)
+	assert.NoError(t, e.EndLine(ts))
+
+	e.StartLine("m,1 2")
+	e.AddFloat("v", 2)
+	assert.NoError(t, e.EndLine(time.Time{}))
+
+	assert.Equal(t, `taosd_dnodes_info,cluster_id=123,dnode\ ep=host\,1\=a\"b\\ `+
+		`uptime=1.5f64,vnodes=-3i64,mem=4u64,ok=true,note="say \"hi\"\\" 1703226836762`+"\n"+
+		`m\,1\ 2 v=2f64`+"\n", buf.String())
+}
+
+func TestEncoderSizedFields(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, Millisecond)
+
+	e.StartLine("m")
+	e.AddFloat32("f", 1.5)
+	e.AddIntN("i32", -2, 32)
+	e.AddIntN("i16", 32767, 16)
+	e.AddIntN("i8", -128, 8)
+	e.AddIntN("i64", 5, 64)
+	e.AddUintN("u32", 4294967295, 32)
+	e.AddUintN("u16", 1, 16)
+	e.AddUintN("u8", 255, 8)
+	e.AddNchar("n", `a "b"`)
+	assert.NoError(t, e.EndLine(time.UnixMilli(1)))
+	assert.Equal(t, `m f=1.5f32,i32=-2i32,i16=32767i16,i8=-128i8,i64=5i64,u32=4294967295u32,u16=1u16,u8=255u8,`+
+		`n=L"a \"b\"" 1`+"\n", buf.String())
+
+	for _, add := range []func(){
+		func() { e.AddIntN("v", 128, 8) },
+		func() { e.AddIntN("v", 1, 12) },
+		func() { e.AddUintN("v", 65536, 16) },
+		func() { e.AddFloat32("v", math.MaxFloat64) },
+	} {
+		e.StartLine("m")
+		add()
+		assert.Error(t, e.EndLine(time.UnixMilli(1)))
+	}
+}
+
+func TestEncoderInvalidLines(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, Second)
+	ts := time.Unix(1, 0)
+
+	e.StartLine("m")
+	e.AddTag("t", "")
+	e.AddFloat("v", 1)
+	assert.EqualError(t, e.EndLine(ts), "empty value of tag t")
+
+	e.StartLine("m")
+	e.AddTag("t", "a")
+	assert.Equal(t, errNoFields, e.EndLine(ts))
+
+	e.StartLine("m")
+	e.AddFloat("v", math.Inf(1))
+	assert.Equal(t, errNoFields, e.EndLine(ts))
+
+	e.StartLine("m")
+	e.AddFloat("v", 1)
+	e.AddTag("t", "a")
+	assert.EqualError(t, e.EndLine(ts), "tag t added after fields")
+
+	e.StartLine("m")
+	e.AddTag("t", "a\nb")
+	e.AddFloat("v", 1)
+	assert.Error(t, e.EndLine(ts))
+
+	e.StartLine("")
+	assert.Error(t, e.EndLine(ts))
+	assert.Error(t, e.EndLine(ts))
+
+	// line not ended is discarded
+	e.StartLine("m")
+	e.AddFloat("lost", 1)
+	e.StartLine("m")
+	e.AddInt("v", 1)
+	assert.NoError(t, e.EndLine(ts))
+	assert.Equal(t, "m v=1i64 1\n", buf.String())
+}
+
+func TestPrecision(t *testing.T) {
+	ts := time.Unix(1, 2003004)
+	assert.Equal(t, int64(1002003004), Nanosecond.Timestamp(ts))
+	assert.Equal(t, int64(1002003), Microsecond.Timestamp(ts))
+	assert.Equal(t, int64(1002), Millisecond.Timestamp(ts))
+	assert.Equal(t, int64(1), Second.Timestamp(ts))
+	assert.Equal(t, []string{"ns", "u", "ms", "s"},
+		[]string{Nanosecond.String(), Microsecond.String(), Millisecond.String(), Second.String()})
+
+	for s, want := range map[string]Precision{"ns": Nanosecond, "us": Microsecond, "u": Microsecond, "MS": Millisecond,
+		"": Millisecond, "s": Second} {
+		p, err := ParsePrecision(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, p, s)
+	}
+	_, err := ParsePrecision("m")
+	assert.Error(t, err)
+}
+
+// parsed is a line read back by parseLine.
+type parsed struct {
+	measurement string
+	tags        [][2]string
+	fields      [][2]string
+	ts          string
+}
+
+// readUntil reads s until an unescaped byte of stops, a backslash takes the next byte literally.
+func readUntil(s string, stops string) (string, string) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case strings.IndexByte(stops, s[i]) >= 0:
+			return b.String(), s[i:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// parseLine reads a line the way TDengine schemaless does, string field values are kept quoted.
+func parseLine(t *testing.T, line string) parsed {
+	var p parsed
+	p.measurement, line = readUntil(line, ", ")
+	for strings.HasPrefix(line, ",") {
+		var key, value string
+		key, line = readUntil(line[1:], "=")
+		assert.True(t, strings.HasPrefix(line, "="), "tag %q without value", key)
+		value, line = readUntil(line[1:], ", ")
+		p.tags = append(p.tags, [2]string{key, value})
+	}
+	assert.True(t, strings.HasPrefix(line, " "), "no fields in %q", line)
+	line = line[1:]
+	for len(line) > 0 {
+		var key, value string
+		key, line = readUntil(line, "=")
+		assert.True(t, strings.HasPrefix(line, "="), "field %q without value", key)
+		line = line[1:]
+		if strings.HasPrefix(line, `"`) {
+			value, line = readUntil(line[1:], `"`)
+			value = `"` + value + `"`
+			line = line[1:]
+		} else {
+			value, line = readUntil(line, ", ")
+		}
+		p.fields = append(p.fields, [2]string{key, value})
+		if !strings.HasPrefix(line, ",") {
+			break
+		}
+		line = line[1:]
+	}
+	p.ts = strings.TrimPrefix(line, " ")
+	return p
+}
+
+func FuzzEncoder(f *testing.F) {
+	f.Add("taosd_dnodes_info", "cluster_id", "123", "uptime", "1", 1.5, int64(1703226836762))
+	f.Add("m,1 2", `k"=`, `v\`, `f\`, `s"\`, -0.25, int64(0))
+	f.Add("m", "k", "a b,c=d", "f", "", math.MaxFloat64, int64(-1))
+	f.Fuzz(func(t *testing.T, measurement, tagKey, tagValue, fieldKey, str string, value float64, ms int64) {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf, Millisecond)
+		e.StartLine(measurement)
+		e.AddTag(tagKey, tagValue)
+		e.AddFloat(fieldKey, value)
+		e.AddString("s", str)
+		err := e.EndLine(time.UnixMilli(ms))
+		if err != nil {
+			assert.Equal(t, 0, buf.Len(), "invalid line is written")
+			return
+		}
+		out := buf.String()
+		assert.Equal(t, 1, strings.Count(out, "\n")-strings.Count(str, "\n"))
+		assert.True(t, strings.HasSuffix(out, "\n"))
+
+		p := parseLine(t, strings.TrimSuffix(out, "\n"))
+		assert.Equal(t, measurement, p.measurement)
+		assert.Equal(t, [][2]string{{tagKey, tagValue}}, p.tags)
+		fields := [][2]string{{"s", `"` + str + `"`}}
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			assert.Len(t, p.fields, 2)
+			fields = append([][2]string{{fieldKey, p.fields[0][1]}}, fields...)
+			written, err := strconv.ParseFloat(strings.TrimSuffix(p.fields[0][1], "f64"), 64)
+			assert.NoError(t, err)
+			assert.Equal(t, value, written)
+		}
+		assert.Equal(t, fields, p.fields)
+		if ts := time.UnixMilli(ms); !ts.IsZero() {
+			assert.Equal(t, strconv.FormatInt(ms, 10), p.ts)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Idempotency tells whether an operation can be sent again after it may have reached the server.
+type Idempotency int
+
+const (
+	// Idempotent operations are retried on any retryable error.
+	Idempotent Idempotency = iota
+	// NonIdempotent operations are retried only when the request was not sent.
+	NonIdempotent
+)
+
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes backoff by the fraction, 0.2 means backoff ±20%
+	Jitter float64
+}
+
+var DefaultPolicy = Policy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var (
+	lock          sync.RWMutex
+	defaultPolicy = DefaultPolicy
+)
+
+// SetDefault sets the policy returned by Default.
+func SetDefault(p Policy) {
+	lock.Lock()
+	defer lock.Unlock()
+	defaultPolicy = p
+}
+
+// Default returns the policy shared by keeper.
+func Default() Policy {
+	lock.RLock()
+	defer lock.RUnlock()
+	return defaultPolicy
+}
+
+// Do calls fn until it succeeds, the error is not retryable, attempts are used up or ctx is done.
+// The last error is returned.
+func (p Policy) Do(ctx context.Context, idempotency Idempotency, fn func(ctx context.Context) error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !Retryable(err, idempotency) {
+			return err
+		}
+		timer := time.NewTimer(p.jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = p.next(backoff)
+	}
+}
+
+func (p Policy) next(backoff time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff = time.Duration(float64(backoff) * multiplier)
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+func (p Policy) jitter(backoff time.Duration) time.Duration {
+	if p.Jitter <= 0 || backoff <= 0 {
+		return backoff
+	}
+	delta := float64(backoff) * p.Jitter
+	return time.Duration(float64(backoff) - delta + rand.Float64()*2*delta)
+}
+
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// Temporary marks err retryable for idempotent operations, such as 5xx responses.
+func Temporary(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &temporaryError{err: err}
+}
+
+// Retryable classifies err. Errors before the request was sent are always retryable, network errors and
+// temporary errors are retryable only for idempotent operations, others such as errors returned by server
+// are not retryable.
+func Retryable(err error, idempotency Idempotency) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if notSent(err) {
+		return true
+	}
+	if idempotency == NonIdempotent {
+		return false
+	}
+	var temporary *temporaryError
+	if errors.As(err, &temporary) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// notSent returns true when err happened while connecting to server
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fastPolicy = Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+
+func TestDo(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://127.0.0.1:6041", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	readErr := &url.Error{Op: "Post", URL: "http://127.0.0.1:6041", Err: &net.OpError{Op: "read", Err: errors.New("connection reset")}}
+	serverErr := errors.New("[0x2603] Table does not exist")
+
+	tests := []struct {
+		name        string
+		idempotency Idempotency
+		errs        []error
+		calls       int
+		err         error
+	}{
+		{name: "success", idempotency: Idempotent, errs: []error{nil}, calls: 1},
+		{name: "retry then success", idempotency: Idempotent, errs: []error{readErr, nil}, calls: 2},
+		{name: "attempts used up", idempotency: Idempotent, errs: []error{io.EOF, io.EOF, io.EOF, nil}, calls: 3, err: io.EOF},
+		{name: "server error", idempotency: Idempotent, errs: []error{serverErr, nil}, calls: 1, err: serverErr},
+		{name: "temporary", idempotency: Idempotent, errs: []error{Temporary(serverErr), nil}, calls: 2},
+		{name: "non idempotent not sent", idempotency: NonIdempotent, errs: []error{dialErr, nil}, calls: 2},
+		{name: "non idempotent sent", idempotency: NonIdempotent, errs: []error{readErr, nil}, calls: 1, err: readErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := fastPolicy.Do(context.Background(), tt.idempotency, func(ctx context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			assert.Equal(t, tt.calls, calls)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Policy{MaxAttempts: 3, InitialBackoff: time.Hour}.Do(ctx, Idempotent, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return io.EOF
+	})
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, Multiplier: 2, Jitter: 0.5}
+	assert.Equal(t, 2*time.Second, p.next(time.Second))
+	assert.Equal(t, 3*time.Second, p.next(2*time.Second))
+	for i := 0; i < 100; i++ {
+		d := p.jitter(time.Second)
+		assert.True(t, d >= 500*time.Millisecond && d <= 1500*time.Millisecond, d)
+	}
+}
@@ -50,15 +50,6 @@ func ParseUint(s string, base, bitSize int) (uint64, error) {
 	return v, nil
 }
 
-func EscapeInfluxProtocol(s string) string {
-	s = strings.TrimSuffix(s, "\\")
-	s = strings.ReplaceAll(s, ",", "\\,")
-	s = strings.ReplaceAll(s, "=", "\\=")
-	s = strings.ReplaceAll(s, " ", "\\ ")
-	s = strings.ReplaceAll(s, "\"", "\\\"")
-	return s
-}
-
 func GetCfg() *config.Config {
 	c := &config.Config{
 		InstanceID: 64,